@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/utils"
@@ -28,7 +29,15 @@ func parseConfig() (*config.Config, error) {
 	//var flagLogLevel = flag.String("l", defaultLogLevel, "log level")
 	var flagKey = flag.String("k", "", "Key")
 	var flagRateLimit = flag.Int("l", defaultRateLimit, "maximum number of simultaneous requests to the server")
-	var flagCryptoKey = flag.String("crypto-key", "", "path to public key file for asymmetric encryption")
+	var flagCryptoKey = flag.String("crypto-key", "", "path to server public key or certificate file (RSA, X25519, Ed25519 or ECDSA) for asymmetric encryption")
+	var flagSpoolDir = flag.String("spool-dir", "", "directory for batches that could not be sent (empty to disable)")
+	var flagCompression = flag.String("compression", "", "request body compression: gzip, zstd or snappy")
+	var flagStatsDAddr = flag.String("statsd", "", "UDP address to receive StatsD metrics on (empty to disable)")
+	var flagPushAddr = flag.String("push", "", "loopback host:port or unix:/path to accept metrics from local applications (empty to disable)")
+	var flagTLSCA = flag.String("tls-ca", "", "path to CA bundle the server certificate must be signed by (enables HTTPS)")
+	var flagTLSCert = flag.String("tls-cert", "", "path to client TLS certificate file for mTLS")
+	var flagTLSKey = flag.String("tls-key", "", "path to client TLS private key file for mTLS")
+	var flagAPIKey = flag.String("api-key", "", "API key of this agent in the form <id>.<secret>")
 	var flagConfigFile = flag.String("c", "", "path to JSON configuration file")
 	var flagConfigFileLong = flag.String("config", "", "path to JSON configuration file")
 
@@ -60,7 +69,8 @@ func parseConfig() (*config.Config, error) {
 		return nil, fmt.Errorf("error parsing env: %w", err)
 	}
 
-	flagConfig := &config.Config{}
+	// значения из окружения сохраняются, флаги заполняют только незаданные поля
+	flagConfig := &envConfig
 
 	utils.SetStringIfUnset(envSet, "ADDRESS", &flagConfig.Server.Address, *flagRunAddr)
 	utils.SetIntIfUnset(envSet, "REPORT_INTERVAL", &flagConfig.Agent.ReportInterval, *flagReportSeconds)
@@ -69,11 +79,23 @@ func parseConfig() (*config.Config, error) {
 	utils.SetStringIfUnset(envSet, "KEY", &flagConfig.Security.Key, *flagKey)
 	utils.SetIntIfUnset(envSet, "RATE_LIMIT", &flagConfig.Agent.RateLimit, *flagRateLimit)
 	utils.SetStringIfUnset(envSet, "CRYPTO_KEY", &flagConfig.Security.CryptoKey, *flagCryptoKey)
+	utils.SetStringIfUnset(envSet, "SPOOL_DIR", &flagConfig.Agent.Spool.Dir, *flagSpoolDir)
+	utils.SetStringIfUnset(envSet, "COMPRESSION", &flagConfig.Agent.Compression, *flagCompression)
+	utils.SetStringIfUnset(envSet, "STATSD_ADDRESS", &flagConfig.Agent.StatsDAddress, *flagStatsDAddr)
+	utils.SetStringIfUnset(envSet, "PUSH_ADDRESS", &flagConfig.Agent.PushAddress, *flagPushAddr)
+	utils.SetStringIfUnset(envSet, "API_KEY", &flagConfig.Security.APIKey, *flagAPIKey)
+	utils.SetStringIfUnset(envSet, "TLS_CA", &flagConfig.Security.TLSCA, *flagTLSCA)
+	utils.SetStringIfUnset(envSet, "TLS_CERT", &flagConfig.Security.TLSCert, *flagTLSCert)
+	utils.SetStringIfUnset(envSet, "TLS_KEY", &flagConfig.Security.TLSKey, *flagTLSKey)
 
 	finalConfig := config.MergeConfigs(flagConfig, configFromFile)
 
-	if finalConfig.Server.Address != "" && finalConfig.Server.Address[:4] != "http" {
-		finalConfig.Server.Address = "http://" + finalConfig.Server.Address
+	if finalConfig.Server.Address != "" && !strings.HasPrefix(finalConfig.Server.Address, "http") {
+		scheme := "http://"
+		if finalConfig.Security.TLSCA != "" || finalConfig.Security.TLSCert != "" {
+			scheme = "https://"
+		}
+		finalConfig.Server.Address = scheme + finalConfig.Server.Address
 	}
 
 	return finalConfig, nil
@@ -38,6 +38,23 @@ func parseFlags() (*config.Config, error) {
 	var flagAuditURL = flag.String("audit-url", defaultAuditURL, "audit URL")
 	var flagPprofAddr = flag.String("pprof-addr", defaultPprofAddr, "enable pprof on the provided address (empty to disable)")
 	var flagCryptoKey = flag.String("crypto-key", "", "path to private key file for asymmetric decryption")
+	var flagCryptoKeyDir = flag.String("crypto-key-dir", "", "path to directory with private key files (*.pem) for key rotation")
+	var flagTLSCert = flag.String("tls-cert", "", "path to TLS certificate file (enables HTTPS)")
+	var flagTLSKey = flag.String("tls-key", "", "path to TLS private key file")
+	var flagTLSClientCA = flag.String("tls-client-ca", "", "path to CA bundle for verifying client certificates (enables mTLS)")
+	var flagSignatureMaxSkew = flag.Duration("signature-max-skew", 0, "allowed clock skew of signed request timestamps (default 5m)")
+	var flagSignatureLegacy = flag.Bool("signature-legacy", false, "accept unsigned requests and body-only signatures from old agents when a key is set (no replay protection)")
+	var flagAPIKeysFile = flag.String("api-keys-file", "", "path to JSON file with per-agent API keys and scopes (empty to disable)")
+	var flagJWKSFile = flag.String("jwt-jwks-file", "", "path to local JWKS file with keys for verifying bearer JWTs (empty to disable)")
+	var flagJWTIssuer = flag.String("jwt-issuer", "", "expected JWT issuer (iss claim)")
+	var flagJWTAudience = flag.String("jwt-audience", "", "expected JWT audience (aud claim)")
+	var flagMaxBodySize = flag.Int64("max-body-size", 0, "max request body size in bytes after decompression (default 10 MiB)")
+	var flagMaxBatchSize = flag.Int("max-batch-size", 0, "max number of metrics in one /updates/ request (0 for no limit)")
+	var flagClientRateLimit = flag.Float64("client-rate-limit", 0, "requests per second allowed for one client address (0 for no limit)")
+	var flagClientRateBurst = flag.Int("client-rate-burst", 0, "requests one client may send at once above the rate limit (default max(1, rate))")
+	var flagMetricNamePattern = flag.String("metric-name-pattern", "", "regular expression a metric name must fully match (empty to allow any)")
+	var flagMetricNameMaxLength = flag.Int("metric-name-max-length", 0, "max metric name length in bytes (0 for no limit)")
+	var flagMetricNonFinite = flag.String("metric-non-finite", "", "handling of infinite gauge values: reject (default) or clamp; NaN is always rejected")
 	var flagConfigFile = flag.String("c", "", "path to JSON configuration file")
 	var flagConfigFileLong = flag.String("config", "", "path to JSON configuration file")
 
@@ -69,7 +86,8 @@ func parseFlags() (*config.Config, error) {
 		return nil, err
 	}
 
-	flagConfig := &config.Config{}
+	// значения из окружения сохраняются, флаги заполняют только незаданные поля
+	flagConfig := &envConfig
 
 	utils.SetStringIfUnset(envSet, "ADDRESS", &flagConfig.Server.Address, *flagRunAddr)
 	utils.SetStringIfUnset(envSet, "LOGLEVEL", &flagConfig.LogLevel, *flagLogLevel)
@@ -82,6 +100,23 @@ func parseFlags() (*config.Config, error) {
 	utils.SetStringIfUnset(envSet, "AUDIT_URL", &flagConfig.Audit.URL, *flagAuditURL)
 	utils.SetStringIfUnset(envSet, "PPROF_ADDR", &flagConfig.Server.PprofAddr, *flagPprofAddr)
 	utils.SetStringIfUnset(envSet, "CRYPTO_KEY", &flagConfig.Security.CryptoKey, *flagCryptoKey)
+	utils.SetStringIfUnset(envSet, "CRYPTO_KEY_DIR", &flagConfig.Security.CryptoKeyDir, *flagCryptoKeyDir)
+	utils.SetDurationIfUnset(envSet, "SIGNATURE_MAX_SKEW", &flagConfig.Security.SignatureMaxSkew, *flagSignatureMaxSkew)
+	utils.SetBoolIfUnset(envSet, "SIGNATURE_LEGACY", &flagConfig.Security.SignatureLegacy, *flagSignatureLegacy)
+	utils.SetStringIfUnset(envSet, "API_KEYS_FILE", &flagConfig.Security.APIKeysFile, *flagAPIKeysFile)
+	utils.SetStringIfUnset(envSet, "JWT_JWKS_FILE", &flagConfig.Security.JWKSFile, *flagJWKSFile)
+	utils.SetStringIfUnset(envSet, "JWT_ISSUER", &flagConfig.Security.JWTIssuer, *flagJWTIssuer)
+	utils.SetStringIfUnset(envSet, "JWT_AUDIENCE", &flagConfig.Security.JWTAudience, *flagJWTAudience)
+	utils.SetInt64IfUnset(envSet, "MAX_BODY_SIZE", &flagConfig.Server.Limits.MaxBodySize, *flagMaxBodySize)
+	utils.SetIntIfUnset(envSet, "MAX_BATCH_SIZE", &flagConfig.Server.Limits.MaxBatchSize, *flagMaxBatchSize)
+	utils.SetFloat64IfUnset(envSet, "CLIENT_RATE_LIMIT", &flagConfig.Server.Limits.RateLimit, *flagClientRateLimit)
+	utils.SetIntIfUnset(envSet, "CLIENT_RATE_BURST", &flagConfig.Server.Limits.RateBurst, *flagClientRateBurst)
+	utils.SetStringIfUnset(envSet, "METRIC_NAME_PATTERN", &flagConfig.Server.Validation.NamePattern, *flagMetricNamePattern)
+	utils.SetIntIfUnset(envSet, "METRIC_NAME_MAX_LENGTH", &flagConfig.Server.Validation.MaxNameLength, *flagMetricNameMaxLength)
+	utils.SetStringIfUnset(envSet, "METRIC_NON_FINITE", &flagConfig.Server.Validation.NonFinite, *flagMetricNonFinite)
+	utils.SetStringIfUnset(envSet, "TLS_CERT", &flagConfig.Security.TLSCert, *flagTLSCert)
+	utils.SetStringIfUnset(envSet, "TLS_KEY", &flagConfig.Security.TLSKey, *flagTLSKey)
+	utils.SetStringIfUnset(envSet, "TLS_CLIENT_CA", &flagConfig.Security.TLSClientCA, *flagTLSClientCA)
 
 	finalConfig := config.MergeConfigs(flagConfig, configFromFile)
 
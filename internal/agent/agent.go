@@ -2,13 +2,17 @@ package agent
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/Himany/go-musthave-metrics-tpl/internal/auth"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/compress"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/crypto"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/retry"
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
 )
@@ -17,52 +21,154 @@ import (
 type Agent struct {
 	URL            string
 	ReportInterval int
-	PollInterval   int
 	Client         *resty.Client
-	PollCount      int64
 	Metrics        map[string]float64
+	Counters       map[string]int64 // приращения counter, ещё не доставленные на сервер
 	mutex          sync.Mutex
 	Key            string
 	RateLimit      int
+	MaxBatchSize   int // наибольшее число метрик в одном запросе, 0 — без ограничения
 	Tasks          chan []models.Metrics
-	Encryptor      *crypto.RSAEncryptor
+	Encryptor      crypto.Encryptor
+	Codec          compress.Codec
+	RetryPolicy    retry.Policy
+	Breaker        *circuitBreaker
+	Spool          *spool
+
+	changes    *changeFilter // nil, если отправляются все gauge
+	identity   *identity     // nil, если идентификатор агента не добавляется
+	collectors []collectorRunner
 
 	// Поля для graceful shutdown
 	wg     sync.WaitGroup
 	ctx    context.Context
 	cancel context.CancelFunc
+	// sendCtx прерывает повторы отправки. Он отменяется не вместе с ctx, а через
+	// stopTimeout после начала остановки, чтобы последние пакеты отправлялись с повторами.
+	sendCtx    context.Context
+	sendCancel context.CancelFunc
 }
 
+// stopTimeout ограничивает время отправки оставшихся метрик при остановке агента.
+const stopTimeout = 30 * time.Second
+
 func CreateAgent(cfg *config.Config) (*Agent, error) {
-	encryptor, err := crypto.NewRSAEncryptorFromPublicKey(cfg.Security.CryptoKey)
+	encryptor, err := crypto.NewEncryptor(cfg.Security.CryptoKey)
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := compress.Lookup(cfg.Agent.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newHTTPClient(cfg.Security)
+	if err != nil {
+		return nil, err
+	}
+
+	collectors, err := createCollectors(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var sp *spool
+	if cfg.Agent.Spool.Dir != "" {
+		sp, err = newSpool(cfg.Agent.Spool.Dir, cfg.Agent.Spool.MaxBatches, cfg.Agent.Spool.MaxBytes, cfg.Agent.Spool.MaxAge, cfg.Agent.MaxBatchSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ident, err := newIdentity(cfg.Agent.Instance)
 	if err != nil {
 		return nil, err
 	}
 
+	var changes *changeFilter
+	if cfg.Agent.Changes.Enabled {
+		changes = newChangeFilter(cfg.Agent.Changes.AbsoluteThreshold, cfg.Agent.Changes.RelativeThreshold,
+			cfg.Agent.Changes.ResyncInterval, realClock{})
+	}
+
+	// без порога выключатель отключён
+	var threshold int
+	if cfg.Agent.Breaker.Threshold != nil {
+		threshold = *cfg.Agent.Breaker.Threshold
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
+	sendCtx, sendCancel := context.WithCancel(context.Background())
 
 	return &Agent{
 		URL:            cfg.Server.Address,
 		ReportInterval: cfg.Agent.ReportInterval,
-		PollInterval:   cfg.Agent.PollInterval,
-		Client:         resty.New(),
-		PollCount:      0,
+		Client:         client,
 		Metrics:        make(map[string]float64),
+		Counters:       make(map[string]int64),
 		Key:            cfg.Security.Key,
 		RateLimit:      cfg.Agent.RateLimit,
+		MaxBatchSize:   cfg.Agent.MaxBatchSize,
 		Tasks:          make(chan []models.Metrics, cfg.Agent.RateLimit*2),
 		Encryptor:      encryptor,
+		Codec:          codec,
+		RetryPolicy:    cfg.Agent.Retry.Policy(retry.DefaultPolicy()),
+		Breaker:        newCircuitBreaker(threshold, cfg.Agent.Breaker.OpenTimeout, realClock{}),
+		Spool:          sp,
+		changes:        changes,
+		identity:       ident,
+		collectors:     collectors,
 		ctx:            ctx,
 		cancel:         cancel,
+		sendCtx:        sendCtx,
+		sendCancel:     sendCancel,
 	}, nil
 }
 
+// newHTTPClient создаёт HTTP-клиент агента. Если задан ключ API, он передаётся в каждом
+// запросе. Если задан CA или клиентский сертификат, соединение с сервером проверяется
+// по настройкам TLS агента.
+func newHTTPClient(cfg config.SecurityConfig) (*resty.Client, error) {
+	client := resty.New()
+	if cfg.APIKey != "" {
+		client.SetHeader(auth.HeaderAPIKey, cfg.APIKey)
+	}
+	if cfg.TLSCA == "" && cfg.TLSCert == "" {
+		return client, nil
+	}
+
+	var certs *crypto.CertReloader
+	if cfg.TLSCert != "" {
+		var err error
+		if certs, err = crypto.NewCertReloader(cfg.TLSCert, cfg.TLSKey); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConfig, err := crypto.ClientTLSConfig(cfg.TLSCA, certs)
+	if err != nil {
+		return nil, err
+	}
+	return client.SetTLSClientConfig(tlsConfig), nil
+}
+
 func (a *Agent) Start() error {
 	a.CreateWorkers()
 
-	a.wg.Add(3)
-	go a.collector()
-	go a.collectorAdv()
+	for _, r := range a.collectors {
+		if l, ok := r.listener(); ok {
+			if err := l.Start(a.ctx); err != nil {
+				a.cancel()
+				return fmt.Errorf("failed to start collector %s: %w", r.name, err)
+			}
+			continue
+		}
+		a.wg.Add(1)
+		go a.runCollector(r)
+	}
+
+	a.wg.Add(1)
 	go a.reportHandler()
 
 	return nil
@@ -72,6 +178,11 @@ func (a *Agent) Stop() {
 	logger.Log.Info("Stopping agent...")
 
 	a.cancel()
+	timer := time.AfterFunc(stopTimeout, a.sendCancel)
+	defer func() {
+		timer.Stop()
+		a.sendCancel()
+	}()
 
 	done := make(chan struct{})
 	go func() {
@@ -94,16 +205,36 @@ func (a *Agent) Stop() {
 func (a *Agent) sendFinalMetrics() {
 	logger.Log.Info("Sending final metrics...")
 
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
-
-	if len(a.Metrics) == 0 && a.PollCount == 0 {
+	a.collectListeners()
+	batch := a.takeBatch()
+	if len(batch) == 0 {
 		logger.Log.Info("No metrics to send")
 		return
 	}
 
-	var batch []models.Metrics
+	if err := a.deliverBatch(batch); err != nil {
+		logger.Log.Error("Failed to send final metrics", zap.Error(err))
+	} else {
+		logger.Log.Info("Final metrics sent successfully", zap.Int("count", len(batch)))
+	}
+}
+
+// takeBatch формирует пакет из текущих значений gauge и накопленных приращений counter.
+// Приращения изымаются из агента и возвращаются в него, если пакет не будет доставлен,
+// поэтому каждое приращение отправляется на сервер ровно один раз.
+// При отправке только изменений в пакет попадают gauge, изменившиеся больше порога,
+// и все gauge при периодической полной синхронизации.
+func (a *Agent) takeBatch() []models.Metrics {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	full := a.changes == nil || a.changes.startBatch()
+
+	batch := make([]models.Metrics, 0, len(a.Metrics)+len(a.Counters))
 	for key, value := range a.Metrics {
+		if a.changes != nil && !a.changes.changed(key, value, full) {
+			continue
+		}
 		val := value
 		batch = append(batch, models.Metrics{
 			ID:    key,
@@ -112,20 +243,35 @@ func (a *Agent) sendFinalMetrics() {
 		})
 	}
 
-	if a.PollCount > 0 {
+	for key, delta := range a.Counters {
+		if delta == 0 {
+			continue
+		}
+		d := delta
 		batch = append(batch, models.Metrics{
-			ID:    "PollCount",
+			ID:    key,
 			MType: "counter",
-			Delta: &a.PollCount,
+			Delta: &d,
 		})
+		delete(a.Counters, key)
 	}
 
-	if len(batch) > 0 {
-		err := a.createBatchRequest(batch)
-		if err != nil {
-			logger.Log.Error("Failed to send final metrics", zap.Error(err))
-		} else {
-			logger.Log.Info("Final metrics sent successfully", zap.Int("count", len(batch)))
+	return batch
+}
+
+// restoreBatch возвращает приращения counter из недоставленного пакета, чтобы они были
+// отправлены в следующем пакете. Gauge из такого пакета будут отправлены повторно,
+// даже если их значения не изменятся.
+func (a *Agent) restoreBatch(batch []models.Metrics) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, m := range batch {
+		switch {
+		case m.MType == "counter" && m.Delta != nil:
+			a.Counters[m.ID] += *m.Delta
+		case m.MType == "gauge" && a.changes != nil:
+			a.changes.forget(m.ID)
 		}
 	}
 }
@@ -0,0 +1,304 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/compress"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/retry"
+)
+
+// counterServer принимает пакеты и суммирует приращения counter так же, как сервер метрик.
+type counterServer struct {
+	mu       sync.Mutex
+	fail     bool
+	maxBatch int // пакеты больше maxBatch метрик отклоняются с кодом 413
+	requests int
+	counters map[string]int64
+}
+
+func (s *counterServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	codec, err := compress.Lookup(r.Header.Get("Content-Encoding"))
+	if err != nil {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	zr, err := codec.NewReader(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var batch []models.Metrics
+	if err := json.NewDecoder(zr).Decode(&batch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if s.maxBatch > 0 && len(batch) > s.maxBatch {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	s.requests++
+
+	for _, m := range batch {
+		if m.MType == "counter" && m.Delta != nil {
+			s.counters[m.ID] += *m.Delta
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *counterServer) setFail(fail bool) {
+	s.mu.Lock()
+	s.fail = fail
+	s.mu.Unlock()
+}
+
+func newTestAgent(t *testing.T, url string) *Agent {
+	t.Helper()
+
+	cfg := &config.Config{}
+	config.SetDefaultsForAgent(cfg)
+	cfg.Server.Address = url
+	cfg.Agent.RateLimit = 1
+
+	a, err := CreateAgent(cfg)
+	require.NoError(t, err)
+	a.RetryPolicy = retry.Policy{MaxAttempts: 1}
+	t.Cleanup(a.cancel)
+	t.Cleanup(a.sendCancel)
+	return a
+}
+
+func TestAgent_CounterDeltas(t *testing.T) {
+	srv := &counterServer{counters: make(map[string]int64)}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	a := newTestAgent(t, ts.URL)
+
+	poll := func(n int) {
+		a.mutex.Lock()
+		a.Counters["PollCount"] += int64(n)
+		a.mutex.Unlock()
+	}
+
+	// доставленные приращения не отправляются повторно
+	poll(3)
+	require.NoError(t, a.deliverBatch(a.takeBatch()))
+	poll(2)
+	require.NoError(t, a.deliverBatch(a.takeBatch()))
+	assert.Equal(t, int64(5), srv.counters["PollCount"])
+
+	// недоставленные приращения переносятся в следующий пакет
+	srv.setFail(true)
+	poll(4)
+	assert.Error(t, a.deliverBatch(a.takeBatch()))
+	assert.Equal(t, int64(4), a.Counters["PollCount"])
+
+	srv.setFail(false)
+	poll(1)
+	require.NoError(t, a.deliverBatch(a.takeBatch()))
+	assert.Equal(t, int64(10), srv.counters["PollCount"])
+	assert.Empty(t, a.Counters)
+}
+
+func TestAgent_BatchSize(t *testing.T) {
+	srv := &counterServer{counters: make(map[string]int64), maxBatch: 2}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	a := newTestAgent(t, ts.URL)
+	fill := func() {
+		for _, id := range []string{"a", "b", "c", "d", "e"} {
+			a.Counters[id] = 1
+		}
+	}
+
+	// пакет, отклонённый с кодом 413, делится на части и доставляется целиком
+	fill()
+	require.NoError(t, a.deliverBatch(a.takeBatch()))
+	assert.Equal(t, map[string]int64{"a": 1, "b": 1, "c": 1, "d": 1, "e": 1}, srv.counters)
+	assert.Empty(t, a.Counters)
+
+	// с ограничением агента пакет сразу отправляется частями
+	srv.requests = 0
+	a.MaxBatchSize = 2
+	fill()
+	require.NoError(t, a.deliverBatch(a.takeBatch()))
+	assert.Equal(t, 3, srv.requests)
+	assert.Equal(t, int64(2), srv.counters["e"])
+}
+
+func TestAgent_SpoolLargerThanServerLimit(t *testing.T) {
+	srv := &counterServer{counters: make(map[string]int64), maxBatch: 2}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	a := newTestAgent(t, ts.URL)
+	sp, err := newSpool(t.TempDir(), 0, 0, 0, 0)
+	require.NoError(t, err)
+	a.Spool = sp
+
+	// очередь, накопленная за время недоступности сервера, сама больше лимита сервера
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, sp.store([]models.Metrics{newCounter(id, 1)}))
+	}
+
+	a.Counters["PollCount"] = 1
+	require.NoError(t, a.deliverBatch(a.takeBatch()))
+	assert.Equal(t, map[string]int64{"a": 1, "b": 1, "c": 1, "d": 1, "e": 1, "PollCount": 1}, srv.counters)
+	assert.EqualValues(t, 0, sp.pending.Load())
+	assert.Empty(t, a.Counters)
+}
+
+func TestAgent_QueueBatchOnShutdown(t *testing.T) {
+	a := newTestAgent(t, "http://localhost:0")
+
+	// очередь воркеров заполнена, а агент останавливается
+	for len(a.Tasks) < cap(a.Tasks) {
+		a.Tasks <- nil
+	}
+	a.Counters["PollCount"] = 3
+	batch := a.takeBatch()
+	require.Empty(t, a.Counters)
+
+	a.cancel()
+	assert.False(t, a.queueBatch(batch))
+	assert.Equal(t, int64(3), a.Counters["PollCount"])
+}
+
+func TestAgent_FinalMetricsRetried(t *testing.T) {
+	srv := &counterServer{counters: make(map[string]int64)}
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	a := newTestAgent(t, ts.URL)
+	a.RetryPolicy = retry.Policy{MaxAttempts: 2, InitialInterval: 10 * time.Millisecond}
+	a.Counters["PollCount"] = 3
+
+	// последняя отправка выполняется после отмены a.ctx и всё равно повторяется
+	a.cancel()
+	a.sendFinalMetrics()
+	assert.Equal(t, int64(2), requests.Load())
+	assert.Equal(t, int64(3), srv.counters["PollCount"])
+	assert.Empty(t, a.Counters)
+}
+
+func TestAgent_Compression(t *testing.T) {
+	for _, name := range []string{compress.Gzip, compress.Zstd, compress.Snappy} {
+		t.Run(name, func(t *testing.T) {
+			srv := &counterServer{counters: make(map[string]int64)}
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+
+			a := newTestAgent(t, ts.URL)
+			codec, err := compress.Lookup(name)
+			require.NoError(t, err)
+			a.Codec = codec
+
+			a.Counters["PollCount"] = 3
+			require.NoError(t, a.deliverBatch(a.takeBatch()))
+			assert.Equal(t, int64(3), srv.counters["PollCount"])
+		})
+	}
+}
+
+type staticCollector []models.Metrics
+
+func (c staticCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	return c, nil
+}
+
+func TestCreateCollectors(t *testing.T) {
+	RegisterCollector("test_static", func(cfg *config.Config) (Collector, error) {
+		return staticCollector{newGauge("Static", 1)}, nil
+	}, false)
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "test_static")
+		registryMu.Unlock()
+	})
+
+	enabled := true
+	disabled := false
+
+	testCases := []struct {
+		name     string
+		enabled  []string
+		settings map[string]config.CollectorConfig
+		expected []string
+		interval time.Duration
+	}{
+		{name: "defaults", expected: []string{"gopsutil", "runtime"}, interval: 2 * time.Second},
+		{name: "env_list", enabled: []string{"test_static"}, expected: []string{"test_static"}, interval: 2 * time.Second},
+		{
+			name: "file_settings",
+			settings: map[string]config.CollectorConfig{
+				"gopsutil":    {Enabled: &disabled},
+				"test_static": {Enabled: &enabled, PollInterval: 500 * time.Millisecond},
+			},
+			expected: []string{"runtime", "test_static"},
+			interval: 500 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			config.SetDefaultsForAgent(cfg)
+			cfg.Agent.EnabledCollectors = tc.enabled
+			cfg.Agent.Collectors = tc.settings
+			// каталог без cgroup.controllers: коллектор cgroup не зависит от окружения теста
+			cfg.Agent.CgroupPath = t.TempDir()
+
+			runners, err := createCollectors(cfg)
+			require.NoError(t, err)
+
+			var names []string
+			for _, r := range runners {
+				names = append(names, r.name)
+			}
+			assert.Equal(t, tc.expected, names)
+			assert.Equal(t, tc.interval, runners[len(runners)-1].interval)
+		})
+	}
+
+	cfg := &config.Config{}
+	config.SetDefaultsForAgent(cfg)
+	cfg.Agent.EnabledCollectors = []string{"runtime", "gopsutill"}
+	_, err := createCollectors(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"gopsutill"`)
+	assert.Contains(t, err.Error(), "gopsutil, ")
+
+	cfg.Agent.EnabledCollectors = nil
+	cfg.Agent.Collectors = map[string]config.CollectorConfig{"prometeus": {}}
+	_, err = createCollectors(cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen возвращается, когда отправка запрещена разомкнутым автоматическим выключателем.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// breakerState описывает состояние автоматического выключателя.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// clock абстрагирует текущее время, чтобы выключатель можно было тестировать детерминированно.
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// circuitBreaker размыкается после threshold последовательных неудач, пока разомкнут —
+// сразу отклоняет запросы, а по истечении openTimeout пропускает один пробный запрос.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	state       breakerState
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	threshold   int
+	openTimeout time.Duration
+	clock       clock
+}
+
+func newCircuitBreaker(threshold int, openTimeout time.Duration, c clock) *circuitBreaker {
+	if c == nil {
+		c = realClock{}
+	}
+	return &circuitBreaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		clock:       c,
+	}
+}
+
+// Allow сообщает, можно ли выполнить запрос. Выключатель с threshold <= 0 отключён.
+func (b *circuitBreaker) Allow() error {
+	if b == nil || b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Success фиксирует успешный запрос и замыкает выключатель.
+func (b *circuitBreaker) Success() {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != breakerClosed {
+		b.setState(breakerClosed)
+	}
+}
+
+// Failure фиксирует неудачный запрос и при необходимости размыкает выключатель.
+func (b *circuitBreaker) Failure() {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+
+	switch b.state {
+	case breakerHalfOpen:
+		b.open()
+	case breakerClosed:
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	}
+}
+
+// State возвращает текущее состояние выключателя.
+func (b *circuitBreaker) State() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *circuitBreaker) open() {
+	b.openedAt = b.clock.Now()
+	b.setState(breakerOpen)
+}
+
+func (b *circuitBreaker) setState(state breakerState) {
+	logger.Log.Warn("circuit breaker state changed",
+		zap.String("from", b.state.String()),
+		zap.String("to", state.String()),
+		zap.Int("failures", b.failures),
+	)
+	b.state = state
+}
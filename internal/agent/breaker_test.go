@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	clk := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := newCircuitBreaker(3, 10*time.Second, clk)
+
+	// две неудачи подряд не размыкают выключатель
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, b.Allow())
+		b.Failure()
+	}
+	assert.Equal(t, breakerClosed, b.State())
+
+	// успех сбрасывает счётчик последовательных неудач
+	assert.NoError(t, b.Allow())
+	b.Success()
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, b.Allow())
+		b.Failure()
+	}
+	assert.Equal(t, breakerClosed, b.State())
+
+	// третья неудача подряд размыкает выключатель
+	assert.NoError(t, b.Allow())
+	b.Failure()
+	assert.Equal(t, breakerOpen, b.State())
+
+	// пока не истёк таймаут, запросы отклоняются сразу
+	clk.Advance(9 * time.Second)
+	assert.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	// по истечении таймаута пропускается только один пробный запрос
+	clk.Advance(time.Second)
+	assert.NoError(t, b.Allow())
+	assert.Equal(t, breakerHalfOpen, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	// неудачная проба снова размыкает выключатель и перезапускает таймаут
+	b.Failure()
+	assert.Equal(t, breakerOpen, b.State())
+	clk.Advance(5 * time.Second)
+	assert.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	// успешная проба замыкает выключатель
+	clk.Advance(5 * time.Second)
+	assert.NoError(t, b.Allow())
+	b.Success()
+	assert.Equal(t, breakerClosed, b.State())
+	assert.NoError(t, b.Allow())
+	assert.NoError(t, b.Allow())
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	clk := &fakeClock{now: time.Now()}
+	b := newCircuitBreaker(0, time.Second, clk)
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, b.Allow())
+		b.Failure()
+	}
+	assert.Equal(t, breakerClosed, b.State())
+}
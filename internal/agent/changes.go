@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"math"
+	"time"
+)
+
+// changeFilter отбирает gauge, значения которых изменились с последней отправки больше
+// заданных порогов. Изменение должно превышать каждый заданный порог: абсолютный — по
+// модулю разницы, относительный — по отношению разницы к отправленному значению.
+// Раз в resyncInterval отправляются все gauge, чтобы сервер не расходился с агентом.
+// Методы вызываются под мьютексом агента.
+type changeFilter struct {
+	absolute       float64
+	relative       float64
+	resyncInterval time.Duration
+	clock          clock
+
+	sent       map[string]float64
+	lastResync time.Time
+}
+
+func newChangeFilter(absolute, relative float64, resyncInterval time.Duration, c clock) *changeFilter {
+	if c == nil {
+		c = realClock{}
+	}
+	return &changeFilter{
+		absolute:       absolute,
+		relative:       relative,
+		resyncInterval: resyncInterval,
+		clock:          c,
+		sent:           make(map[string]float64),
+	}
+}
+
+// startBatch начинает формирование пакета и сообщает, нужно ли отправить все gauge.
+func (f *changeFilter) startBatch() bool {
+	now := f.clock.Now()
+	if f.lastResync.IsZero() || (f.resyncInterval > 0 && now.Sub(f.lastResync) >= f.resyncInterval) {
+		f.lastResync = now
+		return true
+	}
+	return false
+}
+
+// changed сообщает, нужно ли отправить gauge, и запоминает отправляемое значение.
+func (f *changeFilter) changed(id string, value float64, full bool) bool {
+	prev, ok := f.sent[id]
+	if full || !ok || f.exceeds(prev, value) {
+		f.sent[id] = value
+		return true
+	}
+	return false
+}
+
+func (f *changeFilter) exceeds(prev, value float64) bool {
+	diff := math.Abs(value - prev)
+	if diff == 0 {
+		return false
+	}
+	if f.absolute > 0 && diff <= f.absolute {
+		return false
+	}
+	if f.relative > 0 && prev != 0 && diff/math.Abs(prev) <= f.relative {
+		return false
+	}
+	return true
+}
+
+// forget сбрасывает отправленное значение gauge, если пакет не был доставлен,
+// чтобы gauge был отправлен в следующем пакете независимо от изменения.
+func (f *changeFilter) forget(id string) {
+	delete(f.sent, id)
+}
@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeFilter_Thresholds(t *testing.T) {
+	testCases := []struct {
+		name     string
+		absolute float64
+		relative float64
+		prev     float64
+		value    float64
+		expected bool
+	}{
+		{name: "no_thresholds_same", prev: 10, value: 10, expected: false},
+		{name: "no_thresholds_changed", prev: 10, value: 10.001, expected: true},
+		{name: "below_absolute", absolute: 1, prev: 10, value: 10.5, expected: false},
+		{name: "above_absolute", absolute: 1, prev: 10, value: 11.5, expected: true},
+		{name: "below_relative", relative: 0.1, prev: 100, value: 105, expected: false},
+		{name: "above_relative", relative: 0.1, prev: 100, value: 89, expected: true},
+		{name: "relative_from_zero", relative: 0.1, prev: 0, value: 0.01, expected: true},
+		{name: "both_must_be_exceeded", absolute: 10, relative: 0.01, prev: 100, value: 105, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newChangeFilter(tc.absolute, tc.relative, 0, nil)
+			require.True(t, f.changed("G", tc.prev, false))
+			assert.Equal(t, tc.expected, f.changed("G", tc.value, false))
+		})
+	}
+}
+
+func TestAgent_ChangeOnlyReporting(t *testing.T) {
+	srv := &counterServer{counters: make(map[string]int64)}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	clk := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	a := newTestAgent(t, ts.URL)
+	a.changes = newChangeFilter(1, 0, time.Minute, clk)
+
+	a.Metrics["Idle"] = 5
+	a.Metrics["Busy"] = 10
+
+	ids := func() []string {
+		batch := a.takeBatch()
+		var ids []string
+		for _, m := range batch {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+
+	// первый пакет содержит все gauge
+	assert.ElementsMatch(t, []string{"Idle", "Busy"}, ids())
+
+	// изменения в пределах порога не отправляются
+	a.Metrics["Idle"] = 5.5
+	a.Metrics["Busy"] = 20
+	clk.Advance(10 * time.Second)
+	assert.Equal(t, []string{"Busy"}, ids())
+
+	clk.Advance(10 * time.Second)
+	assert.Empty(t, ids())
+
+	// недоставленные gauge отправляются повторно
+	srv.setFail(true)
+	a.Metrics["Busy"] = 30
+	batch := a.takeBatch()
+	require.Len(t, batch, 1)
+	assert.Error(t, a.deliverBatch(batch))
+	srv.setFail(false)
+	assert.Equal(t, []string{"Busy"}, ids())
+
+	// полная синхронизация по истечении интервала
+	clk.Advance(time.Minute)
+	assert.ElementsMatch(t, []string{"Idle", "Busy"}, ids())
+}
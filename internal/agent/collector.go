@@ -1,16 +1,160 @@
 package agent
 
 import (
-	"math/rand/v2"
-	"runtime"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"go.uber.org/zap"
+)
+
+// Collector собирает метрики при каждом вызове Collect.
+// Gauge возвращаются с текущим значением, counter — с приращением с момента предыдущего вызова.
+type Collector interface {
+	Collect(ctx context.Context) ([]models.Metrics, error)
+}
+
+// Listener — коллектор, принимающий метрики от внешних источников. Start запускает приём
+// до отмены ctx, а Collect вызывается перед каждой отправкой на сервер, поэтому принятые
+// значения агрегируются между отправками.
+type Listener interface {
+	Collector
+	Start(ctx context.Context) error
+}
+
+// Expirer — коллектор-слушатель, источники которого могут перестать присылать gauge.
+// Expired возвращает gauge, устаревшие при последнем вызове Collect, и агент удаляет их
+// последние значения, чтобы не отправлять их бесконечно.
+type Expirer interface {
+	Expired() []string
+}
+
+// CollectorFactory создаёт коллектор по конфигурации агента. Фабрика возвращает nil,
+// если в конфигурации нет данных для сбора.
+type CollectorFactory func(cfg *config.Config) (Collector, error)
+
+type collectorRegistration struct {
+	factory          CollectorFactory
+	enabledByDefault bool
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]collectorRegistration)
 )
 
-func (a *Agent) collector() {
+// RegisterCollector регистрирует коллектор под именем name. Коллектор включается, если он
+// указан в настройках агента, либо по умолчанию, если enabledByDefault равен true.
+func RegisterCollector(name string, factory CollectorFactory, enabledByDefault bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[name] = collectorRegistration{
+		factory:          factory,
+		enabledByDefault: enabledByDefault,
+	}
+}
+
+// collectorRunner хранит созданный коллектор и интервал его опроса.
+// Для Listener интервал не используется.
+type collectorRunner struct {
+	name      string
+	collector Collector
+	interval  time.Duration
+}
+
+// listener возвращает коллектор как Listener, если он принимает метрики извне.
+func (r collectorRunner) listener() (Listener, bool) {
+	l, ok := r.collector.(Listener)
+	return l, ok
+}
+
+// createCollectors создаёт включённые в конфигурации коллекторы. Неизвестное имя
+// коллектора в списке COLLECTORS или в настройках из файла считается ошибкой.
+func createCollectors(cfg *config.Config) ([]collectorRunner, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	configured := slices.Clone(cfg.Agent.EnabledCollectors)
+	for name := range cfg.Agent.Collectors {
+		configured = append(configured, name)
+	}
+	for _, name := range configured {
+		if _, ok := registry[name]; !ok {
+			return nil, fmt.Errorf("unknown collector %q, available: %s", name, strings.Join(names, ", "))
+		}
+	}
+
+	var runners []collectorRunner
+	for _, name := range names {
+		reg := registry[name]
+		if !collectorEnabled(cfg, name, reg.enabledByDefault) {
+			continue
+		}
+
+		c, err := reg.factory(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create collector %s: %w", name, err)
+		}
+		if c == nil {
+			continue
+		}
+		if _, ok := c.(Listener); ok {
+			runners = append(runners, collectorRunner{name: name, collector: c})
+			continue
+		}
+
+		interval := time.Duration(cfg.Agent.PollInterval) * time.Second
+		if cc, ok := cfg.Agent.Collectors[name]; ok && cc.PollInterval > 0 {
+			interval = cc.PollInterval
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("collector %s: poll interval must be positive", name)
+		}
+
+		runners = append(runners, collectorRunner{name: name, collector: c, interval: interval})
+	}
+
+	return runners, nil
+}
+
+// collectorEnabled определяет, включён ли коллектор: список COLLECTORS имеет приоритет
+// над флагом enabled из файла конфигурации, который имеет приоритет над значением по умолчанию.
+func collectorEnabled(cfg *config.Config, name string, enabledByDefault bool) bool {
+	if len(cfg.Agent.EnabledCollectors) > 0 {
+		for _, enabled := range cfg.Agent.EnabledCollectors {
+			if enabled == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	if cc, ok := cfg.Agent.Collectors[name]; ok && cc.Enabled != nil {
+		return *cc.Enabled
+	}
+
+	return enabledByDefault
+}
+
+// runCollector периодически опрашивает коллектор до остановки агента.
+func (a *Agent) runCollector(r collectorRunner) {
 	defer a.wg.Done()
 
-	var s runtime.MemStats
-	ticker := time.NewTicker(time.Duration(a.PollInterval) * time.Second)
+	ticker := time.NewTicker(r.interval)
 	defer ticker.Stop()
 
 	for {
@@ -18,40 +162,82 @@ func (a *Agent) collector() {
 		case <-a.ctx.Done():
 			return
 		case <-ticker.C:
-			runtime.ReadMemStats(&s)
-
-			a.mutex.Lock()
-			a.Metrics["Alloc"] = float64(s.Alloc)
-			a.Metrics["BuckHashSys"] = float64(s.BuckHashSys)
-			a.Metrics["GCCPUFraction"] = s.GCCPUFraction
-			a.Metrics["HeapAlloc"] = float64(s.HeapAlloc)
-			a.Metrics["HeapIdle"] = float64(s.HeapIdle)
-			a.Metrics["HeapInuse"] = float64(s.HeapInuse)
-			a.Metrics["HeapObjects"] = float64(s.HeapObjects)
-			a.Metrics["HeapReleased"] = float64(s.HeapReleased)
-			a.Metrics["HeapSys"] = float64(s.HeapSys)
-			a.Metrics["LastGC"] = float64(s.LastGC)
-			a.Metrics["Lookups"] = float64(s.Lookups)
-			a.Metrics["MCacheInuse"] = float64(s.MCacheInuse)
-			a.Metrics["MCacheSys"] = float64(s.MCacheSys)
-			a.Metrics["MSpanInuse"] = float64(s.MSpanInuse)
-			a.Metrics["MSpanSys"] = float64(s.MSpanSys)
-			a.Metrics["Mallocs"] = float64(s.Mallocs)
-			a.Metrics["NextGC"] = float64(s.NextGC)
-			a.Metrics["NumForcedGC"] = float64(s.NumForcedGC)
-			a.Metrics["NumGC"] = float64(s.NumGC)
-			a.Metrics["OtherSys"] = float64(s.OtherSys)
-			a.Metrics["PauseTotalNs"] = float64(s.PauseTotalNs)
-			a.Metrics["StackInuse"] = float64(s.StackInuse)
-			a.Metrics["StackSys"] = float64(s.StackSys)
-			a.Metrics["Sys"] = float64(s.Sys)
-			a.Metrics["TotalAlloc"] = float64(s.TotalAlloc)
-			a.Metrics["Frees"] = float64(s.Frees)
-			a.Metrics["GCSys"] = float64(s.GCSys)
-			a.Metrics["RandomValue"] = rand.Float64()
-
-			a.PollCount++
-			a.mutex.Unlock()
+			metrics, err := r.collector.Collect(a.ctx)
+			if err != nil {
+				logger.Log.Warn("collector failed", zap.String("collector", r.name), zap.Error(err))
+			}
+			a.applyMetrics(metrics)
 		}
 	}
 }
+
+// collectListeners забирает метрики, накопленные коллекторами-слушателями с предыдущей отправки.
+func (a *Agent) collectListeners() {
+	for _, r := range a.collectors {
+		l, ok := r.listener()
+		if !ok {
+			continue
+		}
+		metrics, err := l.Collect(a.ctx)
+		if err != nil {
+			logger.Log.Warn("collector failed", zap.String("collector", r.name), zap.Error(err))
+		}
+		a.applyMetrics(metrics)
+		if e, ok := l.(Expirer); ok {
+			a.removeGauges(e.Expired())
+		}
+	}
+}
+
+// removeGauges удаляет gauge, о которых коллектор больше не сообщает.
+func (a *Agent) removeGauges(ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, id := range ids {
+		key := a.identity.apply(id)
+		delete(a.Metrics, key)
+		if a.changes != nil {
+			a.changes.forget(key)
+		}
+	}
+}
+
+// applyMetrics сохраняет собранные метрики под именами с идентификатором агента:
+// gauge перезаписываются, приращения counter суммируются.
+func (a *Agent) applyMetrics(metrics []models.Metrics) {
+	if len(metrics) == 0 {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, m := range metrics {
+		id := a.identity.apply(m.ID)
+		switch m.MType {
+		case "gauge":
+			if m.Value != nil {
+				a.Metrics[id] = *m.Value
+			}
+		case "counter":
+			if m.Delta != nil {
+				a.Counters[id] += *m.Delta
+			}
+		}
+	}
+}
+
+// newGauge создаёт gauge-метрику.
+func newGauge(id string, value float64) models.Metrics {
+	return models.Metrics{ID: id, MType: "gauge", Value: &value}
+}
+
+// newCounter создаёт counter-метрику с приращением delta.
+func newCounter(id string, delta int64) models.Metrics {
+	return models.Metrics{ID: id, MType: "counter", Delta: &delta}
+}
@@ -1,33 +1,219 @@
 package agent
 
 import (
-	"time"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"github.com/shirou/gopsutil/v4/common"
 	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/load"
 	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/shirou/gopsutil/v4/net"
 )
 
-func (a *Agent) collectorAdv() {
-	defer a.wg.Done()
-
-	ticker := time.NewTicker(time.Duration(a.PollInterval) * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-a.ctx.Done():
-			return
-		case <-ticker.C:
-			vmStat, _ := mem.VirtualMemory()
-			cpuPercents, _ := cpu.Percent(0, false)
-
-			a.mutex.Lock()
-			a.Metrics["TotalMemory"] = float64(vmStat.Total)
-			a.Metrics["FreeMemory"] = float64(vmStat.Free)
-			if len(cpuPercents) > 0 {
-				a.Metrics["CPUutilization1"] = cpuPercents[0]
+func init() {
+	RegisterCollector("gopsutil", newSystemCollector, true)
+}
+
+// pseudoFilesystems — файловые системы, заполнение которых не отражает дисков хоста:
+// слои контейнеров, файловые системы в памяти и образы только для чтения.
+var pseudoFilesystems = map[string]bool{
+	"overlay":  true,
+	"tmpfs":    true,
+	"devtmpfs": true,
+	"ramfs":    true,
+	"squashfs": true,
+	"autofs":   true,
+	"nsfs":     true,
+}
+
+// systemCollector собирает системные метрики через gopsutil: память и swap, загрузку
+// каждого ядра процессора, средние значения нагрузки, заполнение и ввод-вывод дисков,
+// сетевой трафик интерфейсов.
+type systemCollector struct {
+	// procRoot задаёт альтернативный корень /proc, пустое значение — системный /proc.
+	// Точки монтирования из procRoot/1/mountinfo относятся к корню процесса 1, поэтому
+	// заполнение дисков определяется через procRoot/1/root.
+	procRoot string
+
+	prevCPU  []cpu.TimesStat
+	counters deltaTracker
+}
+
+func newSystemCollector(cfg *config.Config) (Collector, error) {
+	// gopsutil сам читает HOST_PROC, но заполнение дисков он определяет по путям
+	// точек монтирования без учёта этой переменной
+	return &systemCollector{procRoot: os.Getenv("HOST_PROC"), counters: make(deltaTracker)}, nil
+}
+
+func (c *systemCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	if c.procRoot != "" {
+		ctx = context.WithValue(ctx, common.EnvKey, common.EnvMap{common.HostProcEnvKey: c.procRoot})
+	}
+
+	var metrics []models.Metrics
+	var errs []error
+
+	for _, collect := range []func(context.Context) ([]models.Metrics, error){
+		c.collectMemory,
+		c.collectCPU,
+		c.collectLoad,
+		c.collectDisks,
+		c.collectNetwork,
+	} {
+		m, err := collect(ctx)
+		metrics = append(metrics, m...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+func (c *systemCollector) collectMemory(ctx context.Context) ([]models.Metrics, error) {
+	vmStat, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := []models.Metrics{
+		newGauge("TotalMemory", float64(vmStat.Total)),
+		newGauge("FreeMemory", float64(vmStat.Free)),
+		newGauge("SwapTotal", float64(vmStat.SwapTotal)),
+		newGauge("SwapFree", float64(vmStat.SwapFree)),
+	}
+	if vmStat.SwapTotal > 0 {
+		used := float64(vmStat.SwapTotal-vmStat.SwapFree) / float64(vmStat.SwapTotal) * 100
+		metrics = append(metrics, newGauge("SwapUsedPercent", used))
+	}
+
+	return metrics, nil
+}
+
+// collectCPU вычисляет загрузку каждого ядра по разнице процессорного времени между опросами.
+func (c *systemCollector) collectCPU(ctx context.Context) ([]models.Metrics, error) {
+	times, err := cpu.TimesWithContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []models.Metrics
+	if len(c.prevCPU) == len(times) {
+		for i, cur := range times {
+			prev := c.prevCPU[i]
+			total := cur.Total() - prev.Total()
+			idle := (cur.Idle + cur.Iowait) - (prev.Idle + prev.Iowait)
+			if total <= 0 {
+				continue
 			}
-			a.mutex.Unlock()
+			utilization := (total - idle) / total * 100
+			metrics = append(metrics, newGauge("CPUutilization"+strconv.Itoa(i+1), utilization))
 		}
 	}
+	c.prevCPU = times
+
+	return metrics, nil
+}
+
+func (c *systemCollector) collectLoad(ctx context.Context) ([]models.Metrics, error) {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.Metrics{
+		newGauge("LoadAverage1", avg.Load1),
+		newGauge("LoadAverage5", avg.Load5),
+		newGauge("LoadAverage15", avg.Load15),
+	}, nil
+}
+
+// collectDisks собирает заполнение и счётчики ввода-вывода для каждой точки монтирования.
+// Псевдофайловые системы пропускаются.
+func (c *systemCollector) collectDisks(ctx context.Context) ([]models.Metrics, error) {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	ioCounters, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		ioCounters = nil
+	}
+
+	var metrics []models.Metrics
+	seen := make(map[string]bool)
+	for _, p := range partitions {
+		if seen[p.Mountpoint] || pseudoFilesystems[p.Fstype] {
+			continue
+		}
+		seen[p.Mountpoint] = true
+		suffix := "_" + mountName(p.Mountpoint)
+
+		path := p.Mountpoint
+		if c.procRoot != "" {
+			path = filepath.Join(c.procRoot, "1", "root", p.Mountpoint)
+		}
+		if usage, err := disk.UsageWithContext(ctx, path); err == nil {
+			metrics = append(metrics,
+				newGauge("DiskTotal"+suffix, float64(usage.Total)),
+				newGauge("DiskUsed"+suffix, float64(usage.Used)),
+				newGauge("DiskUsedPercent"+suffix, usage.UsedPercent),
+			)
+		}
+
+		io, ok := ioCounters[filepath.Base(p.Device)]
+		if !ok {
+			continue
+		}
+		metrics = c.counters.appendDeltas(metrics, map[string]uint64{
+			"DiskReadBytes" + suffix:  io.ReadBytes,
+			"DiskWriteBytes" + suffix: io.WriteBytes,
+			"DiskReadCount" + suffix:  io.ReadCount,
+			"DiskWriteCount" + suffix: io.WriteCount,
+		})
+	}
+
+	return metrics, nil
+}
+
+func (c *systemCollector) collectNetwork(ctx context.Context) ([]models.Metrics, error) {
+	stats, err := net.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []models.Metrics
+	for _, s := range stats {
+		if s.Name == "lo" {
+			continue
+		}
+		suffix := "_" + s.Name
+		metrics = c.counters.appendDeltas(metrics, map[string]uint64{
+			"NetBytesSent" + suffix:   s.BytesSent,
+			"NetBytesRecv" + suffix:   s.BytesRecv,
+			"NetPacketsSent" + suffix: s.PacketsSent,
+			"NetPacketsRecv" + suffix: s.PacketsRecv,
+		})
+	}
+
+	return metrics, nil
+}
+
+// mountName преобразует точку монтирования в допустимую часть имени метрики: "/" -> "root",
+// "/var/lib" -> "var_lib".
+func mountName(mountpoint string) string {
+	name := strings.Trim(mountpoint, "/")
+	if name == "" {
+		return "root"
+	}
+	return strings.ReplaceAll(name, "/", "_")
 }
@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+)
+
+func writeProcFile(t *testing.T, root, name, content string) {
+	t.Helper()
+	path := filepath.Join(root, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+// fakeProc создаёт минимальное дерево /proc для systemCollector.
+func fakeProc(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+
+	writeProcFile(t, root, "meminfo", `MemTotal:        8000000 kB
+MemFree:         2000000 kB
+MemAvailable:    4000000 kB
+SwapTotal:       1000000 kB
+SwapFree:         750000 kB
+`)
+	writeProcFile(t, root, "loadavg", "0.50 1.25 2.00 1/100 12345\n")
+	writeProcFile(t, root, "filesystems", "nodev\tproc\n\text4\n\tsquashfs\n")
+	writeProcFile(t, root, "1/mounts", `/dev/sda1 / ext4 rw,relatime 0 0
+/dev/sdb1 /data ext4 rw,relatime 0 0
+/dev/loop0 /snap/core squashfs ro 0 0
+proc /proc proc rw 0 0
+`)
+	// корень процесса 1, через который определяется заполнение дисков
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "1", "root", "data"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "1", "root", "snap", "core"), 0o755))
+	writeProcFile(t, root, "diskstats", "   8       1 sda1 100 0 2000 0 50 0 4000 0 0 0 0\n")
+	writeProcFile(t, root, "net/dev", `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     500       5    0    0    0     0          0         0      500       5    0    0    0     0       0          0
+  eth0:    1000      10    0    0    0     0          0         0     2000      20    0    0    0     0       0          0
+`)
+	writeProcFile(t, root, "stat", `cpu  200 0 200 1600 0 0 0 0 0 0
+cpu0 100 0 100 800 0 0 0 0 0 0
+cpu1 100 0 100 800 0 0 0 0 0 0
+`)
+	return root
+}
+
+func metricsByID(metrics []models.Metrics) map[string]models.Metrics {
+	result := make(map[string]models.Metrics, len(metrics))
+	for _, m := range metrics {
+		result[m.ID] = m
+	}
+	return result
+}
+
+func TestSystemCollector_FakeProc(t *testing.T) {
+	root := fakeProc(t)
+	c := &systemCollector{procRoot: root, counters: make(deltaTracker)}
+
+	first, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	byID := metricsByID(first)
+
+	assert.Equal(t, float64(8000000*1024), *byID["TotalMemory"].Value)
+	assert.Equal(t, float64(2000000*1024), *byID["FreeMemory"].Value)
+	assert.Equal(t, 25.0, *byID["SwapUsedPercent"].Value)
+	assert.Equal(t, 0.5, *byID["LoadAverage1"].Value)
+	assert.Equal(t, 1.25, *byID["LoadAverage5"].Value)
+	assert.Equal(t, 2.0, *byID["LoadAverage15"].Value)
+	assert.Contains(t, byID, "DiskTotal_root")
+	assert.Contains(t, byID, "DiskUsedPercent_root")
+	// точка монтирования, которой нет вне procRoot, определяется через procRoot/1/root
+	assert.Contains(t, byID, "DiskTotal_data")
+	assert.NotContains(t, byID, "DiskTotal_snap_core")
+
+	// при первом опросе нет базы для вычисления загрузки ядер и приращений счётчиков
+	assert.NotContains(t, byID, "CPUutilization1")
+	assert.NotContains(t, byID, "NetBytesRecv_eth0")
+
+	// cpu0 загружен на 50%, cpu1 — на 100%
+	writeProcFile(t, root, "stat", `cpu  500 0 200 1700 0 0 0 0 0 0
+cpu0 150 0 100 850 0 0 0 0 0 0
+cpu1 350 0 100 800 0 0 0 0 0 0
+`)
+	writeProcFile(t, root, "diskstats", "   8       1 sda1 110 0 2400 0 60 0 4100 0 0 0 0\n")
+	writeProcFile(t, root, "net/dev", `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     900       9    0    0    0     0          0         0      900       9    0    0    0     0       0          0
+  eth0:    1500      13    0    0    0     0          0         0     2100      21    0    0    0     0       0          0
+`)
+
+	second, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	byID = metricsByID(second)
+
+	assert.Equal(t, 50.0, *byID["CPUutilization1"].Value)
+	assert.Equal(t, 100.0, *byID["CPUutilization2"].Value)
+	assert.NotContains(t, byID, "CPUutilization3")
+
+	assert.Equal(t, int64(500), *byID["NetBytesRecv_eth0"].Delta)
+	assert.Equal(t, int64(100), *byID["NetBytesSent_eth0"].Delta)
+	assert.Equal(t, int64(3), *byID["NetPacketsRecv_eth0"].Delta)
+	assert.Equal(t, int64(1), *byID["NetPacketsSent_eth0"].Delta)
+	assert.NotContains(t, byID, "NetBytesRecv_lo")
+
+	assert.Equal(t, int64(400*512), *byID["DiskReadBytes_root"].Delta)
+	assert.Equal(t, int64(100*512), *byID["DiskWriteBytes_root"].Delta)
+	assert.Equal(t, int64(10), *byID["DiskReadCount_root"].Delta)
+	assert.Equal(t, int64(10), *byID["DiskWriteCount_root"].Delta)
+}
+
+func TestMountName(t *testing.T) {
+	assert.Equal(t, "root", mountName("/"))
+	assert.Equal(t, "var_lib", mountName("/var/lib"))
+	assert.Equal(t, "home", mountName("/home/"))
+}
@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"go.uber.org/zap"
+)
+
+const defaultCgroupPath = "/sys/fs/cgroup"
+
+func init() {
+	RegisterCollector("cgroup", newCgroupCollector, true)
+}
+
+// cgroupCollector собирает потребление ресурсов контейнера из файлов cgroup v2:
+// память и её лимит, процессорное время и троттлинг, ввод-вывод устройств, число процессов.
+type cgroupCollector struct {
+	path string
+	now  func() time.Time
+
+	prevUsage     uint64
+	prevPeriods   uint64
+	prevThrottled uint64
+	prevTime      time.Time
+	observed      bool
+	counters      deltaTracker
+}
+
+func newCgroupCollector(cfg *config.Config) (Collector, error) {
+	path := cfg.Agent.CgroupPath
+	if path == "" {
+		path = defaultCgroupPath
+	}
+
+	// cgroup.controllers есть только в иерархии cgroup v2
+	if _, err := os.Stat(filepath.Join(path, "cgroup.controllers")); err != nil {
+		logger.Log.Info("cgroup v2 not found, collector disabled", zap.String("path", path))
+		return nil, nil
+	}
+
+	return &cgroupCollector{path: path, now: time.Now, counters: make(deltaTracker)}, nil
+}
+
+func (c *cgroupCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	var metrics []models.Metrics
+	var errs []error
+
+	for _, collect := range []func() ([]models.Metrics, error){
+		c.collectMemory,
+		c.collectCPU,
+		c.collectIO,
+		c.collectPids,
+	} {
+		m, err := collect()
+		metrics = append(metrics, m...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// collectMemory читает потребление памяти. В корневой cgroup файлов memory.current
+// и memory.max нет, и метрики памяти не отправляются.
+func (c *cgroupCollector) collectMemory() ([]models.Metrics, error) {
+	current, err := c.readValue("memory.current")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	metrics := []models.Metrics{newGauge("CgroupMemoryCurrent", float64(current))}
+
+	limit, unlimited, err := c.readLimit("memory.max")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return metrics, nil
+		}
+		return metrics, err
+	}
+	if !unlimited && limit > 0 {
+		metrics = append(metrics,
+			newGauge("CgroupMemoryMax", float64(limit)),
+			newGauge("CgroupMemoryUsedPercent", float64(current)/float64(limit)*100),
+		)
+	}
+
+	return metrics, nil
+}
+
+// collectCPU вычисляет загрузку процессора контейнером и долю периодов планировщика,
+// в которых контейнер был ограничен квотой, по разнице значений cpu.stat между опросами.
+func (c *cgroupCollector) collectCPU() ([]models.Metrics, error) {
+	stat, err := c.readKeyValues("cpu.stat")
+	if err != nil {
+		return nil, err
+	}
+	now := c.now()
+
+	usage := stat["usage_usec"]
+	periods := stat["nr_periods"]
+	throttled := stat["nr_throttled"]
+
+	var metrics []models.Metrics
+	if c.observed && usage >= c.prevUsage {
+		if elapsed := now.Sub(c.prevTime).Microseconds(); elapsed > 0 {
+			metrics = append(metrics, newGauge("CgroupCPUPercent", float64(usage-c.prevUsage)/float64(elapsed)*100))
+		}
+		if periods > c.prevPeriods && throttled >= c.prevThrottled {
+			ratio := float64(throttled-c.prevThrottled) / float64(periods-c.prevPeriods) * 100
+			metrics = append(metrics, newGauge("CgroupCPUThrottledPercent", ratio))
+		}
+	}
+	c.prevUsage, c.prevPeriods, c.prevThrottled, c.prevTime = usage, periods, throttled, now
+	c.observed = true
+
+	metrics = c.counters.appendDeltas(metrics, map[string]uint64{
+		"CgroupCPUUsageUsec":      usage,
+		"CgroupCPUUserUsec":       stat["user_usec"],
+		"CgroupCPUSystemUsec":     stat["system_usec"],
+		"CgroupCPUThrottledCount": throttled,
+		"CgroupCPUThrottledUsec":  stat["throttled_usec"],
+	})
+
+	return metrics, nil
+}
+
+// collectIO собирает счётчики ввода-вывода каждого устройства из io.stat.
+func (c *cgroupCollector) collectIO() ([]models.Metrics, error) {
+	f, err := os.Open(filepath.Join(c.path, "io.stat"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var metrics []models.Metrics
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		stat := make(map[string]uint64, len(fields)-1)
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			if v, err := strconv.ParseUint(value, 10, 64); err == nil {
+				stat[key] = v
+			}
+		}
+
+		// устройство "8:0" превращается в суффикс "_8_0"
+		suffix := "_" + strings.ReplaceAll(fields[0], ":", "_")
+		metrics = c.counters.appendDeltas(metrics, map[string]uint64{
+			"CgroupIOReadBytes" + suffix:  stat["rbytes"],
+			"CgroupIOWriteBytes" + suffix: stat["wbytes"],
+			"CgroupIOReadOps" + suffix:    stat["rios"],
+			"CgroupIOWriteOps" + suffix:   stat["wios"],
+		})
+	}
+
+	return metrics, scanner.Err()
+}
+
+func (c *cgroupCollector) collectPids() ([]models.Metrics, error) {
+	current, err := c.readValue("pids.current")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	metrics := []models.Metrics{newGauge("CgroupPids", float64(current))}
+	if limit, unlimited, err := c.readLimit("pids.max"); err == nil && !unlimited {
+		metrics = append(metrics, newGauge("CgroupPidsMax", float64(limit)))
+	}
+
+	return metrics, nil
+}
+
+// readValue читает файл, содержащий одно число.
+func (c *cgroupCollector) readValue(name string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(c.path, name))
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value in %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// readLimit читает файл лимита, в котором значение "max" означает отсутствие ограничения.
+func (c *cgroupCollector) readLimit(name string) (uint64, bool, error) {
+	data, err := os.ReadFile(filepath.Join(c.path, name))
+	if err != nil {
+		return 0, false, err
+	}
+	text := strings.TrimSpace(string(data))
+	if text == "max" {
+		return 0, true, nil
+	}
+	value, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid value in %s: %w", name, err)
+	}
+	return value, false, nil
+}
+
+// readKeyValues читает файл формата "ключ значение" построчно.
+func (c *cgroupCollector) readKeyValues(name string) (map[string]uint64, error) {
+	f, err := os.Open(filepath.Join(c.path, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		if v, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64); err == nil {
+			values[key] = v
+		}
+	}
+
+	return values, scanner.Err()
+}
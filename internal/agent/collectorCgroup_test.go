@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+)
+
+// copyCgroupFixture копирует эталонное дерево testdata/cgroup во временный каталог.
+func copyCgroupFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	entries, err := os.ReadDir("testdata/cgroup")
+	require.NoError(t, err)
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join("testdata/cgroup", e.Name()))
+		require.NoError(t, err)
+		writeProcFile(t, dir, e.Name(), string(data))
+	}
+	return dir
+}
+
+func TestCgroupCollector(t *testing.T) {
+	dir := copyCgroupFixture(t)
+
+	cfg := &config.Config{}
+	cfg.Agent.CgroupPath = dir
+	collector, err := newCgroupCollector(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, collector)
+
+	c := collector.(*cgroupCollector)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	byID := metricsByID(metrics)
+
+	assert.Equal(t, 104857600.0, *byID["CgroupMemoryCurrent"].Value)
+	assert.Equal(t, 419430400.0, *byID["CgroupMemoryMax"].Value)
+	assert.Equal(t, 25.0, *byID["CgroupMemoryUsedPercent"].Value)
+	assert.Equal(t, 12.0, *byID["CgroupPids"].Value)
+	assert.NotContains(t, byID, "CgroupPidsMax")
+	// при первом опросе приращения и загрузка не вычисляются
+	assert.NotContains(t, byID, "CgroupCPUPercent")
+	assert.NotContains(t, byID, "CgroupCPUUsageUsec")
+
+	writeProcFile(t, dir, "cpu.stat", `usage_usec 2500000
+user_usec 1800000
+system_usec 700000
+nr_periods 200
+nr_throttled 15
+throttled_usec 90000
+`)
+	writeProcFile(t, dir, "io.stat", "8:0 rbytes=6144 wbytes=8192 rios=6 wios=8 dbytes=0 dios=0\n")
+	writeProcFile(t, dir, "pids.max", "100\n")
+	now = now.Add(time.Second)
+
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	byID = metricsByID(metrics)
+
+	assert.InDelta(t, 50.0, *byID["CgroupCPUPercent"].Value, 0.001)
+	assert.InDelta(t, 5.0, *byID["CgroupCPUThrottledPercent"].Value, 0.001)
+	assert.Equal(t, int64(500000), *byID["CgroupCPUUsageUsec"].Delta)
+	assert.Equal(t, int64(5), *byID["CgroupCPUThrottledCount"].Delta)
+	assert.Equal(t, int64(50000), *byID["CgroupCPUThrottledUsec"].Delta)
+	assert.Equal(t, int64(2048), *byID["CgroupIOReadBytes_8_0"].Delta)
+	assert.Equal(t, int64(0), *byID["CgroupIOWriteBytes_8_0"].Delta)
+	assert.NotContains(t, byID, "CgroupIOReadBytes_253_1")
+	assert.Equal(t, 100.0, *byID["CgroupPidsMax"].Value)
+}
+
+func TestCgroupCollector_NotCgroupV2(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agent.CgroupPath = t.TempDir()
+
+	c, err := newCgroupCollector(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+}
+
+func TestCgroupCollector_UnlimitedMemory(t *testing.T) {
+	dir := copyCgroupFixture(t)
+	writeProcFile(t, dir, "memory.max", "max\n")
+
+	cfg := &config.Config{}
+	cfg.Agent.CgroupPath = dir
+	c, err := newCgroupCollector(cfg)
+	require.NoError(t, err)
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	byID := metricsByID(metrics)
+
+	assert.Contains(t, byID, "CgroupMemoryCurrent")
+	assert.NotContains(t, byID, "CgroupMemoryMax")
+	assert.NotContains(t, byID, "CgroupMemoryUsedPercent")
+}
+
+func TestCgroupCollector_RootCgroup(t *testing.T) {
+	dir := copyCgroupFixture(t)
+	// в корневой cgroup нет файлов памяти и лимита процессов
+	for _, name := range []string{"memory.current", "memory.max", "pids.current", "pids.max"} {
+		require.NoError(t, os.Remove(filepath.Join(dir, name)))
+	}
+
+	cfg := &config.Config{}
+	cfg.Agent.CgroupPath = dir
+	collector, err := newCgroupCollector(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, collector)
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	byID := metricsByID(metrics)
+	assert.NotContains(t, byID, "CgroupMemoryCurrent")
+	assert.NotContains(t, byID, "CgroupPids")
+}
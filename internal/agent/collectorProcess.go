@@ -0,0 +1,232 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// processRestartWindow — сколько завершение процесса ждёт запуска замены. Процесс,
+// запущенный позже, считается новым, а не перезапущенным.
+const processRestartWindow = 10 * time.Minute
+
+func init() {
+	RegisterCollector("process", newProcessCollector, true)
+}
+
+// processWatch описывает наблюдаемую группу процессов и её состояние между опросами.
+type processWatch struct {
+	name      string
+	pidFile   string
+	nameRegex *regexp.Regexp
+	cgroup    string
+
+	procs    map[int32]*process.Process
+	exits    []time.Time // завершения, которым ещё не нашлась замена, от старых к новым
+	observed bool
+	now      func() time.Time
+}
+
+// processCollector собирает метрики процессов, найденных по PID-файлу, регулярному
+// выражению имени или cgroup: загрузку процессора, RSS, число открытых дескрипторов и
+// потоков, а также число перезапусков.
+type processCollector struct {
+	watches []*processWatch
+}
+
+func newProcessCollector(cfg *config.Config) (Collector, error) {
+	if len(cfg.Agent.Processes) == 0 {
+		return nil, nil
+	}
+
+	c := &processCollector{}
+	for _, w := range cfg.Agent.Processes {
+		if w.Name == "" {
+			return nil, errors.New("process watch name is required")
+		}
+
+		watch := &processWatch{
+			name:    w.Name,
+			pidFile: w.PIDFile,
+			cgroup:  w.Cgroup,
+			procs:   make(map[int32]*process.Process),
+			now:     time.Now,
+		}
+		if w.NameRegex != "" {
+			re, err := regexp.Compile(w.NameRegex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid name_regex for process %s: %w", w.Name, err)
+			}
+			watch.nameRegex = re
+		}
+		if watch.pidFile == "" && watch.nameRegex == nil && watch.cgroup == "" {
+			return nil, fmt.Errorf("process %s: one of pid_file, name_regex or cgroup is required", w.Name)
+		}
+
+		c.watches = append(c.watches, watch)
+	}
+
+	return c, nil
+}
+
+func (c *processCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	var metrics []models.Metrics
+	var errs []error
+
+	for _, w := range c.watches {
+		m, err := w.collect(ctx)
+		metrics = append(metrics, m...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("process %s: %w", w.name, err))
+		}
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+func (w *processWatch) collect(ctx context.Context) ([]models.Metrics, error) {
+	pids, err := w.findPIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[int32]bool, len(pids))
+	var started int
+	for _, pid := range pids {
+		current[pid] = true
+		if _, ok := w.procs[pid]; ok {
+			continue
+		}
+		p, err := process.NewProcessWithContext(ctx, pid)
+		if err != nil {
+			continue
+		}
+		w.procs[pid] = p
+		started++
+	}
+
+	now := w.now()
+	for pid := range w.procs {
+		if !current[pid] {
+			delete(w.procs, pid)
+			w.exits = append(w.exits, now)
+		}
+	}
+
+	// перезапуском считается завершение процесса, на смену которому в пределах
+	// processRestartWindow запущен новый, в том же или в одном из следующих опросов
+	for len(w.exits) > 0 && now.Sub(w.exits[0]) > processRestartWindow {
+		w.exits = w.exits[1:]
+	}
+	restarts := min(started, len(w.exits))
+	w.exits = w.exits[restarts:]
+	firstPoll := !w.observed
+	w.observed = true
+
+	var cpuPercent float64
+	var rss uint64
+	var fds, threads int32
+	for _, p := range w.procs {
+		if v, err := p.PercentWithContext(ctx, 0); err == nil {
+			cpuPercent += v
+		}
+		if mi, err := p.MemoryInfoWithContext(ctx); err == nil {
+			rss += mi.RSS
+		}
+		if v, err := p.NumFDsWithContext(ctx); err == nil {
+			fds += v
+		}
+		if v, err := p.NumThreadsWithContext(ctx); err == nil {
+			threads += v
+		}
+	}
+
+	suffix := "_" + w.name
+	metrics := []models.Metrics{
+		newGauge("ProcessCount"+suffix, float64(len(w.procs))),
+		newGauge("ProcessCPUPercent"+suffix, cpuPercent),
+		newGauge("ProcessRSS"+suffix, float64(rss)),
+		newGauge("ProcessOpenFDs"+suffix, float64(fds)),
+		newGauge("ProcessThreads"+suffix, float64(threads)),
+	}
+	if !firstPoll {
+		metrics = append(metrics, newCounter("ProcessRestarts"+suffix, int64(restarts)))
+	}
+
+	return metrics, nil
+}
+
+// findPIDs возвращает идентификаторы процессов группы.
+func (w *processWatch) findPIDs(ctx context.Context) ([]int32, error) {
+	switch {
+	case w.pidFile != "":
+		data, err := os.ReadFile(w.pidFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid file %s: %w", w.pidFile, err)
+		}
+		if exists, _ := process.PidExistsWithContext(ctx, int32(pid)); !exists {
+			return nil, nil
+		}
+		return []int32{int32(pid)}, nil
+
+	case w.cgroup != "":
+		return readCgroupProcs(filepath.Join(w.cgroup, "cgroup.procs"))
+
+	default:
+		procs, err := process.ProcessesWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var pids []int32
+		for _, p := range procs {
+			name, err := p.NameWithContext(ctx)
+			if err == nil && w.nameRegex.MatchString(name) {
+				pids = append(pids, p.Pid)
+			}
+		}
+		return pids, nil
+	}
+}
+
+// readCgroupProcs читает идентификаторы процессов из файла cgroup.procs.
+func readCgroupProcs(path string) ([]int32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pids []int32
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		pid, err := strconv.ParseInt(line, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid in %s: %w", path, err)
+		}
+		pids = append(pids, int32(pid))
+	}
+
+	return pids, scanner.Err()
+}
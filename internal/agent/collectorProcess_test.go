@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+)
+
+func startSleep(t *testing.T) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command("sleep", "30")
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	return cmd
+}
+
+func TestProcessCollector_PIDFile(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0o644))
+
+	cfg := &config.Config{}
+	cfg.Agent.Processes = []config.ProcessWatchConfig{{Name: "app", PIDFile: pidFile}}
+
+	c, err := newProcessCollector(cfg)
+	require.NoError(t, err)
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	byID := metricsByID(metrics)
+
+	assert.Equal(t, 1.0, *byID["ProcessCount_app"].Value)
+	assert.Greater(t, *byID["ProcessRSS_app"].Value, 0.0)
+	assert.Greater(t, *byID["ProcessOpenFDs_app"].Value, 0.0)
+	assert.Greater(t, *byID["ProcessThreads_app"].Value, 0.0)
+	assert.NotContains(t, byID, "ProcessRestarts_app")
+
+	// тот же процесс — перезапусков нет
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), *metricsByID(metrics)["ProcessRestarts_app"].Delta)
+
+	// PID в файле сменился — процесс перезапущен
+	child := startSleep(t)
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(child.Process.Pid)), 0o644))
+
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	byID = metricsByID(metrics)
+	assert.Equal(t, int64(1), *byID["ProcessRestarts_app"].Delta)
+	assert.Equal(t, 1.0, *byID["ProcessCount_app"].Value)
+
+	// процесс завершён и PID-файл удалён
+	require.NoError(t, os.Remove(pidFile))
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	byID = metricsByID(metrics)
+	assert.Equal(t, 0.0, *byID["ProcessCount_app"].Value)
+	assert.Equal(t, int64(0), *byID["ProcessRestarts_app"].Delta)
+}
+
+func TestProcessCollector_RestartAcrossPolls(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	first := startSleep(t)
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(first.Process.Pid)), 0o644))
+
+	cfg := &config.Config{}
+	cfg.Agent.Processes = []config.ProcessWatchConfig{{Name: "app", PIDFile: pidFile}}
+	c, err := newProcessCollector(cfg)
+	require.NoError(t, err)
+	watch := c.(*processCollector).watches[0]
+	now := time.Now()
+	watch.now = func() time.Time { return now }
+
+	restarts := func() int64 {
+		t.Helper()
+		metrics, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		m, ok := metricsByID(metrics)["ProcessRestarts_app"]
+		if !ok {
+			return -1
+		}
+		return *m.Delta
+	}
+	require.Equal(t, int64(-1), restarts())
+
+	// процесс завершился в одном интервале
+	require.NoError(t, first.Process.Kill())
+	first.Wait()
+	now = now.Add(time.Minute)
+	assert.Equal(t, int64(0), restarts())
+
+	// и запущен снова в следующем
+	second := startSleep(t)
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(second.Process.Pid)), 0o644))
+	now = now.Add(time.Minute)
+	assert.Equal(t, int64(1), restarts())
+
+	// запуск после окна ожидания не считается перезапуском
+	require.NoError(t, second.Process.Kill())
+	second.Wait()
+	now = now.Add(time.Minute)
+	assert.Equal(t, int64(0), restarts())
+
+	third := startSleep(t)
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(third.Process.Pid)), 0o644))
+	now = now.Add(processRestartWindow + time.Minute)
+	assert.Equal(t, int64(0), restarts())
+}
+
+func TestProcessCollector_Cgroup(t *testing.T) {
+	first := startSleep(t)
+	second := startSleep(t)
+
+	cgroup := t.TempDir()
+	procs := strconv.Itoa(first.Process.Pid) + "\n" + strconv.Itoa(second.Process.Pid) + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(cgroup, "cgroup.procs"), []byte(procs), 0o644))
+
+	cfg := &config.Config{}
+	cfg.Agent.Processes = []config.ProcessWatchConfig{{Name: "workers", Cgroup: cgroup}}
+
+	c, err := newProcessCollector(cfg)
+	require.NoError(t, err)
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, *metricsByID(metrics)["ProcessCount_workers"].Value)
+}
+
+func TestProcessCollector_InvalidConfig(t *testing.T) {
+	testCases := []struct {
+		name  string
+		watch config.ProcessWatchConfig
+	}{
+		{name: "no_name", watch: config.ProcessWatchConfig{PIDFile: "/run/app.pid"}},
+		{name: "no_selector", watch: config.ProcessWatchConfig{Name: "app"}},
+		{name: "bad_regex", watch: config.ProcessWatchConfig{Name: "app", NameRegex: "("}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Agent.Processes = []config.ProcessWatchConfig{tc.watch}
+			_, err := newProcessCollector(cfg)
+			assert.Error(t, err)
+		})
+	}
+}
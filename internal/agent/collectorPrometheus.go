@@ -0,0 +1,339 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"go.uber.org/zap"
+)
+
+const prometheusScrapeTimeout = 10 * time.Second
+
+var errInvalidPrometheusLine = errors.New("invalid prometheus sample")
+
+// promLabelReplacer заменяет в метках кавычки, косые черты и пробельные символы: формат
+// Prometheus их допускает, но в имени метрики агента они ломают адреса /value/... и
+// текстовые ответы сервера.
+var promLabelReplacer = strings.NewReplacer(`"`, "_", `\`, "_", "/", "_", " ", "_", "\t", "_", "\n", "_")
+
+func init() {
+	RegisterCollector("prometheus", newPrometheusCollector, true)
+}
+
+// promSample — значение из ответа endpoint в текстовом формате Prometheus.
+type promSample struct {
+	name    string
+	labels  map[string]string
+	value   float64
+	counter bool
+}
+
+// scrapeTarget описывает опрашиваемый endpoint и его накопительные значения.
+type scrapeTarget struct {
+	url      string
+	prefix   string
+	counters map[string]*promCounter
+}
+
+// promCounter хранит последнее значение counter и дробный остаток приращения, который
+// переносится в следующий опрос.
+type promCounter struct {
+	value     float64
+	remainder float64
+}
+
+// prometheusCollector опрашивает endpoint'ы в текстовом формате Prometheus и преобразует
+// значения в метрики агента. Counter, а также число наблюдений и корзины гистограмм и
+// summary передаются приращениями counter, остальные значения — gauge. Метки становятся
+// частью имени метрики. Строки, которые не удалось разобрать, пропускаются и учитываются
+// в PrometheusInvalidLines. Опрашиваются только endpoint'ы на loopback-адресах, чтобы
+// конфигурация агента не позволяла обращаться от его имени к другим хостам.
+type prometheusCollector struct {
+	client  *http.Client
+	targets []*scrapeTarget
+}
+
+func newPrometheusCollector(cfg *config.Config) (Collector, error) {
+	if len(cfg.Agent.ScrapeTargets) == 0 {
+		return nil, nil
+	}
+
+	c := &prometheusCollector{client: &http.Client{Timeout: prometheusScrapeTimeout}}
+	for _, t := range cfg.Agent.ScrapeTargets {
+		if t.URL == "" {
+			return nil, errors.New("scrape target url is required")
+		}
+		u, err := url.Parse(t.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scrape target url: %w", err)
+		}
+		if !isLoopbackHost(u.Hostname()) {
+			return nil, fmt.Errorf("scrape target %s: host must be localhost or a loopback address", t.URL)
+		}
+		c.targets = append(c.targets, &scrapeTarget{
+			url:      t.URL,
+			prefix:   t.Prefix,
+			counters: make(map[string]*promCounter),
+		})
+	}
+
+	return c, nil
+}
+
+func (c *prometheusCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	var metrics []models.Metrics
+	var errs []error
+
+	for _, t := range c.targets {
+		m, err := c.scrape(ctx, t)
+		metrics = append(metrics, m...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("scrape %s: %w", t.url, err))
+		}
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+func (c *prometheusCollector) scrape(ctx context.Context, t *scrapeTarget) ([]models.Metrics, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+
+	samples, invalid, err := parsePrometheusText(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []models.Metrics
+	if invalid > 0 {
+		metrics = append(metrics, newCounter("PrometheusInvalidLines", invalid))
+	}
+	for _, s := range samples {
+		if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+			continue
+		}
+		exportInstanceLabel(s.labels)
+		id := models.SeriesID(t.prefix+s.name, s.labels)
+		if !s.counter {
+			metrics = append(metrics, newGauge(id, s.value))
+			continue
+		}
+		if s.value < 0 {
+			continue
+		}
+		if d, ok := t.counterDelta(id, s.value); ok {
+			metrics = append(metrics, newCounter(id, d))
+		}
+	}
+
+	return metrics, nil
+}
+
+// counterDelta возвращает целую часть приращения counter id с предыдущего опроса, дробная
+// часть переносится в следующий опрос. При первом наблюдении приращение не вычисляется,
+// при уменьшении значения (перезапуск источника) приращением считается само значение.
+func (t *scrapeTarget) counterDelta(id string, value float64) (int64, bool) {
+	c, ok := t.counters[id]
+	if !ok {
+		t.counters[id] = &promCounter{value: value}
+		return 0, false
+	}
+
+	increment := value - c.value
+	if value < c.value {
+		increment = value
+	}
+	c.value = value
+
+	sum := c.remainder + increment
+	if sum >= math.MaxInt64 {
+		c.remainder = 0
+		return 0, false
+	}
+	delta := math.Trunc(sum)
+	c.remainder = sum - delta
+	return int64(delta), true
+}
+
+// exportInstanceLabel переименовывает метку instance опрашиваемого endpoint в
+// exported_instance, как это делает Prometheus: иначе при добавлении идентификатора
+// агента меткой значение из endpoint принималось бы за идентификатор.
+func exportInstanceLabel(labels map[string]string) {
+	value, ok := labels[models.InstanceLabel]
+	if !ok {
+		return
+	}
+	delete(labels, models.InstanceLabel)
+
+	name := "exported_" + models.InstanceLabel
+	for {
+		if _, taken := labels[name]; !taken {
+			break
+		}
+		name = "exported_" + name
+	}
+	labels[name] = value
+}
+
+// parsePrometheusText разбирает ответ в текстовом формате Prometheus и возвращает
+// значения и число пропущенных строк, которые не удалось разобрать. Тип значения
+// определяется по строке # TYPE соответствующего семейства метрик.
+func parsePrometheusText(r io.Reader) ([]promSample, int64, error) {
+	types := make(map[string]string)
+	var samples []promSample
+	var invalid int64
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		s, err := parsePrometheusSample(line)
+		if err != nil {
+			logger.Log.Debug("Invalid prometheus line", zap.Error(err))
+			invalid++
+			continue
+		}
+		s.counter = isPrometheusCounter(s.name, types)
+		samples = append(samples, s)
+	}
+
+	return samples, invalid, scanner.Err()
+}
+
+// isPrometheusCounter сообщает, является ли значение накопительным.
+func isPrometheusCounter(name string, types map[string]string) bool {
+	if types[name] == "counter" {
+		return true
+	}
+	for _, suffix := range []string{"_count", "_bucket"} {
+		family, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		if t := types[family]; t == "histogram" || t == "summary" {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrometheusSample разбирает строку вида name{label="value",...} value [timestamp].
+func parsePrometheusSample(line string) (promSample, error) {
+	var s promSample
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return s, fmt.Errorf("%w: %q", errInvalidPrometheusLine, line)
+	}
+	s.name = line[:end]
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		labels, tail, err := parsePrometheusLabels(rest[1:])
+		if err != nil {
+			return s, fmt.Errorf("%w: %q: %w", errInvalidPrometheusLine, line, err)
+		}
+		s.labels = labels
+		rest = tail
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return s, fmt.Errorf("%w: %q", errInvalidPrometheusLine, line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("%w: %q: %w", errInvalidPrometheusLine, line, err)
+	}
+	s.value = value
+
+	return s, nil
+}
+
+// parsePrometheusLabels разбирает метки до закрывающей фигурной скобки и возвращает
+// оставшуюся часть строки.
+func parsePrometheusLabels(s string) (map[string]string, string, error) {
+	labels := make(map[string]string)
+
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, "", errors.New("label name expected")
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if !strings.HasPrefix(s, `"`) {
+			return nil, "", errors.New("quoted label value expected")
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return nil, "", errors.New("unterminated label value")
+		}
+
+		labels[sanitizePromLabel(name)] = sanitizePromLabel(value.String())
+		s = s[i+1:]
+	}
+}
+
+// sanitizePromLabel заменяет в имени или значении метки символы, недопустимые в имени
+// метрики агента.
+func sanitizePromLabel(s string) string {
+	return models.SanitizeLabel(promLabelReplacer.Replace(s))
+}
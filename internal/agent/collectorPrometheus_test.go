@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+)
+
+const promExposition = `# HELP http_requests_total Total requests.
+# TYPE http_requests_total counter
+http_requests_total{method="get",path="/a \"b\""} %d
+http_requests_total{method="post"} 3 1700000000000
+# TYPE queue_length gauge
+queue_length 7.5
+# TYPE rpc_duration_seconds histogram
+rpc_duration_seconds_bucket{le="0.1"} %d
+rpc_duration_seconds_bucket{le="+Inf"} %d
+rpc_duration_seconds_sum 1.5
+rpc_duration_seconds_count %d
+untyped_value NaN
+broken_line
+`
+
+func TestPrometheusCollector(t *testing.T) {
+	var requests atomic.Int64
+	requests.Store(10)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Load()
+		fmt.Fprintf(w, promExposition, n, n, n, n)
+	}))
+	defer ts.Close()
+
+	cfg := &config.Config{}
+	cfg.Agent.ScrapeTargets = []config.ScrapeTargetConfig{{URL: ts.URL, Prefix: "app_"}}
+	c, err := newPrometheusCollector(cfg)
+	require.NoError(t, err)
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	byID := metricsByID(metrics)
+
+	assert.Equal(t, 7.5, *byID["app_queue_length"].Value)
+	assert.Equal(t, 1.5, *byID["app_rpc_duration_seconds_sum"].Value)
+	assert.NotContains(t, byID, "app_untyped_value")
+	// строка, которую не удалось разобрать, не прерывает опрос
+	assert.Equal(t, int64(1), *byID["PrometheusInvalidLines"].Delta)
+	// накопительные значения при первом опросе не передаются
+	assert.NotContains(t, byID, "app_http_requests_total{method=get,path=_a__b_}")
+
+	requests.Store(15)
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	byID = metricsByID(metrics)
+
+	assert.Equal(t, int64(5), *byID["app_http_requests_total{method=get,path=_a__b_}"].Delta)
+	assert.Equal(t, int64(0), *byID["app_http_requests_total{method=post}"].Delta)
+	assert.Equal(t, int64(5), *byID["app_rpc_duration_seconds_count"].Delta)
+	assert.Equal(t, int64(5), *byID["app_rpc_duration_seconds_bucket{le=+Inf}"].Delta)
+}
+
+func TestPrometheusCollector_Errors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	cfg := &config.Config{}
+	cfg.Agent.ScrapeTargets = []config.ScrapeTargetConfig{{URL: ts.URL}}
+	c, err := newPrometheusCollector(cfg)
+	require.NoError(t, err)
+
+	_, err = c.Collect(context.Background())
+	assert.ErrorIs(t, err, ErrUnexpectedStatus)
+}
+
+func TestPrometheusCollector_LoopbackOnly(t *testing.T) {
+	for _, u := range []string{"http://example.com/metrics", "http://10.0.0.1:9100/metrics", "http://[::ffff:8.8.8.8]/"} {
+		cfg := &config.Config{}
+		cfg.Agent.ScrapeTargets = []config.ScrapeTargetConfig{{URL: u}}
+		_, err := newPrometheusCollector(cfg)
+		assert.Error(t, err, u)
+	}
+
+	cfg := &config.Config{}
+	cfg.Agent.ScrapeTargets = []config.ScrapeTargetConfig{{URL: "http://localhost:9100/metrics"}, {URL: "http://[::1]:9100/metrics"}}
+	_, err := newPrometheusCollector(cfg)
+	assert.NoError(t, err)
+}
+
+func TestParsePrometheusText_Invalid(t *testing.T) {
+	for _, line := range []string{
+		"metric",
+		`metric{label="value} 1`,
+		"metric{label=value} 1",
+		"metric abc",
+	} {
+		t.Run(line, func(t *testing.T) {
+			_, err := parsePrometheusSample(line)
+			assert.ErrorIs(t, err, errInvalidPrometheusLine)
+		})
+	}
+
+	samples, invalid, err := parsePrometheusText(strings.NewReader("metric abc\nvalid{a=\"x,y=z\"} 1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), invalid)
+	require.Len(t, samples, 1)
+	assert.Equal(t, map[string]string{"a": "x_y_z"}, samples[0].labels)
+}
+
+func TestPrometheusCollector_LabelsAndFractions(t *testing.T) {
+	var seconds atomic.Value
+	seconds.Store("0.4")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "# TYPE cpu_seconds_total counter\ncpu_seconds_total{instance=\"db\",mountpoint=\"/\"} %s\n", seconds.Load())
+	}))
+	defer ts.Close()
+
+	cfg := &config.Config{}
+	cfg.Agent.ScrapeTargets = []config.ScrapeTargetConfig{{URL: ts.URL}}
+	c, err := newPrometheusCollector(cfg)
+	require.NoError(t, err)
+
+	const id = "cpu_seconds_total{exported_instance=db,mountpoint=_}"
+	_, err = c.Collect(context.Background())
+	require.NoError(t, err)
+
+	// 0.7 за опрос: дробный остаток переносится, а не округляется
+	seconds.Store("1.1")
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), *metricsByID(metrics)[id].Delta)
+
+	seconds.Store("1.8")
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *metricsByID(metrics)[id].Delta)
+
+	seconds.Store("2.5")
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *metricsByID(metrics)[id].Delta)
+}
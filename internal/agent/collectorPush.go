@@ -0,0 +1,235 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/middleware"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	pushUnixPrefix      = "unix:"
+	pushMaxBodySize     = 1 << 20
+	pushShutdownTimeout = 5 * time.Second
+)
+
+var errInvalidPushedMetric = errors.New("invalid metric")
+
+func init() {
+	RegisterCollector("push", newPushCollector, true)
+}
+
+// pushCollector принимает метрики от локальных приложений по HTTP или через unix-сокет.
+// Маршруты /update/ и /updates/ повторяют JSON API сервера, поэтому приложение может
+// отправлять метрики агенту вместо сервера без изменения формата. До следующей отправки
+// gauge сохраняют последнее значение, а приращения counter суммируются.
+type pushCollector struct {
+	address  string
+	listener net.Listener
+
+	mu       sync.Mutex
+	gauges   map[string]float64
+	counters map[string]int64
+}
+
+func newPushCollector(cfg *config.Config) (Collector, error) {
+	if cfg.Agent.PushAddress == "" {
+		return nil, nil
+	}
+
+	return &pushCollector{
+		address:  cfg.Agent.PushAddress,
+		gauges:   make(map[string]float64),
+		counters: make(map[string]int64),
+	}, nil
+}
+
+// Start открывает адрес вида host:port или unix:/path/to.sock и принимает запросы до отмены ctx.
+// API не проверяет отправителей, поэтому TCP-адрес должен быть на loopback-интерфейсе.
+func (c *pushCollector) Start(ctx context.Context) error {
+	network, address := "tcp", c.address
+	if path, ok := strings.CutPrefix(c.address, pushUnixPrefix); ok {
+		network, address = "unix", path
+		if err := removeStaleSocket(path); err != nil {
+			return err
+		}
+	} else {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return fmt.Errorf("invalid push address %q: %w", address, err)
+		}
+		if !isLoopbackHost(host) {
+			return fmt.Errorf("push address %q must be a loopback address: the push API has no authentication", address)
+		}
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return fmt.Errorf("failed to listen push api: %w", err)
+	}
+	if network == "unix" {
+		// API не проверяет отправителей, поэтому сокет доступен только владельцу агента
+		if err := os.Chmod(address, 0o600); err != nil {
+			ln.Close()
+			return fmt.Errorf("failed to set push socket permissions: %w", err)
+		}
+	}
+	c.listener = ln
+
+	srv := &http.Server{Handler: c.router(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Log.Error("Push API stopped", zap.Error(err))
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), pushShutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Log.Info("Push API started", zap.String("network", network), zap.String("address", ln.Addr().String()))
+	return nil
+}
+
+// removeStaleSocket удаляет сокет, оставшийся от предыдущего запуска и мешающий открыть
+// адрес. Сокет удаляется, только если к нему не удаётся подключиться: сокет, который
+// слушает другой процесс, например второй экземпляр агента, не трогается. Файл другого
+// типа не удаляется: скорее всего, адрес указан с ошибкой.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat push socket: %w", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("push socket path %s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("push socket %s is in use by another process", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("failed to check push socket: %w", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale push socket: %w", err)
+	}
+	return nil
+}
+
+// Addr возвращает адрес, на котором принимаются запросы.
+func (c *pushCollector) Addr() net.Addr {
+	return c.listener.Addr()
+}
+
+func (c *pushCollector) router() http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.Gzip)
+	r.Post("/update/", middleware.CheckApplicationJSONContentType(c.updateHandler))
+	r.Post("/updates/", middleware.CheckApplicationJSONContentType(c.batchHandler))
+	return r
+}
+
+func (c *pushCollector) updateHandler(w http.ResponseWriter, r *http.Request) {
+	var metric models.Metrics
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, pushMaxBodySize)).Decode(&metric); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.handle(w, []models.Metrics{metric})
+}
+
+func (c *pushCollector) batchHandler(w http.ResponseWriter, r *http.Request) {
+	var metrics []models.Metrics
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, pushMaxBodySize)).Decode(&metrics); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(metrics) == 0 {
+		http.Error(w, ErrEmptyMetrics.Error(), http.StatusBadRequest)
+		return
+	}
+	c.handle(w, metrics)
+}
+
+// handle проверяет все метрики запроса и только затем сохраняет их, чтобы запрос
+// с ошибкой не применялся частично.
+func (c *pushCollector) handle(w http.ResponseWriter, metrics []models.Metrics) {
+	for _, m := range metrics {
+		if err := validatePushedMetric(m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	c.mu.Lock()
+	for _, m := range metrics {
+		switch m.MType {
+		case "gauge":
+			c.gauges[m.ID] = *m.Value
+		case "counter":
+			c.counters[m.ID] += *m.Delta
+		}
+	}
+	c.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func validatePushedMetric(m models.Metrics) error {
+	if m.ID == "" {
+		return fmt.Errorf("%w: empty id", errInvalidPushedMetric)
+	}
+	switch m.MType {
+	case "gauge":
+		if m.Value == nil {
+			return fmt.Errorf("%w: gauge %s without value", errInvalidPushedMetric, m.ID)
+		}
+	case "counter":
+		if m.Delta == nil {
+			return fmt.Errorf("%w: counter %s without delta", errInvalidPushedMetric, m.ID)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", errInvalidPushedMetric, m.MType)
+	}
+	return nil
+}
+
+// Collect возвращает метрики, принятые с предыдущего вызова.
+func (c *pushCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics := make([]models.Metrics, 0, len(c.gauges)+len(c.counters))
+	for id, v := range c.gauges {
+		metrics = append(metrics, newGauge(id, v))
+	}
+	for id, d := range c.counters {
+		metrics = append(metrics, newCounter(id, d))
+	}
+
+	c.gauges = make(map[string]float64)
+	c.counters = make(map[string]int64)
+
+	return metrics, nil
+}
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+)
+
+func startTestPush(t *testing.T, address string) *pushCollector {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Agent.PushAddress = address
+	c, err := newPushCollector(cfg)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	require.NoError(t, c.(*pushCollector).Start(ctx))
+	return c.(*pushCollector)
+}
+
+func push(t *testing.T, client *http.Client, url, body string) int {
+	t.Helper()
+	resp, err := client.Post(url, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestPushCollector(t *testing.T) {
+	c := startTestPush(t, "127.0.0.1:0")
+	base := "http://" + c.Addr().String()
+	client := http.DefaultClient
+
+	assert.Equal(t, http.StatusOK, push(t, client, base+"/update/", `{"id":"Temp","type":"gauge","value":1.5}`))
+	assert.Equal(t, http.StatusOK, push(t, client, base+"/updates/",
+		`[{"id":"Temp","type":"gauge","value":2.5},{"id":"Jobs","type":"counter","delta":3}]`))
+	assert.Equal(t, http.StatusOK, push(t, client, base+"/update/", `{"id":"Jobs","type":"counter","delta":4}`))
+
+	// пакет с некорректной метрикой отклоняется целиком
+	assert.Equal(t, http.StatusBadRequest, push(t, client, base+"/updates/",
+		`[{"id":"Jobs","type":"counter","delta":100},{"id":"Bad","type":"counter"}]`))
+	assert.Equal(t, http.StatusBadRequest, push(t, client, base+"/update/", `{"id":"X","type":"histogram","value":1}`))
+	assert.Equal(t, http.StatusBadRequest, push(t, client, base+"/updates/", `[]`))
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	byID := metricsByID(metrics)
+	assert.Len(t, byID, 2)
+	assert.Equal(t, 2.5, *byID["Temp"].Value)
+	assert.Equal(t, int64(7), *byID["Jobs"].Delta)
+
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
+
+func TestPushCollector_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	c := startTestPush(t, "unix:"+socket)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	assert.Equal(t, http.StatusOK, push(t, client, "http://agent/update/", `{"id":"Jobs","type":"counter","delta":2}`))
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *metricsByID(metrics)["Jobs"].Delta)
+}
+
+func TestPushCollector_Address(t *testing.T) {
+	start := func(address string) error {
+		cfg := &config.Config{}
+		cfg.Agent.PushAddress = address
+		c, err := newPushCollector(cfg)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		return c.(*pushCollector).Start(ctx)
+	}
+
+	assert.Error(t, start(":0"))
+	assert.Error(t, start("0.0.0.0:0"))
+	assert.Error(t, start("example.com:0"))
+	assert.NoError(t, start("localhost:0"))
+	assert.NoError(t, start("[::1]:0"))
+
+	// обычный файл по пути сокета не удаляется
+	file := filepath.Join(t.TempDir(), "metrics.json")
+	require.NoError(t, os.WriteFile(file, []byte("{}"), 0o600))
+	assert.Error(t, start("unix:"+file))
+	_, err := os.Stat(file)
+	assert.NoError(t, err)
+
+	// сокет от предыдущего запуска заменяется
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	assert.NoError(t, start("unix:"+socket))
+
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// сокет, который слушает другой процесс, не удаляется
+	busy := filepath.Join(t.TempDir(), "busy.sock")
+	ln, err = net.Listen("unix", busy)
+	require.NoError(t, err)
+	defer ln.Close()
+	assert.Error(t, start("unix:"+busy))
+	conn, err := net.Dial("unix", busy)
+	require.NoError(t, err)
+	conn.Close()
+}
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"math/rand/v2"
+	"runtime"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+)
+
+func init() {
+	RegisterCollector("runtime", newRuntimeCollector, true)
+}
+
+// runtimeCollector собирает статистику распределения памяти через runtime.ReadMemStats.
+type runtimeCollector struct{}
+
+func newRuntimeCollector(cfg *config.Config) (Collector, error) {
+	return runtimeCollector{}, nil
+}
+
+func (runtimeCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	var s runtime.MemStats
+	runtime.ReadMemStats(&s)
+
+	return []models.Metrics{
+		newGauge("Alloc", float64(s.Alloc)),
+		newGauge("BuckHashSys", float64(s.BuckHashSys)),
+		newGauge("GCCPUFraction", s.GCCPUFraction),
+		newGauge("HeapAlloc", float64(s.HeapAlloc)),
+		newGauge("HeapIdle", float64(s.HeapIdle)),
+		newGauge("HeapInuse", float64(s.HeapInuse)),
+		newGauge("HeapObjects", float64(s.HeapObjects)),
+		newGauge("HeapReleased", float64(s.HeapReleased)),
+		newGauge("HeapSys", float64(s.HeapSys)),
+		newGauge("LastGC", float64(s.LastGC)),
+		newGauge("Lookups", float64(s.Lookups)),
+		newGauge("MCacheInuse", float64(s.MCacheInuse)),
+		newGauge("MCacheSys", float64(s.MCacheSys)),
+		newGauge("MSpanInuse", float64(s.MSpanInuse)),
+		newGauge("MSpanSys", float64(s.MSpanSys)),
+		newGauge("Mallocs", float64(s.Mallocs)),
+		newGauge("NextGC", float64(s.NextGC)),
+		newGauge("NumForcedGC", float64(s.NumForcedGC)),
+		newGauge("NumGC", float64(s.NumGC)),
+		newGauge("OtherSys", float64(s.OtherSys)),
+		newGauge("PauseTotalNs", float64(s.PauseTotalNs)),
+		newGauge("StackInuse", float64(s.StackInuse)),
+		newGauge("StackSys", float64(s.StackSys)),
+		newGauge("Sys", float64(s.Sys)),
+		newGauge("TotalAlloc", float64(s.TotalAlloc)),
+		newGauge("Frees", float64(s.Frees)),
+		newGauge("GCSys", float64(s.GCSys)),
+		newGauge("RandomValue", rand.Float64()),
+		newCounter("PollCount", 1),
+	}, nil
+}
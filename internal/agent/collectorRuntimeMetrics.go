@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"math"
+	"runtime/metrics"
+	"strconv"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+)
+
+func init() {
+	RegisterCollector("runtime_metrics", newRuntimeMetricsCollector, false)
+}
+
+// runtimeMetricNames сопоставляет метрики пакета runtime/metrics с именами метрик агента.
+// Для одной метрики агента можно указать несколько источников: используется первый
+// поддерживаемый текущей версией Go.
+var runtimeMetricNames = []struct {
+	id      string
+	sources []string
+}{
+	{id: "Goroutines", sources: []string{"/sched/goroutines:goroutines"}},
+	{id: "GOMAXPROCS", sources: []string{"/sched/gomaxprocs:threads"}},
+	{id: "GCHeapGoal", sources: []string{"/gc/heap/goal:bytes"}},
+	{id: "GCHeapLive", sources: []string{"/gc/heap/live:bytes"}},
+	{id: "RuntimeMemoryTotal", sources: []string{"/memory/classes/total:bytes"}},
+	{id: "GCCycles", sources: []string{"/gc/cycles/total:gc-cycles"}},
+	{id: "GCHeapAllocBytes", sources: []string{"/gc/heap/allocs:bytes"}},
+	{id: "MutexWaitNs", sources: []string{"/sync/mutex/wait/total:seconds"}},
+	{id: "SchedLatency", sources: []string{"/sched/latencies:seconds"}},
+	{id: "GCPause", sources: []string{"/sched/pauses/total/gc:seconds", "/gc/pauses:seconds"}},
+}
+
+// runtimeQuantiles задаёт квантили, в которые преобразуются гистограммы.
+var runtimeQuantiles = []float64{0.5, 0.9, 0.99}
+
+// runtimeMetricsCollector собирает метрики среды выполнения через runtime/metrics, не
+// останавливая программу, в отличие от runtime.ReadMemStats. Мгновенные значения
+// передаются как gauge, накопительные — как приращения counter. Гистограммы
+// преобразуются в gauge квантилей (в секундах) за интервал между опросами и counter
+// числа событий.
+type runtimeMetricsCollector struct {
+	samples    []metrics.Sample
+	ids        map[string]string
+	cumulative map[string]bool
+
+	prevHist map[string][]uint64
+	counters deltaTracker
+}
+
+func newRuntimeMetricsCollector(cfg *config.Config) (Collector, error) {
+	supported := make(map[string]metrics.Description)
+	for _, d := range metrics.All() {
+		supported[d.Name] = d
+	}
+
+	c := &runtimeMetricsCollector{
+		ids:        make(map[string]string),
+		cumulative: make(map[string]bool),
+		prevHist:   make(map[string][]uint64),
+		counters:   make(deltaTracker),
+	}
+	for _, m := range runtimeMetricNames {
+		for _, source := range m.sources {
+			d, ok := supported[source]
+			if !ok {
+				continue
+			}
+			c.samples = append(c.samples, metrics.Sample{Name: source})
+			c.ids[source] = m.id
+			c.cumulative[source] = d.Cumulative
+			break
+		}
+	}
+
+	return c, nil
+}
+
+func (c *runtimeMetricsCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	metrics.Read(c.samples)
+
+	var result []models.Metrics
+	for _, s := range c.samples {
+		id := c.ids[s.Name]
+
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			v := s.Value.Uint64()
+			if !c.cumulative[s.Name] {
+				result = append(result, newGauge(id, float64(v)))
+				continue
+			}
+			if d, ok := c.counters.delta(id, v); ok {
+				result = append(result, newCounter(id, d))
+			}
+
+		case metrics.KindFloat64:
+			v := s.Value.Float64()
+			if !c.cumulative[s.Name] {
+				result = append(result, newGauge(id, v))
+				continue
+			}
+			// накопительные значения в секундах передаются приращением в наносекундах
+			if d, ok := c.counters.delta(id, uint64(v*1e9)); ok {
+				result = append(result, newCounter(id, d))
+			}
+
+		case metrics.KindFloat64Histogram:
+			result = append(result, c.histogram(id, s.Value.Float64Histogram())...)
+		}
+	}
+
+	return result, nil
+}
+
+// histogram вычисляет квантили по событиям, попавшим в гистограмму с предыдущего опроса.
+func (c *runtimeMetricsCollector) histogram(id string, h *metrics.Float64Histogram) []models.Metrics {
+	prev, observed := c.prevHist[id]
+	counts := make([]uint64, len(h.Counts))
+	copy(counts, h.Counts)
+	c.prevHist[id] = counts
+
+	if !observed || len(prev) != len(counts) {
+		return nil
+	}
+
+	interval := make([]uint64, len(counts))
+	var total uint64
+	for i := range counts {
+		if counts[i] >= prev[i] {
+			interval[i] = counts[i] - prev[i]
+		}
+		total += interval[i]
+	}
+
+	metrics := []models.Metrics{newCounter(id+"Count", int64(total))}
+	if total == 0 {
+		return metrics
+	}
+	for _, q := range runtimeQuantiles {
+		name := id + "P" + strconv.FormatFloat(q*100, 'f', -1, 64)
+		metrics = append(metrics, newGauge(name, histogramQuantile(q, interval, h.Buckets)))
+	}
+	return metrics
+}
+
+// histogramQuantile возвращает верхнюю границу корзины, в которую попадает квантиль q.
+// Для последней, неограниченной сверху корзины возвращается её нижняя граница.
+func histogramQuantile(q float64, counts []uint64, buckets []float64) float64 {
+	var total uint64
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, n := range counts {
+		seen += n
+		if seen < rank || n == 0 {
+			continue
+		}
+		upper := buckets[i+1]
+		if math.IsInf(upper, 1) {
+			return buckets[i]
+		}
+		return upper
+	}
+	return buckets[len(buckets)-1]
+}
@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+)
+
+func TestRuntimeMetricsCollector(t *testing.T) {
+	c, err := newRuntimeMetricsCollector(&config.Config{})
+	require.NoError(t, err)
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	byID := metricsByID(metrics)
+
+	assert.GreaterOrEqual(t, *byID["Goroutines"].Value, 1.0)
+	assert.GreaterOrEqual(t, *byID["GOMAXPROCS"].Value, 1.0)
+	// накопительные значения при первом опросе не передаются
+	assert.NotContains(t, byID, "GCCycles")
+	assert.NotContains(t, byID, "GCPauseCount")
+
+	runtime.GC()
+
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	byID = metricsByID(metrics)
+
+	assert.GreaterOrEqual(t, *byID["GCCycles"].Delta, int64(1))
+	assert.GreaterOrEqual(t, *byID["GCPauseCount"].Delta, int64(1))
+	assert.Contains(t, byID, "GCPauseP50")
+	assert.Contains(t, byID, "GCPauseP99")
+	assert.LessOrEqual(t, *byID["GCPauseP50"].Value, *byID["GCPauseP99"].Value)
+	assert.Contains(t, byID, "MutexWaitNs")
+	assert.Contains(t, byID, "SchedLatencyCount")
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := []float64{0, 1, 2, 4, math.Inf(1)}
+
+	testCases := []struct {
+		name     string
+		q        float64
+		counts   []uint64
+		expected float64
+	}{
+		{name: "median", q: 0.5, counts: []uint64{5, 3, 2, 0}, expected: 1},
+		{name: "p90", q: 0.9, counts: []uint64{5, 3, 2, 0}, expected: 4},
+		{name: "unbounded_bucket", q: 0.99, counts: []uint64{1, 0, 0, 1}, expected: 4},
+		{name: "empty", q: 0.5, counts: []uint64{0, 0, 0, 0}, expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, histogramQuantile(tc.q, tc.counts, buckets))
+		})
+	}
+}
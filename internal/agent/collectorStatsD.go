@@ -0,0 +1,437 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	statsdMaxPacketSize = 65535
+	// statsdMaxTimerSamples ограничивает число значений таймера, хранимых для расчёта
+	// квантилей за интервал; число, сумма, минимум и максимум учитывают все значения.
+	statsdMaxTimerSamples = 10000
+	// statsdDefaultMaxSeries — число серий по умолчанию, сверх которого новые серии отбрасываются.
+	statsdDefaultMaxSeries = 10000
+	// statsdDefaultGaugeTTL — через сколько интервалов отправки без обновления по умолчанию
+	// перестают отправляться gauge.
+	statsdDefaultGaugeTTL = 10
+)
+
+// statsdQuantiles задаёт квантили, вычисляемые для таймеров.
+var statsdQuantiles = []float64{0.5, 0.9, 0.99}
+
+var errInvalidStatsDLine = errors.New("invalid statsd line")
+
+func init() {
+	RegisterCollector("statsd", newStatsDCollector, true)
+}
+
+// statsdGauge хранит значение gauge и интервал отправки, в котором оно обновлялось.
+type statsdGauge struct {
+	value   float64
+	updated int64
+}
+
+// statsdCounter накапливает приращение counter. Дробный остаток после отправки целой
+// части переносится в следующий интервал.
+type statsdCounter struct {
+	sum     float64
+	updated int64
+}
+
+// statsdTimer накапливает значения таймера за интервал между отправками.
+type statsdTimer struct {
+	count   int64 // число событий с учётом частоты выборки
+	n       int64 // число принятых значений
+	sum     float64
+	min     float64
+	max     float64
+	samples []float64
+}
+
+// statsdCollector принимает метрики по протоколу StatsD (с тегами DogStatsD) по UDP и
+// агрегирует их между отправками: gauge сохраняют последнее значение, counter суммируются
+// с учётом частоты выборки, для таймеров вычисляются число, минимум, максимум, среднее и
+// квантили, для множеств — число уникальных значений.
+//
+// Число серий ограничено maxSeries: значения новых серий сверх него отбрасываются и
+// учитываются в StatsDDroppedSeries. Gauge, а также агрегаты таймеров и множеств, которые
+// не обновлялись gaugeTTL интервалов отправки, перестают отправляться, и агент удаляет
+// их последние значения.
+type statsdCollector struct {
+	address   string
+	conn      net.PacketConn
+	maxSeries int
+	gaugeTTL  int64
+
+	mu       sync.Mutex
+	round    int64 // номер текущего интервала отправки
+	gauges   map[string]*statsdGauge
+	counters map[string]*statsdCounter
+	timers   map[string]*statsdTimer
+	sets     map[string]map[string]struct{}
+	derived  map[string]int64 // gauge таймеров и множеств и интервал их последней отправки
+	expired  []string
+	invalid  int64
+	dropped  int64
+}
+
+func newStatsDCollector(cfg *config.Config) (Collector, error) {
+	if cfg.Agent.StatsDAddress == "" {
+		return nil, nil
+	}
+
+	maxSeries := cfg.Agent.StatsDMaxSeries
+	if maxSeries <= 0 {
+		maxSeries = statsdDefaultMaxSeries
+	}
+	gaugeTTL := cfg.Agent.StatsDGaugeTTL
+	if gaugeTTL <= 0 {
+		gaugeTTL = statsdDefaultGaugeTTL
+	}
+
+	return &statsdCollector{
+		address:   cfg.Agent.StatsDAddress,
+		maxSeries: maxSeries,
+		gaugeTTL:  int64(gaugeTTL),
+		gauges:    make(map[string]*statsdGauge),
+		counters:  make(map[string]*statsdCounter),
+		timers:    make(map[string]*statsdTimer),
+		sets:      make(map[string]map[string]struct{}),
+		derived:   make(map[string]int64),
+	}, nil
+}
+
+// Start открывает UDP-сокет и принимает пакеты до отмены ctx.
+func (c *statsdCollector) Start(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", c.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen statsd: %w", err)
+	}
+	c.conn = conn
+	logger.Log.Info("StatsD listener started", zap.String("address", conn.LocalAddr().String()))
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go func() {
+		buf := make([]byte, statsdMaxPacketSize)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Log.Error("StatsD listener stopped", zap.Error(err))
+				}
+				return
+			}
+			c.handlePacket(buf[:n])
+		}
+	}()
+
+	return nil
+}
+
+// Addr возвращает адрес, на котором принимаются пакеты.
+func (c *statsdCollector) Addr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// handlePacket разбирает пакет, содержащий одну или несколько строк метрик.
+func (c *statsdCollector) handlePacket(packet []byte) {
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		// события и проверки сервисов DogStatsD не являются метриками
+		if line == "" || strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+			continue
+		}
+		if err := c.handleLine(line); err != nil {
+			logger.Log.Debug("Invalid statsd line", zap.String("line", line), zap.Error(err))
+			c.mu.Lock()
+			c.invalid++
+			c.mu.Unlock()
+		}
+	}
+}
+
+// handleLine разбирает строку формата name:value|type[|@rate][|#tag1:value1,tag2].
+func (c *statsdCollector) handleLine(line string) error {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return errInvalidStatsDLine
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return errInvalidStatsDLine
+	}
+	value, metricType := parts[0], parts[1]
+
+	rate := 1.0
+	var tags map[string]string
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			r, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || r <= 0 || r > 1 {
+				return fmt.Errorf("%w: sample rate %q", errInvalidStatsDLine, p)
+			}
+			rate = r
+		case strings.HasPrefix(p, "#"):
+			tags = parseStatsDTags(p[1:])
+		}
+	}
+	id := models.SeriesID(models.SanitizeLabel(name), tags)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch metricType {
+	case "g":
+		v, err := parseStatsDValue(value)
+		if err != nil {
+			return err
+		}
+		g, ok := c.gauges[id]
+		// значение со знаком изменяет gauge относительно текущего значения
+		if ok && (strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")) {
+			v += g.value
+		}
+		if math.IsInf(v, 0) {
+			return fmt.Errorf("%w: gauge overflow", errInvalidStatsDLine)
+		}
+		if !ok {
+			if !c.admit() {
+				return nil
+			}
+			g = &statsdGauge{}
+			c.gauges[id] = g
+		}
+		g.value = v
+		g.updated = c.round
+
+	case "c":
+		v, err := parseStatsDValue(value)
+		if err != nil {
+			return err
+		}
+		counter, ok := c.counters[id]
+		sum := v / rate
+		if ok {
+			sum += counter.sum
+		}
+		// накопленное приращение должно помещаться в int64 при отправке
+		if math.Abs(sum) >= math.MaxInt64 {
+			return fmt.Errorf("%w: counter out of int64 range", errInvalidStatsDLine)
+		}
+		if !ok {
+			if !c.admit() {
+				return nil
+			}
+			counter = &statsdCounter{}
+			c.counters[id] = counter
+		}
+		counter.sum = sum
+		counter.updated = c.round
+
+	case "ms", "h", "d":
+		v, err := parseStatsDValue(value)
+		if err != nil {
+			return err
+		}
+		t, ok := c.timers[id]
+		if ok && math.IsInf(t.sum+v, 0) {
+			return fmt.Errorf("%w: timer sum overflow", errInvalidStatsDLine)
+		}
+		if !ok && !c.admit() {
+			return nil
+		}
+		c.observeTimer(id, v, rate)
+
+	case "s":
+		set, ok := c.sets[id]
+		if !ok {
+			if !c.admit() {
+				return nil
+			}
+			set = make(map[string]struct{})
+			c.sets[id] = set
+		}
+		set[value] = struct{}{}
+
+	default:
+		return fmt.Errorf("%w: unknown type %q", errInvalidStatsDLine, metricType)
+	}
+
+	return nil
+}
+
+// parseStatsDValue разбирает числовое значение строки. NaN и бесконечности не имеют
+// смысла для метрик сервера и отклоняются.
+func parseStatsDValue(value string) (float64, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errInvalidStatsDLine, err)
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("%w: non-finite value %q", errInvalidStatsDLine, value)
+	}
+	return v, nil
+}
+
+// admit сообщает, можно ли добавить новую серию, и учитывает отброшенные значения.
+// Вызывается под мьютексом.
+func (c *statsdCollector) admit() bool {
+	if len(c.gauges)+len(c.counters)+len(c.timers)+len(c.sets) < c.maxSeries {
+		return true
+	}
+	c.dropped++
+	return false
+}
+
+func (c *statsdCollector) observeTimer(id string, v float64, rate float64) {
+	t, ok := c.timers[id]
+	if !ok {
+		t = &statsdTimer{min: v, max: v}
+		c.timers[id] = t
+	}
+
+	t.count += int64(math.Round(1 / rate))
+	t.n++
+	t.sum += v
+	t.min = math.Min(t.min, v)
+	t.max = math.Max(t.max, v)
+	if len(t.samples) < statsdMaxTimerSamples {
+		t.samples = append(t.samples, v)
+	}
+}
+
+// Collect возвращает метрики, накопленные с предыдущего вызова, и завершает интервал
+// отправки. Gauge сохраняются между вызовами, пока не устареют, у counter отправляется
+// целая часть приращения, остальные агрегаты сбрасываются.
+func (c *statsdCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var metrics []models.Metrics
+	for id, g := range c.gauges {
+		if c.round-g.updated >= c.gaugeTTL {
+			delete(c.gauges, id)
+			c.expired = append(c.expired, id)
+			continue
+		}
+		metrics = append(metrics, newGauge(id, g.value))
+	}
+
+	for id, counter := range c.counters {
+		delta := math.Trunc(counter.sum)
+		if delta != 0 {
+			metrics = append(metrics, newCounter(id, int64(delta)))
+			counter.sum -= delta
+		}
+		if counter.sum == 0 || c.round-counter.updated >= c.gaugeTTL {
+			delete(c.counters, id)
+		}
+	}
+
+	for id, t := range c.timers {
+		name, labels := splitSeriesID(id)
+		metrics = append(metrics,
+			newCounter(name+".count"+labels, t.count),
+			c.derivedGauge(name+".min"+labels, t.min),
+			c.derivedGauge(name+".max"+labels, t.max),
+			c.derivedGauge(name+".mean"+labels, t.sum/float64(t.n)),
+		)
+		sort.Float64s(t.samples)
+		for _, q := range statsdQuantiles {
+			suffix := ".p" + strconv.FormatFloat(q*100, 'f', -1, 64)
+			metrics = append(metrics, c.derivedGauge(name+suffix+labels, sampleQuantile(q, t.samples)))
+		}
+	}
+
+	for id, set := range c.sets {
+		metrics = append(metrics, c.derivedGauge(id, float64(len(set))))
+	}
+
+	for id, sent := range c.derived {
+		if c.round-sent >= c.gaugeTTL {
+			delete(c.derived, id)
+			c.expired = append(c.expired, id)
+		}
+	}
+
+	if c.invalid > 0 {
+		metrics = append(metrics, newCounter("StatsDInvalidLines", c.invalid))
+	}
+	if c.dropped > 0 {
+		metrics = append(metrics, newCounter("StatsDDroppedSeries", c.dropped))
+	}
+
+	c.timers = make(map[string]*statsdTimer)
+	c.sets = make(map[string]map[string]struct{})
+	c.invalid = 0
+	c.dropped = 0
+	c.round++
+
+	return metrics, nil
+}
+
+// derivedGauge создаёт gauge агрегата таймера или множества и запоминает интервал его
+// отправки. Вызывается под мьютексом.
+func (c *statsdCollector) derivedGauge(id string, value float64) models.Metrics {
+	c.derived[id] = c.round
+	return newGauge(id, value)
+}
+
+// Expired возвращает gauge, которые устарели при последних вызовах Collect.
+func (c *statsdCollector) Expired() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expired := c.expired
+	c.expired = nil
+	return expired
+}
+
+// parseStatsDTags разбирает теги DogStatsD вида key1:value1,key2.
+func parseStatsDTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		if tag == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(tag, ":")
+		tags[models.SanitizeLabel(k)] = models.SanitizeLabel(v)
+	}
+	return tags
+}
+
+// splitSeriesID отделяет имя метрики от меток, чтобы добавить к имени суффикс агрегата.
+func splitSeriesID(id string) (string, string) {
+	if i := strings.IndexByte(id, '{'); i >= 0 {
+		return id[:i], id[i:]
+	}
+	return id, ""
+}
+
+// sampleQuantile возвращает квантиль q отсортированной выборки.
+func sampleQuantile(q float64, sorted []float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
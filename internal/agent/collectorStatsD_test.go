@@ -0,0 +1,217 @@
+package agent
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+)
+
+func newTestStatsD(t *testing.T) *statsdCollector {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Agent.StatsDAddress = "127.0.0.1:0"
+	c, err := newStatsDCollector(cfg)
+	require.NoError(t, err)
+	return c.(*statsdCollector)
+}
+
+func TestStatsDCollector_Aggregation(t *testing.T) {
+	c := newTestStatsD(t)
+
+	c.handlePacket([]byte(`requests:1|c
+requests:2|c|@0.5
+requests:1|c|#env:prod,canary
+temperature:20|g
+temperature:+5|g
+latency:10|ms
+latency:20|ms
+latency:30|ms|#env:prod
+users:alice|s
+users:bob|s
+users:alice|s
+_e{5,4}:title|text
+broken
+bad:1|x`))
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	byID := metricsByID(metrics)
+
+	assert.Equal(t, int64(5), *byID["requests"].Delta)
+	assert.Equal(t, int64(1), *byID["requests{canary,env=prod}"].Delta)
+	assert.Equal(t, 25.0, *byID["temperature"].Value)
+	assert.Equal(t, int64(2), *byID["latency.count"].Delta)
+	assert.Equal(t, 10.0, *byID["latency.min"].Value)
+	assert.Equal(t, 20.0, *byID["latency.max"].Value)
+	assert.Equal(t, 15.0, *byID["latency.mean"].Value)
+	assert.Equal(t, 10.0, *byID["latency.p50"].Value)
+	assert.Equal(t, 20.0, *byID["latency.p99"].Value)
+	assert.Equal(t, int64(1), *byID["latency.count{env=prod}"].Delta)
+	assert.Equal(t, 2.0, *byID["users"].Value)
+	assert.Equal(t, int64(2), *byID["StatsDInvalidLines"].Delta)
+
+	// после сбора сохраняются только gauge
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	byID = metricsByID(metrics)
+	assert.Len(t, byID, 1)
+	assert.Equal(t, 25.0, *byID["temperature"].Value)
+}
+
+func TestStatsDCollector_ShipsThroughAgent(t *testing.T) {
+	srv := &counterServer{counters: make(map[string]int64)}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	a := newTestAgent(t, ts.URL)
+	c := newTestStatsD(t)
+	require.NoError(t, c.Start(a.ctx))
+	a.collectors = []collectorRunner{{name: "statsd", collector: c}}
+
+	conn, err := net.Dial("udp", c.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("jobs:3|c\njobs:4|c"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		jobs := c.counters["jobs"]
+		return jobs != nil && jobs.sum == 7
+	}, time.Second, 10*time.Millisecond)
+
+	a.collectListeners()
+	require.NoError(t, a.deliverBatch(a.takeBatch()))
+	assert.Equal(t, int64(7), srv.counters["jobs"])
+}
+
+func TestStatsDCollector_SeriesLimit(t *testing.T) {
+	c := newTestStatsD(t)
+	c.maxSeries = 2
+
+	c.handlePacket([]byte("a:1|g\nb:1|c\nc:1|g\nd:1|ms\na:2|g\nb:1|c"))
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	byID := metricsByID(metrics)
+
+	// значения существующих серий принимаются, новые серии сверх лимита отбрасываются
+	assert.Equal(t, 2.0, *byID["a"].Value)
+	assert.Equal(t, int64(2), *byID["b"].Delta)
+	assert.NotContains(t, byID, "c")
+	assert.NotContains(t, byID, "d.count")
+	assert.Equal(t, int64(2), *byID["StatsDDroppedSeries"].Delta)
+}
+
+func TestStatsDCollector_TagEscaping(t *testing.T) {
+	c := newTestStatsD(t)
+
+	c.handlePacket([]byte("requests:1|c|#path:/a=b,query:x}y\nreq{x}:1|c"))
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	byID := metricsByID(metrics)
+
+	assert.Contains(t, byID, "requests{path=/a_b,query=x_y}")
+	assert.Contains(t, byID, "req_x_")
+}
+
+func TestStatsDCollector_CounterRemainder(t *testing.T) {
+	c := newTestStatsD(t)
+
+	// 0.3 / 0.5 = 0.6 за интервал: остаток переносится, а не округляется
+	c.handlePacket([]byte("jobs:0.3|c|@0.5"))
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.NotContains(t, metricsByID(metrics), "jobs")
+
+	c.handlePacket([]byte("jobs:0.3|c|@0.5"))
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *metricsByID(metrics)["jobs"].Delta)
+
+	c.mu.Lock()
+	assert.InDelta(t, 0.2, c.counters["jobs"].sum, 1e-9)
+	c.mu.Unlock()
+}
+
+func TestStatsDCollector_InvalidValues(t *testing.T) {
+	testCases := []struct {
+		name  string
+		lines string
+	}{
+		{name: "nan_counter", lines: "x:NaN|c"},
+		{name: "huge_counter", lines: "x:1e300|c"},
+		{name: "counter_overflow", lines: "x:9e18|c\nx:9e18|c"},
+		{name: "tiny_rate", lines: "x:1e10|c|@1e-10"},
+		{name: "inf_gauge", lines: "x:Inf|g"},
+		{name: "nan_gauge", lines: "x:nan|g"},
+		{name: "gauge_overflow", lines: "x:1e308|g\nx:+1e308|g"},
+		{name: "inf_timer", lines: "x:-Inf|ms"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestStatsD(t)
+			c.handlePacket([]byte(tc.lines))
+
+			metrics, err := c.Collect(context.Background())
+			require.NoError(t, err)
+			byID := metricsByID(metrics)
+
+			// строка отбрасывается и учитывается как ошибочная, принятые значения не меняются
+			require.Contains(t, byID, "StatsDInvalidLines")
+			assert.Equal(t, int64(1), *byID["StatsDInvalidLines"].Delta)
+			if m, ok := byID["x"]; ok {
+				if m.Value != nil {
+					assert.Equal(t, 1e308, *m.Value)
+				} else {
+					assert.Equal(t, int64(9e18), *m.Delta)
+				}
+			}
+			for _, m := range metrics {
+				if m.Value != nil {
+					assert.False(t, math.IsNaN(*m.Value) || math.IsInf(*m.Value, 0), m.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestStatsDCollector_GaugeExpiry(t *testing.T) {
+	srv := &counterServer{counters: make(map[string]int64)}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	a := newTestAgent(t, ts.URL)
+	c := newTestStatsD(t)
+	c.gaugeTTL = 2
+	a.collectors = []collectorRunner{{name: "statsd", collector: c}}
+
+	c.handlePacket([]byte("temperature:20|g\nlatency:10|ms"))
+	a.collectListeners()
+	require.Contains(t, a.Metrics, "temperature")
+	require.Contains(t, a.Metrics, "latency.mean")
+
+	// через gaugeTTL интервалов без обновлений gauge удаляются и из агента
+	a.collectListeners()
+	assert.Contains(t, a.Metrics, "temperature")
+	a.collectListeners()
+	assert.NotContains(t, a.Metrics, "temperature")
+	assert.NotContains(t, a.Metrics, "latency.mean")
+
+	// обновлённый gauge снова отправляется
+	c.handlePacket([]byte("temperature:21|g"))
+	a.collectListeners()
+	assert.Equal(t, 21.0, a.Metrics["temperature"])
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+)
+
+// Способы добавления идентификатора агента к именам метрик
+const (
+	instanceModePrefix = "prefix"
+	instanceModeLabels = "labels"
+)
+
+// identity добавляет идентификатор агента и его теги к именам метрик, чтобы метрики
+// разных агентов не перезаписывали друг друга на сервере.
+type identity struct {
+	id     string
+	labels bool
+	tags   map[string]string
+}
+
+// newIdentity создаёт identity по конфигурации. При пустом режиме возвращается nil.
+func newIdentity(cfg config.InstanceConfig) (*identity, error) {
+	if cfg.Mode == "" {
+		return nil, nil
+	}
+	if cfg.Mode != instanceModePrefix && cfg.Mode != instanceModeLabels {
+		return nil, fmt.Errorf("unknown instance mode %q", cfg.Mode)
+	}
+
+	id := cfg.ID
+	if id == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get hostname: %w", err)
+		}
+		id = hostname
+	}
+	// идентификатор должен однозначно выделяться из имени метрики
+	if strings.ContainsAny(id, models.InstanceSeparator+"{},=") {
+		return nil, fmt.Errorf("instance id %q must not contain %q or label delimiters", id, models.InstanceSeparator)
+	}
+
+	return &identity{id: id, labels: cfg.Mode == instanceModeLabels, tags: cfg.Tags}, nil
+}
+
+// apply возвращает имя метрики с идентификатором агента. Теги объединяются с метками
+// метрики, при совпадении ключей сохраняется метка метрики. В режиме меток метка
+// instance всегда содержит идентификатор агента.
+func (i *identity) apply(id string) string {
+	if i == nil {
+		return id
+	}
+
+	name, labels := models.ParseSeriesID(id)
+	if labels == nil {
+		labels = make(map[string]string, len(i.tags)+1)
+	}
+	for k, v := range i.tags {
+		if _, ok := labels[k]; !ok {
+			labels[k] = v
+		}
+	}
+
+	if i.labels {
+		labels[models.InstanceLabel] = i.id
+		return models.SeriesID(name, labels)
+	}
+	return models.SeriesID(i.id+models.InstanceSeparator+name, labels)
+}
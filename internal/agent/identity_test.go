@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+)
+
+func TestIdentity_Apply(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cfg      config.InstanceConfig
+		id       string
+		expected string
+	}{
+		{name: "disabled", cfg: config.InstanceConfig{ID: "web-1"}, id: "Alloc", expected: "Alloc"},
+		{name: "prefix", cfg: config.InstanceConfig{ID: "web-1", Mode: "prefix"}, id: "Alloc", expected: "web-1@Alloc"},
+		{
+			name:     "prefix_with_tags",
+			cfg:      config.InstanceConfig{ID: "web-1", Mode: "prefix", Tags: map[string]string{"dc": "eu"}},
+			id:       "requests{env=prod}",
+			expected: "web-1@requests{dc=eu,env=prod}",
+		},
+		{
+			name:     "labels",
+			cfg:      config.InstanceConfig{ID: "web-1", Mode: "labels", Tags: map[string]string{"dc": "eu", "env": "dev"}},
+			id:       "requests{env=prod}",
+			expected: "requests{dc=eu,env=prod,instance=web-1}",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ident, err := newIdentity(tc.cfg)
+			require.NoError(t, err)
+
+			id := ident.apply(tc.id)
+			assert.Equal(t, tc.expected, id)
+
+			if tc.cfg.Mode != "" {
+				instance, _, ok := models.SplitInstance(id)
+				assert.True(t, ok)
+				assert.Equal(t, tc.cfg.ID, instance)
+			}
+		})
+	}
+}
+
+func TestIdentity_Defaults(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	ident, err := newIdentity(config.InstanceConfig{Mode: "prefix"})
+	require.NoError(t, err)
+	assert.Equal(t, hostname+"@Alloc", ident.apply("Alloc"))
+
+	_, err = newIdentity(config.InstanceConfig{Mode: "suffix"})
+	assert.Error(t, err)
+
+	_, err = newIdentity(config.InstanceConfig{ID: "web@1", Mode: "prefix"})
+	assert.Error(t, err)
+}
@@ -1,43 +1,59 @@
 package agent
 
 import (
-	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/Himany/go-musthave-metrics-tpl/internal/compress"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/retry"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/sign"
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
 )
 
 var ErrEmptyMetrics = errors.New("empty metrics")
 
-func (a *Agent) retryGzipJSONRequest(body []byte, route string, hash []byte) (*resty.Response, time.Duration, error) {
-	start := time.Now()
+// ErrUnexpectedStatus возвращается, когда сервер ответил ошибкой, означающей его недоступность.
+var ErrUnexpectedStatus = errors.New("unexpected response status")
+
+// ErrBatchTooLarge возвращается, когда сервер отклонил пакет из-за размера (413).
+var ErrBatchTooLarge = errors.New("batch too large")
+
+// retryCompressedJSONRequest отправляет сжатое тело с повторами. Заголовки подписи
+// одинаковы для всех попыток: если сервер уже принял запрос, повтор отклоняется как
+// повторно отправленный, и приращения counter не учитываются дважды.
+func (a *Agent) retryCompressedJSONRequest(body []byte, route string, signature map[string]string) (*resty.Response, retry.Result, error) {
 	var lastResp *resty.Response
 
-	err := retry.WithRetry(func() error {
+	// повторы прерываются, только если остановка агента длится дольше stopTimeout
+	result, err := a.RetryPolicy.Do(a.sendCtx, func() error {
 		request := a.Client.R().
-			SetHeader("Content-Encoding", "gzip").
+			SetContext(a.sendCtx).
+			SetHeader("Content-Encoding", a.Codec.Name()).
 			SetHeader("Content-Type", "application/json").
+			SetHeaders(signature).
 			SetBody(body)
 
-		if hash != nil {
-			request.SetHeader("HashSHA256", hex.EncodeToString(hash))
-		}
-
 		resp, reqErr := request.Post(a.URL + route)
 		lastResp = resp
-		return reqErr
+		if reqErr != nil {
+			return reqErr
+		}
+		if resp.StatusCode() >= http.StatusInternalServerError || resp.StatusCode() == http.StatusTooManyRequests {
+			return fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode())
+		}
+		return nil
 	}, func(err error) bool {
 		if err == nil {
 			return false
 		}
-		if lastResp != nil {
+		// при сетевой ошибке resty возвращает ответ без RawResponse и кода состояния
+		if lastResp != nil && lastResp.RawResponse != nil {
 			switch lastResp.StatusCode() {
 			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
 				return true
@@ -52,8 +68,7 @@ func (a *Agent) retryGzipJSONRequest(body []byte, route string, hash []byte) (*r
 		return true
 	}, "agent_http_request")
 
-	duration := time.Since(start)
-	return lastResp, duration, err
+	return lastResp, result, err
 }
 
 func (a *Agent) createBatchRequest(metrics []models.Metrics) error {
@@ -71,25 +86,51 @@ func (a *Agent) createBatchRequest(metrics []models.Metrics) error {
 		return err
 	}
 
-	hash := bodySignature(encryptedData, a.Key)
+	// сервер проверяет подпись после дешифрования, поэтому подписываются открытые данные
+	signature, err := sign.Headers(a.Key, jsonData, time.Now())
+	if err != nil {
+		return err
+	}
 
-	body, err := compressBody(encryptedData)
+	// сервер распаковывает тело до дешифрования, поэтому сжимается шифротекст,
+	// и при шифровании сжатие почти не уменьшает размер пакета
+	body, err := compress.Compress(a.Codec, encryptedData)
 	if err != nil {
 		return err
 	}
 
+	if err := a.Breaker.Allow(); err != nil {
+		return err
+	}
+
 	var route = "/updates/"
-	resp, duration, err := a.retryGzipJSONRequest(body, route, hash)
+	resp, result, err := a.retryCompressedJSONRequest(body, route, signature)
+	if err != nil {
+		a.Breaker.Failure()
+	} else {
+		a.Breaker.Success()
+	}
 
 	if err == nil && resp != nil {
-		logger.Log.Info("HTTP BATCH",
+		fields := []zap.Field{
 			zap.String("uri (request)", a.URL+route),
 			zap.String("method (request)", "POST"),
-			zap.Duration("duration", duration),
+			zap.Duration("duration", result.Elapsed),
+			zap.Int("attempts", result.Attempts),
 			zap.Int("status (answer)", resp.StatusCode()),
 			zap.Int("size (answer)", len(resp.Body())),
 			zap.String("body (answer)", resp.String()),
-		)
+		}
+		// слишком большой пакет агент делит на части и отправляет снова
+		if resp.StatusCode() == http.StatusRequestEntityTooLarge {
+			return fmt.Errorf("%w: %d metrics: %s", ErrBatchTooLarge, len(metrics), resp.String())
+		}
+		// остальные ответы 4xx не повторяются: сервер отклонил пакет, и его метрики потеряны
+		if !resp.IsSuccess() {
+			logger.Log.Error("HTTP BATCH rejected", fields...)
+			return nil
+		}
+		logger.Log.Info("HTTP BATCH", fields...)
 		return nil
 	}
 
@@ -114,28 +155,38 @@ func (a *Agent) createRequest(metricType string, name string, delta *int64, valu
 		return err
 	}
 
-	hash := bodySignature(encryptedData, a.Key)
+	// сервер проверяет подпись после дешифрования, поэтому подписываются открытые данные
+	signature, err := sign.Headers(a.Key, jsonData, time.Now())
+	if err != nil {
+		return err
+	}
 
-	body, err := compressBody(encryptedData)
+	body, err := compress.Compress(a.Codec, encryptedData)
 	if err != nil {
 		return err
 	}
 
 	var route = "/update/"
-	resp, duration, err := a.retryGzipJSONRequest(body, route, hash)
+	resp, result, err := a.retryCompressedJSONRequest(body, route, signature)
 
 	if err == nil && resp != nil {
 		logger.Log.Info("HTTP request",
 			zap.String("uri", a.URL+route),
 			zap.String("method", "POST"),
-			zap.Duration("duration", duration),
+			zap.Duration("duration", result.Elapsed),
+			zap.Int("attempts", result.Attempts),
 		)
 
-		logger.Log.Info("HTTP answer",
+		answer := []zap.Field{
 			zap.Int("status", resp.StatusCode()),
 			zap.Int("size", len(resp.Body())),
 			zap.String("body", resp.String()),
-		)
+		}
+		if !resp.IsSuccess() {
+			logger.Log.Error("HTTP request rejected", answer...)
+			return nil
+		}
+		logger.Log.Info("HTTP answer", answer...)
 
 		return nil
 	}
@@ -154,30 +205,27 @@ func (a *Agent) reportHandler() {
 		case <-a.ctx.Done():
 			return
 		case <-ticker.C:
-			a.mutex.Lock()
-
-			var batch []models.Metrics
-			for key, value := range a.Metrics {
-				val := value
-				batch = append(batch, models.Metrics{
-					ID:    key,
-					MType: "gauge",
-					Value: &val,
-				})
+			a.collectListeners()
+			batch := a.takeBatch()
+			if len(batch) == 0 {
+				continue
 			}
-			batch = append(batch, models.Metrics{
-				ID:    "PollCount",
-				MType: "counter",
-				Delta: &a.PollCount,
-			})
 
-			a.mutex.Unlock()
-
-			select {
-			case <-a.ctx.Done():
+			if !a.queueBatch(batch) {
 				return
-			case a.Tasks <- batch:
 			}
 		}
 	}
 }
+
+// queueBatch ставит пакет в очередь воркеров. Если агент останавливается, пока очередь
+// заполнена, приращения counter возвращаются в агент и уходят с последней отправкой.
+func (a *Agent) queueBatch(batch []models.Metrics) bool {
+	select {
+	case <-a.ctx.Done():
+		a.restoreBatch(batch)
+		return false
+	case a.Tasks <- batch:
+		return true
+	}
+}
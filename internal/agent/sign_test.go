@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/crypto"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/middleware"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/retry"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/sign"
+)
+
+func TestAgent_RetryIsNotCountedTwice(t *testing.T) {
+	counters := make(map[string]int64)
+	verifier := sign.NewVerifier("secret", time.Minute, false)
+
+	// тело распаковывается до проверки подписи, как в роутере сервера.
+	// Первый ответ теряется: сервер учитывает пакет, но обрывает соединение
+	var requests atomic.Int32
+	ts := httptest.NewServer(middleware.Gzip(middleware.CheckHash(verifier, func(w http.ResponseWriter, r *http.Request) {
+		var batch []models.Metrics
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		for _, m := range batch {
+			counters[m.ID] += *m.Delta
+		}
+		if requests.Add(1) == 1 {
+			panic(http.ErrAbortHandler)
+		}
+	})))
+	defer ts.Close()
+
+	a := newTestAgent(t, ts.URL)
+	a.Key = "secret"
+	a.RetryPolicy = retry.Policy{MaxAttempts: 2}
+
+	a.Counters["PollCount"] = 3
+	require.NoError(t, a.deliverBatch(a.takeBatch()))
+
+	assert.Equal(t, int32(1), requests.Load(), "retry must be rejected before reaching the handler")
+	assert.Equal(t, int64(3), counters["PollCount"])
+}
+
+func TestAgent_SignedEncryptedBatch(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	publicPath, privatePath := filepath.Join(dir, "public.pem"), filepath.Join(dir, "private.pem")
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o600))
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600))
+
+	ring, err := crypto.NewKeyRing(privatePath, "")
+	require.NoError(t, err)
+	verifier := sign.NewVerifier("secret", time.Minute, false)
+
+	// порядок middleware повторяет роутер сервера: распаковка, дешифрование, проверка подписи
+	counters := make(map[string]int64)
+	ts := httptest.NewServer(middleware.Gzip(middleware.DecryptBody(ring)(middleware.CheckHash(verifier, func(w http.ResponseWriter, r *http.Request) {
+		var batch []models.Metrics
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		for _, m := range batch {
+			counters[m.ID] += *m.Delta
+		}
+	}))))
+	defer ts.Close()
+
+	a := newTestAgent(t, ts.URL)
+	a.Key = "secret"
+	a.Encryptor, err = crypto.NewEncryptor(publicPath)
+	require.NoError(t, err)
+
+	a.Counters["PollCount"] = 3
+	require.NoError(t, a.deliverBatch(a.takeBatch()))
+	assert.Equal(t, int64(3), counters["PollCount"])
+}
@@ -0,0 +1,446 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"go.uber.org/zap"
+)
+
+// Ограничения очереди по умолчанию
+const (
+	defaultSpoolMaxBatches = 100
+	defaultSpoolMaxBytes   = 10 << 20
+	defaultSpoolMaxAge     = 24 * time.Hour
+)
+
+const spoolFileExt = ".json"
+
+// errBatchSpooled означает, что пакет не был отправлен, но сохранён в очередь и будет доставлен позже.
+var errBatchSpooled = errors.New("batch spooled")
+
+// spool — персистентная очередь неотправленных пакетов метрик.
+// Каждый пакет хранится в отдельном файле, имя которого начинается с времени создания,
+// поэтому лексикографический порядок файлов совпадает с порядком пакетов.
+type spool struct {
+	mu       sync.Mutex
+	replayMu sync.Mutex
+	dir      string
+	seq      uint64
+	pending  atomic.Int64
+	inflight map[string]bool
+
+	maxBatches   int
+	maxBytes     int64
+	maxAge       time.Duration
+	maxBatchSize int // наибольшее число метрик в одном запросе при отправке очереди, 0 — без ограничения
+}
+
+// spoolEntry описывает файл пакета в очереди.
+type spoolEntry struct {
+	name    string
+	size    int64
+	created time.Time
+}
+
+func newSpool(dir string, maxBatches int, maxBytes int64, maxAge time.Duration, maxBatchSize int) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+
+	if maxBatches <= 0 {
+		maxBatches = defaultSpoolMaxBatches
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultSpoolMaxBytes
+	}
+	if maxAge <= 0 {
+		maxAge = defaultSpoolMaxAge
+	}
+
+	s := &spool{
+		dir:          dir,
+		inflight:     make(map[string]bool),
+		maxBatches:   maxBatches,
+		maxBytes:     maxBytes,
+		maxAge:       maxAge,
+		maxBatchSize: maxBatchSize,
+	}
+
+	entries, err := s.entries()
+	if err != nil {
+		return nil, err
+	}
+	s.pending.Store(int64(len(entries)))
+	if len(entries) > 0 {
+		logger.Log.Info("Spool contains unsent batches", zap.String("dir", dir), zap.Int("count", len(entries)))
+	}
+
+	return s, nil
+}
+
+// Send отправляет пакет через send. Если в очереди есть неотправленные пакеты, они
+// объединяются с новым пакетом и отправляются частями не больше maxBatchSize метрик;
+// часть, отклонённая сервером как слишком большая, делится пополам. Файлы очереди
+// удаляются, когда доставлена хотя бы одна часть, а недоставленный остаток сохраняется
+// в очередь заново, поэтому доставленные приращения не отправляются повторно.
+// Если сервер недоступен, новый пакет сохраняется в очередь, а возвращаемая ошибка
+// оборачивает errBatchSpooled. Остальные ошибки возвращаются без изменений.
+func (s *spool) Send(batch []models.Metrics, send func([]models.Metrics) error) error {
+	if s.pending.Load() == 0 {
+		if err := send(batch); err != nil {
+			return s.storeFailed(batch, err)
+		}
+		return nil
+	}
+
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	stored, names := s.load()
+	if len(names) == 0 {
+		if err := send(batch); err != nil {
+			return s.storeFailed(batch, err)
+		}
+		return nil
+	}
+
+	merged := mergeBatches(append(stored, batch)...)
+	rest, err := s.sendParts(merged, send)
+	if err != nil && len(rest) == len(merged) {
+		s.release(names)
+		return s.storeFailed(batch, err)
+	}
+
+	s.remove(names)
+	if err != nil {
+		// часть метрик доставлена: остаток, в том числе метрики нового пакета, остаётся в очереди
+		if storeErr := s.store(rest); storeErr != nil {
+			logger.Log.Error("Failed to spool batch", zap.Error(storeErr))
+			return err
+		}
+		return fmt.Errorf("%w: %w", errBatchSpooled, err)
+	}
+
+	logger.Log.Info("Spooled batches replayed", zap.Int("batches", len(names)), zap.Int("metrics", len(merged)))
+	return nil
+}
+
+// sendParts отправляет пакет частями не больше maxBatchSize метрик. Часть, отклонённая
+// сервером как слишком большая, делится пополам, и следующие части отправляются того же
+// размера. Метрика, которую сервер не принимает даже одну, отбрасывается, чтобы она не
+// блокировала очередь. При ошибке возвращаются недоставленные метрики.
+func (s *spool) sendParts(batch []models.Metrics, send func([]models.Metrics) error) ([]models.Metrics, error) {
+	size := len(batch)
+	if s.maxBatchSize > 0 {
+		size = min(size, s.maxBatchSize)
+	}
+
+	for len(batch) > 0 {
+		n := min(size, len(batch))
+		err := send(batch[:n])
+		switch {
+		case errors.Is(err, ErrBatchTooLarge) && n > 1:
+			size = n / 2
+			logger.Log.Warn("Batch too large for server, splitting", zap.Int("metrics", n))
+			continue
+		case errors.Is(err, ErrBatchTooLarge):
+			logger.Log.Error("Metric too large for server, dropping", zap.String("id", batch[0].ID), zap.Error(err))
+		case err != nil:
+			return batch, err
+		}
+		batch = batch[n:]
+	}
+	return nil, nil
+}
+
+// storeFailed сохраняет неотправленный пакет и дополняет ошибку отправки результатом сохранения.
+func (s *spool) storeFailed(batch []models.Metrics, sendErr error) error {
+	if !spoolable(sendErr) {
+		return sendErr
+	}
+	if err := s.store(batch); err != nil {
+		logger.Log.Error("Failed to spool batch", zap.Error(err))
+		return sendErr
+	}
+	return fmt.Errorf("%w: %w", errBatchSpooled, sendErr)
+}
+
+// spoolable сообщает, что пакет не доставлен из-за недоступности сервера: сетевая ошибка,
+// ответ 5xx или 429 либо разомкнутый выключатель. Другие ошибки, например шифрования,
+// не исчезнут при повторной отправке, и пакет с ними не сохраняется в очередь.
+func spoolable(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, ErrUnexpectedStatus) || errors.Is(err, ErrCircuitOpen) || errors.As(err, &netErr)
+}
+
+// store сохраняет пакет в очередь и применяет ограничения по количеству, размеру и возрасту.
+func (s *spool) store(batch []models.Metrics) error {
+	if len(batch) == 0 {
+		return ErrEmptyMetrics
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.write(batch, time.Now()); err != nil {
+		return err
+	}
+
+	if err := s.enforceLimits(); err != nil {
+		logger.Log.Error("Failed to enforce spool limits", zap.Error(err))
+	}
+	return nil
+}
+
+// load читает все неотправленные пакеты по порядку и помечает их как отправляемые.
+func (s *spool) load() ([][]models.Metrics, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dropExpired()
+
+	entries, err := s.entries()
+	if err != nil {
+		logger.Log.Error("Failed to list spool", zap.Error(err))
+		return nil, nil
+	}
+
+	var batches [][]models.Metrics
+	var names []string
+	for _, e := range entries {
+		batch, err := s.read(e.name)
+		if err != nil {
+			logger.Log.Error("Failed to read spooled batch, dropping", zap.String("file", e.name), zap.Error(err))
+			s.removeFile(e.name)
+			continue
+		}
+		batches = append(batches, batch)
+		names = append(names, e.name)
+		s.inflight[e.name] = true
+	}
+
+	return batches, names
+}
+
+// release снимает отметку об отправке с файлов, оставляя их в очереди.
+func (s *spool) release(names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range names {
+		delete(s.inflight, name)
+	}
+}
+
+// remove удаляет успешно отправленные пакеты.
+func (s *spool) remove(names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range names {
+		delete(s.inflight, name)
+		s.removeFile(name)
+	}
+}
+
+// enforceLimits сжимает очередь при превышении количества пакетов и удаляет
+// самые старые пакеты при превышении размера. Сжатие объединяет пакеты без потери
+// приращений счётчиков, удаление — теряет их, поэтому выполняется в последнюю очередь.
+func (s *spool) enforceLimits() error {
+	entries, err := s.entries()
+	if err != nil {
+		return err
+	}
+
+	if len(entries) > s.maxBatches {
+		if err := s.compact(entries); err != nil {
+			return err
+		}
+		if entries, err = s.entries(); err != nil {
+			return err
+		}
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+
+	for _, e := range entries {
+		if total <= s.maxBytes {
+			break
+		}
+		if s.inflight[e.name] {
+			continue
+		}
+		s.drop(e.name, "spool size limit exceeded")
+		total -= e.size
+	}
+
+	return nil
+}
+
+// compact объединяет все неотправляемые в данный момент пакеты в один.
+func (s *spool) compact(entries []spoolEntry) error {
+	var batches [][]models.Metrics
+	var names []string
+	var newest time.Time
+
+	for _, e := range entries {
+		if s.inflight[e.name] {
+			continue
+		}
+		batch, err := s.read(e.name)
+		if err != nil {
+			s.drop(e.name, "unreadable spool file")
+			continue
+		}
+		batches = append(batches, batch)
+		names = append(names, e.name)
+		if e.created.After(newest) {
+			newest = e.created
+		}
+	}
+
+	if len(names) < 2 {
+		return nil
+	}
+
+	if err := s.write(mergeBatches(batches...), newest); err != nil {
+		return err
+	}
+	for _, name := range names {
+		s.removeFile(name)
+	}
+
+	logger.Log.Info("Spool compacted", zap.Int("batches", len(names)))
+	return nil
+}
+
+// dropExpired удаляет пакеты старше maxAge.
+func (s *spool) dropExpired() {
+	entries, err := s.entries()
+	if err != nil {
+		return
+	}
+
+	deadline := time.Now().Add(-s.maxAge)
+	for _, e := range entries {
+		if e.created.Before(deadline) && !s.inflight[e.name] {
+			s.drop(e.name, "spooled batch expired")
+		}
+	}
+}
+
+// drop удаляет пакет без отправки, сообщая о потерянных приращениях счётчиков.
+func (s *spool) drop(name string, reason string) {
+	var lost int64
+	if batch, err := s.read(name); err == nil {
+		for _, m := range batch {
+			if m.MType == "counter" && m.Delta != nil {
+				lost += *m.Delta
+			}
+		}
+	}
+
+	logger.Log.Warn("Dropping spooled batch",
+		zap.String("file", name),
+		zap.String("reason", reason),
+		zap.Int64("lost counter delta", lost),
+	)
+	s.removeFile(name)
+}
+
+func (s *spool) write(batch []models.Metrics, created time.Time) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	s.seq++
+	name := fmt.Sprintf("%019d-%06d%s", created.UnixNano(), s.seq%1000000, spoolFileExt)
+	tmp := filepath.Join(s.dir, name+".tmp")
+
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	s.pending.Add(1)
+	return nil
+}
+
+func (s *spool) read(name string) ([]models.Metrics, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	var batch []models.Metrics
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func (s *spool) removeFile(name string) {
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+		if !os.IsNotExist(err) {
+			logger.Log.Error("Failed to remove spool file", zap.String("file", name), zap.Error(err))
+		}
+		return
+	}
+	s.pending.Add(-1)
+}
+
+// entries возвращает файлы очереди в порядке создания.
+func (s *spool) entries() ([]spoolEntry, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool dir: %w", err)
+	}
+
+	var entries []spoolEntry
+	for _, de := range dirEntries {
+		name := de.Name()
+		if de.IsDir() || !strings.HasSuffix(name, spoolFileExt) {
+			continue
+		}
+
+		ts, _, ok := strings.Cut(name, "-")
+		nanos, err := strconv.ParseInt(ts, 10, 64)
+		if !ok || err != nil {
+			continue
+		}
+
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, spoolEntry{
+			name:    name,
+			size:    info.Size(),
+			created: time.Unix(0, nanos),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+)
+
+var errServerDown = fmt.Errorf("%w: 503", ErrUnexpectedStatus)
+
+func TestSpool_ReplayMergesPendingBatches(t *testing.T) {
+	sp, err := newSpool(t.TempDir(), 0, 0, 0, 0)
+	require.NoError(t, err)
+
+	failing := func([]models.Metrics) error { return errServerDown }
+
+	assert.ErrorIs(t, sp.Send([]models.Metrics{newGauge("Alloc", 1), newCounter("PollCount", 5)}, failing), errBatchSpooled)
+	assert.ErrorIs(t, sp.Send([]models.Metrics{newGauge("Alloc", 2), newCounter("PollCount", 3)}, failing), errBatchSpooled)
+	assert.EqualValues(t, 2, sp.pending.Load())
+
+	var sent [][]models.Metrics
+	ok := func(batch []models.Metrics) error {
+		sent = append(sent, batch)
+		return nil
+	}
+
+	require.NoError(t, sp.Send([]models.Metrics{newGauge("Alloc", 3), newCounter("PollCount", 1)}, ok))
+	require.Len(t, sent, 1)
+	assert.Equal(t, []models.Metrics{newGauge("Alloc", 3), newCounter("PollCount", 9)}, sent[0])
+	assert.EqualValues(t, 0, sp.pending.Load())
+
+	// повторная отправка не содержит уже доставленных приращений
+	require.NoError(t, sp.Send([]models.Metrics{newCounter("PollCount", 2)}, ok))
+	require.Len(t, sent, 2)
+	assert.Equal(t, []models.Metrics{newCounter("PollCount", 2)}, sent[1])
+}
+
+func TestSpool_FailedReplayKeepsBatches(t *testing.T) {
+	sp, err := newSpool(t.TempDir(), 0, 0, 0, 0)
+	require.NoError(t, err)
+
+	failing := func([]models.Metrics) error { return errServerDown }
+
+	assert.Error(t, sp.Send([]models.Metrics{newCounter("PollCount", 5)}, failing))
+	assert.Error(t, sp.Send([]models.Metrics{newCounter("PollCount", 3)}, failing))
+	assert.EqualValues(t, 2, sp.pending.Load())
+
+	batches, names := sp.load()
+	sp.release(names)
+	assert.Equal(t, [][]models.Metrics{{newCounter("PollCount", 5)}, {newCounter("PollCount", 3)}}, batches)
+}
+
+func TestSpool_ReplayInParts(t *testing.T) {
+	sp, err := newSpool(t.TempDir(), 0, 0, 0, 2)
+	require.NoError(t, err)
+	require.NoError(t, sp.store([]models.Metrics{newCounter("a", 1), newCounter("b", 1), newCounter("c", 1)}))
+
+	// первая часть доставлена, затем сервер становится недоступен
+	var sent [][]models.Metrics
+	send := func(batch []models.Metrics) error {
+		if len(sent) > 0 {
+			return errServerDown
+		}
+		sent = append(sent, batch)
+		return nil
+	}
+	assert.ErrorIs(t, sp.Send([]models.Metrics{newCounter("d", 1)}, send), errBatchSpooled)
+	assert.Equal(t, [][]models.Metrics{{newCounter("a", 1), newCounter("b", 1)}}, sent)
+
+	// в очереди остаются только недоставленные метрики
+	batches, names := sp.load()
+	sp.release(names)
+	assert.Equal(t, []models.Metrics{newCounter("c", 1), newCounter("d", 1)}, mergeBatches(batches...))
+}
+
+func TestSpool_SpoolsOnlyRetryableErrors(t *testing.T) {
+	sp, err := newSpool(t.TempDir(), 0, 0, 0, 0)
+	require.NoError(t, err)
+
+	errEncrypt := errors.New("encryption failed")
+	err = sp.Send([]models.Metrics{newCounter("PollCount", 1)}, func([]models.Metrics) error { return errEncrypt })
+	assert.Equal(t, errEncrypt, err)
+	assert.EqualValues(t, 0, sp.pending.Load())
+
+	for _, sendErr := range []error{
+		ErrCircuitOpen,
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+	} {
+		err = sp.Send([]models.Metrics{newCounter("PollCount", 1)}, func([]models.Metrics) error { return sendErr })
+		assert.ErrorIs(t, err, errBatchSpooled)
+	}
+	assert.EqualValues(t, 2, sp.pending.Load())
+}
+
+func TestSpool_CompactionKeepsCounters(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := newSpool(dir, 3, 0, 0, 0)
+	require.NoError(t, err)
+
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, sp.store([]models.Metrics{newGauge("Alloc", float64(i)), newCounter("PollCount", int64(i))}))
+	}
+
+	entries, err := sp.entries()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(entries), 3)
+
+	batches, names := sp.load()
+	sp.release(names)
+	assert.Equal(t, []models.Metrics{newGauge("Alloc", 5), newCounter("PollCount", 15)}, mergeBatches(batches...))
+
+	// после перезапуска очередь восстанавливается с диска
+	restored, err := newSpool(dir, 3, 0, 0, 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(entries), restored.pending.Load())
+}
+
+func TestSpool_DropsExpiredBatches(t *testing.T) {
+	sp, err := newSpool(t.TempDir(), 0, 0, time.Hour, 0)
+	require.NoError(t, err)
+
+	sp.mu.Lock()
+	require.NoError(t, sp.write([]models.Metrics{newCounter("PollCount", 1)}, time.Now().Add(-2*time.Hour)))
+	sp.mu.Unlock()
+	require.NoError(t, sp.store([]models.Metrics{newCounter("PollCount", 2)}))
+
+	batches, names := sp.load()
+	sp.release(names)
+	assert.Equal(t, [][]models.Metrics{{newCounter("PollCount", 2)}}, batches)
+}
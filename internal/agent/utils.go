@@ -1,33 +1,98 @@
 package agent
 
 import (
-	"bytes"
-	"compress/gzip"
-	"crypto/hmac"
-	"crypto/sha256"
+	"net"
+	"sort"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
 )
 
-func bodySignature(jsonData []byte, key string) []byte {
-	if key == "" {
-		return nil
+// mergeBatches объединяет пакеты метрик по порядку: для gauge сохраняется последнее
+// значение, приращения counter суммируются.
+func mergeBatches(batches ...[]models.Metrics) []models.Metrics {
+	var result []models.Metrics
+	index := make(map[string]int)
+
+	for _, batch := range batches {
+		for _, m := range batch {
+			key := m.MType + ":" + m.ID
+			i, ok := index[key]
+			if !ok {
+				merged := models.Metrics{ID: m.ID, MType: m.MType}
+				if m.Value != nil {
+					v := *m.Value
+					merged.Value = &v
+				}
+				if m.Delta != nil {
+					d := *m.Delta
+					merged.Delta = &d
+				}
+				index[key] = len(result)
+				result = append(result, merged)
+				continue
+			}
+
+			switch m.MType {
+			case "counter":
+				if m.Delta == nil {
+					continue
+				}
+				if result[i].Delta == nil {
+					result[i].Delta = new(int64)
+				}
+				*result[i].Delta += *m.Delta
+			default:
+				if m.Value != nil {
+					v := *m.Value
+					result[i].Value = &v
+				}
+			}
+		}
 	}
 
-	hasher := hmac.New(sha256.New, []byte(key))
-	hasher.Write(jsonData)
-	return hasher.Sum(nil)
+	return result
 }
 
-func compressBody(jsonData []byte) ([]byte, error) {
-	var buf bytes.Buffer
-	gz := gzip.NewWriter(&buf)
+// deltaTracker преобразует монотонно растущие значения в приращения между опросами.
+type deltaTracker map[string]uint64
 
-	if _, err := gz.Write(jsonData); err != nil {
-		return nil, err
+// delta возвращает приращение значения name с момента предыдущего наблюдения. При первом
+// наблюдении приращение не вычисляется, при уменьшении значения (перезапуск источника)
+// приращением считается само значение.
+func (t deltaTracker) delta(name string, value uint64) (int64, bool) {
+	prev, ok := t[name]
+	t[name] = value
+	if !ok {
+		return 0, false
 	}
+	if value < prev {
+		return int64(value), true
+	}
+	return int64(value - prev), true
+}
 
-	if err := gz.Close(); err != nil {
-		return nil, err
+// appendDeltas добавляет к metrics counter-метрики с приращениями values в порядке имён.
+func (t deltaTracker) appendDeltas(metrics []models.Metrics, values map[string]uint64) []models.Metrics {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	return buf.Bytes(), nil
+	for _, name := range names {
+		if d, ok := t.delta(name, values[name]); ok {
+			metrics = append(metrics, newCounter(name, d))
+		}
+	}
+	return metrics
+}
+
+// isLoopbackHost сообщает, что host — localhost или loopback-адрес. Пустой хост
+// означает все интерфейсы и loopback не считается.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
@@ -1,7 +1,10 @@
 package agent
 
 import (
+	"errors"
+
 	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
 	"go.uber.org/zap"
 )
 
@@ -21,7 +24,7 @@ func (a *Agent) WorkerCreateBatchRequest() {
 			a.processRemainingTasks()
 			return
 		case batch := <-a.Tasks:
-			err := a.createBatchRequest(batch)
+			err := a.deliverBatch(batch)
 			if err != nil {
 				logger.Log.Error("createBatchRequest", zap.Error(err))
 			}
@@ -34,7 +37,7 @@ func (a *Agent) processRemainingTasks() {
 	for {
 		select {
 		case batch := <-a.Tasks:
-			err := a.createBatchRequest(batch)
+			err := a.deliverBatch(batch)
 			if err != nil {
 				logger.Log.Error("createBatchRequest during shutdown", zap.Error(err))
 			}
@@ -43,3 +46,45 @@ func (a *Agent) processRemainingTasks() {
 		}
 	}
 }
+
+// deliverBatch отправляет пакет частями не больше MaxBatchSize метрик. Каждая часть
+// возвращается в агент, если она не была принята сервером и не была сохранена в очередь
+// на диске.
+func (a *Agent) deliverBatch(batch []models.Metrics) error {
+	var errs []error
+	for len(batch) > 0 {
+		n := len(batch)
+		if a.MaxBatchSize > 0 {
+			n = min(n, a.MaxBatchSize)
+		}
+		if err := a.deliverPart(batch[:n]); err != nil {
+			errs = append(errs, err)
+		}
+		batch = batch[n:]
+	}
+	return errors.Join(errs...)
+}
+
+// deliverPart отправляет часть пакета. Если сервер отклоняет её как слишком большую,
+// часть делится пополам, и половины доставляются независимо, поэтому приращения counter
+// не теряются, даже если лимит сервера меньше MaxBatchSize.
+func (a *Agent) deliverPart(batch []models.Metrics) error {
+	err := a.sendBatch(batch)
+	if errors.Is(err, ErrBatchTooLarge) && len(batch) > 1 {
+		logger.Log.Warn("Batch too large for server, splitting", zap.Int("metrics", len(batch)))
+		half := len(batch) / 2
+		return errors.Join(a.deliverPart(batch[:half]), a.deliverPart(batch[half:]))
+	}
+	if err != nil && !errors.Is(err, errBatchSpooled) {
+		a.restoreBatch(batch)
+	}
+	return err
+}
+
+// sendBatch отправляет пакет, при включённой очереди вместе с ранее неотправленными пакетами.
+func (a *Agent) sendBatch(batch []models.Metrics) error {
+	if a.Spool == nil {
+		return a.createBatchRequest(batch)
+	}
+	return a.Spool.Send(batch, a.createBatchRequest)
+}
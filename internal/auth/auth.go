@@ -0,0 +1,145 @@
+// Package auth проверяет учётные данные клиентов сервера и их права доступа.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Scope — право доступа к группе маршрутов.
+type Scope string
+
+const (
+	// ScopeWrite разрешает отправку метрик.
+	ScopeWrite Scope = "write"
+	// ScopeRead разрешает чтение метрик.
+	ScopeRead Scope = "read"
+	// ScopeAdmin разрешает все операции.
+	ScopeAdmin Scope = "admin"
+)
+
+// Ошибки аутентификации
+var (
+	// ErrNoCredentials означает, что запрос не содержит учётных данных, которые
+	// проверяет аутентификатор.
+	ErrNoCredentials     = errors.New("credentials required")
+	ErrInvalidKey        = errors.New("invalid API key")
+	ErrRevokedKey        = errors.New("API key revoked")
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+// Principal описывает аутентифицированного клиента. Если Prefixes не пуст, клиент
+// может читать только метрики, имена которых начинаются с одного из префиксов.
+type Principal struct {
+	ID       string
+	Scopes   []Scope
+	Prefixes []string
+}
+
+// Allows сообщает, есть ли у клиента право scope.
+func (p *Principal) Allows(scope Scope) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// Authenticator проверяет учётные данные запроса. Если запрос не содержит учётных
+// данных этого вида, возвращается ErrNoCredentials.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+	// Enabled возвращает true, если аутентификатор настроен.
+	Enabled() bool
+}
+
+// CanRead сообщает, может ли клиент читать метрику name.
+func (p *Principal) CanRead(name string) bool {
+	if len(p.Prefixes) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(p.Prefixes, func(prefix string) bool {
+		return strings.HasPrefix(name, prefix)
+	})
+}
+
+// CanRead сообщает, может ли клиент запроса читать метрику name. Без аутентификации
+// ограничений нет.
+func CanRead(ctx context.Context, name string) bool {
+	p, ok := FromContext(ctx)
+	return !ok || p.CanRead(name)
+}
+
+type principalKey struct{}
+
+// NewContext возвращает копию ctx с клиентом p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext возвращает клиента, аутентифицированного middleware Require.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Require пропускает запрос, если один из аутентификаторов признал учётные данные
+// и у клиента есть право scope. Без учётных данных или с неверными отвечает 401,
+// без нужного права — 403. Если ни один аутентификатор не настроен, проверка выключена.
+func Require(scope Scope, authenticators ...Authenticator) func(http.Handler) http.Handler {
+	var enabled []Authenticator
+	for _, a := range authenticators {
+		if a != nil && a.Enabled() {
+			enabled = append(enabled, a)
+		}
+	}
+
+	return func(h http.Handler) http.Handler {
+		if len(enabled) == 0 {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authenticate(r, enabled)
+			if err != nil {
+				logger.Log.Debug("Authentication failed", zap.String("uri", r.RequestURI), zap.Error(err))
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			if !principal.Allows(scope) {
+				logger.Log.Debug("Authorization failed", zap.String("uri", r.RequestURI),
+					zap.String("principal", principal.ID), zap.String("scope", string(scope)))
+				http.Error(w, ErrInsufficientScope.Error()+": "+string(scope)+" required", http.StatusForbidden)
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(NewContext(r.Context(), principal)))
+		})
+	}
+}
+
+// authenticate возвращает клиента первого аутентификатора, распознавшего учётные данные.
+func authenticate(r *http.Request, authenticators []Authenticator) (*Principal, error) {
+	for _, a := range authenticators {
+		principal, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// bearerToken возвращает токен из заголовка Authorization: Bearer.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwtLeeway — допустимое расхождение часов издателя токенов и сервера.
+const jwtLeeway = 30 * time.Second
+
+// ErrInvalidToken означает, что токен не прошёл проверку.
+var ErrInvalidToken = errors.New("invalid token")
+
+// jwk — открытый ключ из набора JWKS (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+	Scope     string   `json:"scope"`
+	Prefixes  []string `json:"metric_prefixes"`
+}
+
+// audience принимает claim aud в виде строки или массива строк.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// JWTAuthenticator проверяет JWT из заголовка Authorization: Bearer по ключам из
+// локального файла JWKS, без обращения к сети. Токен должен быть выпущен issuer
+// для audience и не быть просроченным. Права берутся из claim scope, без него
+// токен даёт только чтение. Claim metric_prefixes ограничивает префиксы имён метрик,
+// которые может читать владелец токена.
+type JWTAuthenticator struct {
+	path     string
+	issuer   string
+	audience string
+	now      func() time.Time
+
+	mu   sync.RWMutex
+	keys map[string]jwkKey
+}
+
+// NewJWTAuthenticator загружает файл JWKS. При пустом пути проверка JWT выключена.
+func NewJWTAuthenticator(path, issuer, audience string) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{path: path, issuer: issuer, audience: audience, now: time.Now}
+	if path == "" {
+		return a, nil
+	}
+	if issuer == "" || audience == "" {
+		return nil, errors.New("JWT issuer and audience are required with JWKS file")
+	}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Enabled возвращает true, если задан файл JWKS.
+func (a *JWTAuthenticator) Enabled() bool {
+	return a != nil && a.path != ""
+}
+
+// Reload перечитывает файл JWKS. При ошибке остаются прежние ключи.
+func (a *JWTAuthenticator) Reload() error {
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("failed to parse JWKS file: %w", err)
+	}
+
+	keys := make(map[string]jwkKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			return fmt.Errorf("JWKS key %q: %w", k.Kid, err)
+		}
+		if _, ok := keys[k.Kid]; ok {
+			return fmt.Errorf("duplicate JWKS key id %q", k.Kid)
+		}
+		keys[k.Kid] = jwkKey{alg: k.Alg, pub: pub}
+	}
+	if len(keys) == 0 {
+		return errors.New("no signing keys found in JWKS file")
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.mu.Unlock()
+	return nil
+}
+
+type jwkKey struct {
+	alg string
+	pub any
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if _, err := pub.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+		return pub, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("malformed key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Authenticate проверяет JWT запроса.
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	// ключи API содержат одну точку и проверяются KeyRing
+	if !ok || strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	scopes := []Scope{ScopeRead}
+	if claims.Scope != "" {
+		scopes = nil
+		for _, s := range strings.Fields(claims.Scope) {
+			if s := Scope(s); s == ScopeWrite || s == ScopeRead || s == ScopeAdmin {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+
+	return &Principal{ID: claims.Subject, Scopes: scopes, Prefixes: claims.Prefixes}, nil
+}
+
+func (a *JWTAuthenticator) verify(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header: %w", err)
+	}
+
+	a.mu.RLock()
+	k, ok := a.keys[header.Kid]
+	a.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", header.Kid)
+	}
+	if k.alg != "" && k.alg != header.Alg {
+		return nil, fmt.Errorf("algorithm %s does not match key", header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	if err := verifySignature(header.Alg, k.pub, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %w", err)
+	}
+
+	now := a.now()
+	switch {
+	case claims.Issuer != a.issuer:
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	case !slices.Contains(claims.Audience, a.audience):
+		return nil, errors.New("token is not intended for this audience")
+	case claims.ExpiresAt == nil:
+		return nil, errors.New("exp claim required")
+	case now.After(time.Unix(*claims.ExpiresAt, 0).Add(jwtLeeway)):
+		return nil, errors.New("token expired")
+	case claims.NotBefore != nil && now.Add(jwtLeeway).Before(time.Unix(*claims.NotBefore, 0)):
+		return nil, errors.New("token not yet valid")
+	}
+	return &claims, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifySignature проверяет подпись алгоритмом alg. Алгоритм должен соответствовать
+// типу ключа, поэтому токен с alg "none" или HS256 не принимается.
+func verifySignature(alg string, pub any, signed, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		if key, ok := pub.(ed25519.PublicKey); ok && ed25519.Verify(key, signed, sig) {
+			return nil
+		}
+		return errors.New("signature mismatch")
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	var err error
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(key, hash, digest, sig)
+		case "PS":
+			err = rsa.VerifyPSS(key, hash, digest, sig, nil)
+		default:
+			err = errors.New("algorithm does not match key")
+		}
+	case *ecdsa.PublicKey:
+		bits := key.Curve.Params().BitSize
+		size := (bits + 7) / 8
+		// ES512 использует кривую P-521
+		if alg != fmt.Sprintf("ES%d", min(bits, 512)) || len(sig) != 2*size {
+			return errors.New("signature mismatch")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			err = errors.New("signature mismatch")
+		}
+	default:
+		err = errors.New("algorithm does not match key")
+	}
+	if err != nil {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
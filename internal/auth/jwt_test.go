@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testIssuer struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	ed  ed25519.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return &testIssuer{rsa: rsaKey, ec: ecKey, ed: edKey}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// writeJWKS записывает открытые ключи издателя в файл JWKS.
+func (i *testIssuer) writeJWKS(t *testing.T) string {
+	t.Helper()
+
+	ecBytes := (i.ec.Curve.Params().BitSize + 7) / 8
+	set := map[string][]jwk{"keys": {
+		{Kty: "RSA", Kid: "rsa", Alg: "RS256", Use: "sig", N: b64(i.rsa.N.Bytes()), E: b64(big.NewInt(int64(i.rsa.E)).Bytes())},
+		{Kty: "EC", Kid: "ec", Crv: "P-256", X: b64(i.ec.X.FillBytes(make([]byte, ecBytes))), Y: b64(i.ec.Y.FillBytes(make([]byte, ecBytes)))},
+		{Kty: "OKP", Kid: "ed", Crv: "Ed25519", X: b64(i.ed.Public().(ed25519.PublicKey))},
+		{Kty: "RSA", Kid: "enc", Use: "enc", N: b64(i.rsa.N.Bytes()), E: "AQAB"},
+	}}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func (i *testIssuer) token(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, i.rsa, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case "PS256":
+		sig, err = rsa.SignPSS(rand.Reader, i.rsa, crypto.SHA256, digest[:], nil)
+		require.NoError(t, err)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, i.ec, digest[:])
+		require.NoError(t, err)
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "EdDSA":
+		sig = ed25519.Sign(i.ed, []byte(signed))
+	case "HS256":
+		// подпись открытым ключом как секретом HMAC: классическая подмена алгоритма
+		mac := hmac.New(sha256.New, i.rsa.N.Bytes())
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	}
+	return signed + "." + b64(sig)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	issuer := newTestIssuer(t)
+	a, err := NewJWTAuthenticator(issuer.writeJWKS(t), "https://idp.example", "metrics")
+	require.NoError(t, err)
+	now := time.Unix(1_700_000_000, 0)
+	a.now = func() time.Time { return now }
+
+	claims := func(override map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":             "https://idp.example",
+			"aud":             "metrics",
+			"sub":             "dashboard",
+			"exp":             now.Add(time.Hour).Unix(),
+			"metric_prefixes": []string{"app."},
+		}
+		for k, v := range override {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+
+	testCases := []struct {
+		name  string
+		token func() string
+		err   error
+	}{
+		{name: "rs256", token: func() string { return issuer.token(t, "RS256", "rsa", claims(nil)) }},
+		{name: "es256", token: func() string { return issuer.token(t, "ES256", "ec", claims(nil)) }},
+		{name: "eddsa", token: func() string { return issuer.token(t, "EdDSA", "ed", claims(nil)) }},
+		{name: "aud_list", token: func() string {
+			return issuer.token(t, "EdDSA", "ed", claims(map[string]any{"aud": []string{"other", "metrics"}}))
+		}},
+		{name: "expired", token: func() string {
+			return issuer.token(t, "RS256", "rsa", claims(map[string]any{"exp": now.Add(-time.Minute).Unix()}))
+		}, err: ErrInvalidToken},
+		{name: "no_exp", token: func() string { return issuer.token(t, "RS256", "rsa", claims(map[string]any{"exp": nil})) }, err: ErrInvalidToken},
+		{name: "not_yet_valid", token: func() string {
+			return issuer.token(t, "RS256", "rsa", claims(map[string]any{"nbf": now.Add(time.Hour).Unix()}))
+		}, err: ErrInvalidToken},
+		{name: "wrong_issuer", token: func() string {
+			return issuer.token(t, "RS256", "rsa", claims(map[string]any{"iss": "https://evil.example"}))
+		}, err: ErrInvalidToken},
+		{name: "wrong_audience", token: func() string {
+			return issuer.token(t, "RS256", "rsa", claims(map[string]any{"aud": "billing"}))
+		}, err: ErrInvalidToken},
+		// у ключа rsa в JWKS указан алгоритм RS256
+		{name: "alg_mismatch", token: func() string { return issuer.token(t, "PS256", "rsa", claims(nil)) }, err: ErrInvalidToken},
+		{name: "hs256", token: func() string { return issuer.token(t, "HS256", "ec", claims(nil)) }, err: ErrInvalidToken},
+		{name: "alg_none", token: func() string {
+			tok := issuer.token(t, "EdDSA", "ed", claims(nil))
+			header := b64([]byte(`{"alg":"none","kid":"ed"}`))
+			return header + tok[len(b64([]byte(`{"alg":"EdDSA","kid":"ed","typ":"JWT"}`))):]
+		}, err: ErrInvalidToken},
+		{name: "unknown_kid", token: func() string { return issuer.token(t, "RS256", "missing", claims(nil)) }, err: ErrInvalidToken},
+		{name: "encryption_key", token: func() string { return issuer.token(t, "RS256", "enc", claims(nil)) }, err: ErrInvalidToken},
+		{name: "tampered", token: func() string {
+			tok := issuer.token(t, "ES256", "ec", claims(nil))
+			other := issuer.token(t, "ES256", "ec", claims(map[string]any{"metric_prefixes": nil}))
+			// подпись от других claims
+			return tok[:len(tok)-86] + other[len(other)-86:]
+		}, err: ErrInvalidToken},
+		{name: "api_key", token: func() string { return "agent1.secret" }, err: ErrNoCredentials},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token())
+
+			p, err := a.Authenticate(req)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "dashboard", p.ID)
+			assert.True(t, p.Allows(ScopeRead))
+			assert.False(t, p.Allows(ScopeWrite))
+			assert.True(t, p.CanRead("app.cpu"))
+			assert.False(t, p.CanRead("db.connections"))
+		})
+	}
+}
+
+func TestJWTAuthenticator_Scope(t *testing.T) {
+	issuer := newTestIssuer(t)
+	a, err := NewJWTAuthenticator(issuer.writeJWKS(t), "idp", "metrics")
+	require.NoError(t, err)
+
+	token := issuer.token(t, "EdDSA", "ed", map[string]any{
+		"iss": "idp", "aud": "metrics", "sub": "ci", "exp": time.Now().Add(time.Hour).Unix(), "scope": "write unknown",
+	})
+
+	// API-ключи и JWT проверяются одним middleware
+	ring, _ := newTestKeyRing(t, APIKey{ID: "viewer", SecretSHA256: secretHash("r"), Scopes: []Scope{ScopeRead}})
+	h := Require(ScopeWrite, ring, a)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testCases := []struct {
+		token  string
+		status int
+	}{
+		{token: token, status: http.StatusOK},
+		{token: "viewer.r", status: http.StatusForbidden},
+		{token: token + "x", status: http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, tc.status, rec.Code)
+	}
+}
+
+func TestNewJWTAuthenticator_Config(t *testing.T) {
+	path := newTestIssuer(t).writeJWKS(t)
+
+	_, err := NewJWTAuthenticator(path, "", "metrics")
+	assert.Error(t, err)
+
+	_, err = NewJWTAuthenticator(filepath.Join(t.TempDir(), "missing.json"), "idp", "metrics")
+	assert.Error(t, err)
+
+	a, err := NewJWTAuthenticator("", "", "")
+	require.NoError(t, err)
+	assert.False(t, a.Enabled())
+}
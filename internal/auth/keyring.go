@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"go.uber.org/zap"
+)
+
+// HeaderAPIKey — заголовок с ключом API, альтернатива Authorization: Bearer.
+const HeaderAPIKey = "X-API-Key"
+
+// keyringCheckInterval — как часто проверяется время изменения файла ключей.
+const keyringCheckInterval = 5 * time.Second
+
+// APIKey — запись файла ключей. Хранится только SHA-256 секрета, поэтому файл
+// не раскрывает ключи агентов.
+type APIKey struct {
+	ID           string  `json:"id"`
+	SecretSHA256 string  `json:"secret_sha256"`
+	Scopes       []Scope `json:"scopes"`
+	Revoked      bool    `json:"revoked"`
+}
+
+type keyringFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// KeyRing проверяет ключи API вида "<id>.<secret>" из заголовка Authorization: Bearer
+// или X-API-Key по файлу ключей. Файл перечитывается при изменении и по Reload, поэтому
+// ключ можно отозвать без перезапуска сервера. Если файл удалён или не читается,
+// остаются действительными последние загруженные ключи: чтобы отозвать все ключи,
+// файл нужно заменить пустым списком.
+type KeyRing struct {
+	path          string
+	checkInterval time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]APIKey
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// NewKeyRing загружает файл ключей. При пустом пути проверка ключей выключена.
+func NewKeyRing(path string) (*KeyRing, error) {
+	k := &KeyRing{path: path, checkInterval: keyringCheckInterval}
+	if path == "" {
+		return k, nil
+	}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Enabled возвращает true, если задан файл ключей.
+func (k *KeyRing) Enabled() bool {
+	return k != nil && k.path != ""
+}
+
+// Reload перечитывает файл ключей. При ошибке остаются прежние ключи.
+func (k *KeyRing) Reload() error {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat API keys file: %w", err)
+	}
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse API keys file: %w", err)
+	}
+
+	keys := make(map[string]APIKey, len(file.Keys))
+	for _, key := range file.Keys {
+		if err := validateKey(key); err != nil {
+			return err
+		}
+		if _, ok := keys[key.ID]; ok {
+			return fmt.Errorf("duplicate API key id %q", key.ID)
+		}
+		keys[key.ID] = key
+	}
+
+	k.mu.Lock()
+	k.keys, k.modTime, k.lastCheck = keys, info.ModTime(), time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+func validateKey(key APIKey) error {
+	if key.ID == "" || strings.Contains(key.ID, ".") {
+		return fmt.Errorf("invalid API key id %q", key.ID)
+	}
+	if hash, err := hex.DecodeString(key.SecretSHA256); err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("API key %s: secret_sha256 must be a hex SHA-256 digest", key.ID)
+	}
+	for _, s := range key.Scopes {
+		if s != ScopeWrite && s != ScopeRead && s != ScopeAdmin {
+			return fmt.Errorf("API key %s: unknown scope %q", key.ID, s)
+		}
+	}
+	return nil
+}
+
+// refresh перечитывает файл не чаще checkInterval, если он изменился. Ошибка чтения
+// записывается в журнал и не прерывает проверку запросов: используются прежние ключи.
+func (k *KeyRing) refresh() {
+	k.mu.Lock()
+	if time.Since(k.lastCheck) < k.checkInterval {
+		k.mu.Unlock()
+		return
+	}
+	k.lastCheck = time.Now()
+	modTime := k.modTime
+	k.mu.Unlock()
+
+	if info, err := os.Stat(k.path); err == nil && !info.ModTime().Equal(modTime) {
+		if err := k.Reload(); err != nil {
+			logger.Log.Error("Failed to reload API keys", zap.Error(err))
+		}
+	}
+}
+
+// Authenticate проверяет ключ API запроса.
+func (k *KeyRing) Authenticate(r *http.Request) (*Principal, error) {
+	token := r.Header.Get(HeaderAPIKey)
+	if token == "" {
+		token, _ = bearerToken(r)
+	}
+	// JWT содержит две точки и проверяется другим аутентификатором
+	if token == "" || strings.Count(token, ".") != 1 {
+		return nil, ErrNoCredentials
+	}
+	id, secret, _ := strings.Cut(token, ".")
+
+	k.refresh()
+	k.mu.RLock()
+	key, ok := k.keys[id]
+	k.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id %s", ErrInvalidKey, id)
+	}
+
+	sum := sha256.Sum256([]byte(secret))
+	expected, _ := hex.DecodeString(key.SecretSHA256)
+	if subtle.ConstantTimeCompare(sum[:], expected) != 1 {
+		return nil, fmt.Errorf("%w: secret mismatch for %s", ErrInvalidKey, id)
+	}
+	if key.Revoked {
+		return nil, fmt.Errorf("%w: %s", ErrRevokedKey, id)
+	}
+
+	return &Principal{ID: key.ID, Scopes: key.Scopes}, nil
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func secretHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeKeys(t *testing.T, path string, keys ...APIKey) {
+	t.Helper()
+
+	data, err := json.Marshal(keyringFile{Keys: keys})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func newTestKeyRing(t *testing.T, keys ...APIKey) (*KeyRing, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeys(t, path, keys...)
+	ring, err := NewKeyRing(path)
+	require.NoError(t, err)
+	ring.checkInterval = 0
+	return ring, path
+}
+
+func TestRequire_Scopes(t *testing.T) {
+	ring, _ := newTestKeyRing(t,
+		APIKey{ID: "agent1", SecretSHA256: secretHash("w"), Scopes: []Scope{ScopeWrite}},
+		APIKey{ID: "viewer", SecretSHA256: secretHash("r"), Scopes: []Scope{ScopeRead}},
+		APIKey{ID: "root", SecretSHA256: secretHash("a"), Scopes: []Scope{ScopeAdmin}},
+	)
+
+	var principal *Principal
+	h := Require(ScopeWrite, ring)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = FromContext(r.Context())
+	}))
+
+	testCases := []struct {
+		name   string
+		header string
+		value  string
+		status int
+		id     string
+	}{
+		{name: "write_bearer", header: "Authorization", value: "Bearer agent1.w", status: http.StatusOK, id: "agent1"},
+		{name: "write_api_key", header: HeaderAPIKey, value: "agent1.w", status: http.StatusOK, id: "agent1"},
+		{name: "admin", header: HeaderAPIKey, value: "root.a", status: http.StatusOK, id: "root"},
+		{name: "read_only", header: HeaderAPIKey, value: "viewer.r", status: http.StatusForbidden},
+		{name: "wrong_secret", header: HeaderAPIKey, value: "agent1.x", status: http.StatusUnauthorized},
+		{name: "unknown_id", header: HeaderAPIKey, value: "nobody.w", status: http.StatusUnauthorized},
+		{name: "no_credentials", status: http.StatusUnauthorized},
+		{name: "basic_auth", header: "Authorization", value: "Basic YWdlbnQxOnc=", status: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			principal = nil
+			req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.status, rec.Code)
+			if tc.status == http.StatusUnauthorized {
+				assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+			}
+			if tc.id != "" {
+				require.NotNil(t, principal)
+				assert.Equal(t, tc.id, principal.ID)
+			}
+		})
+	}
+}
+
+func TestRequire_Disabled(t *testing.T) {
+	ring, err := NewKeyRing("")
+	require.NoError(t, err)
+
+	h := Require(ScopeAdmin, ring, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestKeyRing_Revoke(t *testing.T) {
+	key := APIKey{ID: "agent1", SecretSHA256: secretHash("w"), Scopes: []Scope{ScopeWrite}}
+	ring, path := newTestKeyRing(t, key)
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+	req.Header.Set(HeaderAPIKey, "agent1.w")
+
+	_, err := ring.Authenticate(req)
+	require.NoError(t, err)
+
+	// отзыв подхватывается из изменённого файла без перезапуска
+	key.Revoked = true
+	writeKeys(t, path, key)
+	require.NoError(t, os.Chtimes(path, ring.modTime.Add(1), ring.modTime.Add(1)))
+
+	_, err = ring.Authenticate(req)
+	assert.ErrorIs(t, err, ErrRevokedKey)
+}
+
+func TestKeyRing_InvalidFile(t *testing.T) {
+	key := APIKey{ID: "agent1", SecretSHA256: secretHash("w"), Scopes: []Scope{ScopeWrite}}
+	ring, path := newTestKeyRing(t, key)
+
+	testCases := []struct {
+		name string
+		keys []APIKey
+	}{
+		{name: "dot_in_id", keys: []APIKey{{ID: "a.b", SecretSHA256: secretHash("w")}}},
+		{name: "plain_secret", keys: []APIKey{{ID: "a", SecretSHA256: "w"}}},
+		{name: "unknown_scope", keys: []APIKey{{ID: "a", SecretSHA256: secretHash("w"), Scopes: []Scope{"delete"}}}},
+		{name: "duplicate", keys: []APIKey{key, key}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			writeKeys(t, path, tc.keys...)
+			assert.Error(t, ring.Reload())
+		})
+	}
+
+	// после ошибок перечитывания остаются прежние ключи
+	req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+	req.Header.Set("Authorization", "Bearer agent1.w")
+	_, err := ring.Authenticate(req)
+	assert.NoError(t, err)
+}
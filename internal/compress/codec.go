@@ -0,0 +1,192 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Имена поддерживаемых кодеков в заголовках Content-Encoding и Accept-Encoding
+const (
+	Gzip   = "gzip"
+	Zstd   = "zstd"
+	Snappy = "snappy"
+)
+
+// ErrUnsupportedEncoding возвращается для неизвестного способа сжатия.
+var ErrUnsupportedEncoding = errors.New("unsupported encoding")
+
+// Codec сжимает и распаковывает потоки данных в одном из форматов.
+type Codec interface {
+	// Name возвращает имя кодека для заголовка Content-Encoding.
+	Name() string
+	NewWriter(w io.Writer) io.WriteCloser
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// codecs перечислены в порядке предпочтения сервера при согласовании сжатия ответа.
+var codecs = []Codec{zstdCodec{}, snappyCodec{}, gzipCodec{}}
+
+// Lookup возвращает кодек по имени из заголовка Content-Encoding.
+func Lookup(name string) (Codec, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncoding, name)
+}
+
+// Negotiate выбирает кодек для ответа по заголовку Accept-Encoding: кодек с наибольшим
+// весом q, при равных весах — предпочтительный для сервера. Если клиент не принимает
+// ни один из поддерживаемых кодеков, ok равен false.
+func Negotiate(acceptEncoding string) (codec Codec, ok bool) {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if v, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		weights[name] = q
+	}
+
+	best := 0.0
+	for _, c := range codecs {
+		q, found := weights[c.Name()]
+		if !found {
+			q, found = weights["*"]
+		}
+		if found && q > best {
+			codec, best = c, q
+		}
+	}
+
+	return codec, codec != nil
+}
+
+// Compress сжимает data целиком.
+func Compress(codec Codec, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := codec.NewWriter(&buf)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return Gzip }
+
+func (gzipCodec) NewWriter(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }
+
+// Ограничения распаковки zstd: без них заголовок кадра может потребовать окно до 512 МиБ,
+// и небольшой запрос заставит сервер выделить столько памяти.
+const (
+	zstdMaxWindow = 8 << 20
+	zstdMaxMemory = 64 << 20
+)
+
+// Кодировщики и декодировщики zstd создаются дорого, поэтому переиспользуются между
+// запросами. С параллелизмом 1 они работают синхронно и не держат горутин, поэтому
+// не закрытые явно экземпляры может освободить сборщик мусора.
+var (
+	zstdEncoders = sync.Pool{New: func() any {
+		// ошибка возможна только при некорректных параметрах
+		zw, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return zw
+	}}
+	zstdDecoders = sync.Pool{New: func() any {
+		zr, _ := zstd.NewReader(nil,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(zstdMaxWindow),
+			zstd.WithDecoderMaxMemory(zstdMaxMemory),
+		)
+		return zr
+	}}
+)
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string { return Zstd }
+
+func (zstdCodec) NewWriter(w io.Writer) io.WriteCloser {
+	zw := zstdEncoders.Get().(*zstd.Encoder)
+	zw.Reset(w)
+	return &zstdWriter{Encoder: zw}
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	zr := zstdDecoders.Get().(*zstd.Decoder)
+	if err := zr.Reset(r); err != nil {
+		zstdDecoders.Put(zr)
+		return nil, err
+	}
+	return &zstdReader{Decoder: zr}, nil
+}
+
+// zstdWriter возвращает кодировщик в пул после закрытия.
+type zstdWriter struct {
+	*zstd.Encoder
+}
+
+func (w *zstdWriter) Close() error {
+	if w.Encoder == nil {
+		return nil
+	}
+	err := w.Encoder.Close()
+	zstdEncoders.Put(w.Encoder)
+	w.Encoder = nil
+	return err
+}
+
+// zstdReader возвращает декодировщик в пул после закрытия. Decoder.Close освобождает
+// декодировщик насовсем, поэтому вместо него источник сбрасывается.
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+func (r *zstdReader) Close() error {
+	if r.Decoder == nil {
+		return nil
+	}
+	_ = r.Decoder.Reset(nil)
+	zstdDecoders.Put(r.Decoder)
+	r.Decoder = nil
+	return nil
+}
+
+// snappyCodec использует потоковый (framed) формат snappy.
+type snappyCodec struct{}
+
+func (snappyCodec) Name() string { return Snappy }
+
+func (snappyCodec) NewWriter(w io.Writer) io.WriteCloser { return snappy.NewBufferedWriter(w) }
+
+func (snappyCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(snappy.NewReader(r)), nil
+}
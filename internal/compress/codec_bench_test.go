@@ -0,0 +1,105 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"testing"
+)
+
+// benchMetric повторяет формат models.Metrics, чтобы размер и состав пакета
+// соответствовали отправляемым агентом.
+type benchMetric struct {
+	ID    string   `json:"id"`
+	MType string   `json:"type"`
+	Delta *int64   `json:"delta,omitempty"`
+	Value *float64 `json:"value,omitempty"`
+}
+
+// metricsBatch формирует JSON пакета из n метрик с именами и значениями, похожими
+// на собираемые агентом: gauge с дробными значениями и counter с приращениями.
+func metricsBatch(tb testing.TB, n int) []byte {
+	tb.Helper()
+
+	names := []string{"Alloc", "HeapAlloc", "HeapInuse", "CPUutilization", "DiskUsed_root",
+		"NetBytesRecv_eth0", "LoadAverage1", "ProcessRSS_app", "CgroupMemoryCurrent"}
+	rnd := rand.New(rand.NewPCG(1, 2))
+
+	batch := make([]benchMetric, 0, n)
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("%s%d", names[i%len(names)], i/len(names))
+		if i%4 == 0 {
+			delta := rnd.Int64N(10000)
+			batch = append(batch, benchMetric{ID: id, MType: "counter", Delta: &delta})
+			continue
+		}
+		value := rnd.Float64() * 1e9
+		batch = append(batch, benchMetric{ID: id, MType: "gauge", Value: &value})
+	}
+
+	data, err := json.Marshal(batch)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// BenchmarkCompress сжимает открытый JSON пакета. Агент сжимает тело после шифрования,
+// а зашифрованные данные почти не сжимаются, поэтому при заданном crypto-key степень
+// сжатия близка к 1 и результаты относятся только к отправке без шифрования.
+func BenchmarkCompress(b *testing.B) {
+	for _, size := range []int{30, 500} {
+		data := metricsBatch(b, size)
+
+		for _, name := range []string{Gzip, Zstd, Snappy} {
+			codec, err := Lookup(name)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				var compressed []byte
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if compressed, err = Compress(codec, data); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(data))/float64(len(compressed)), "ratio")
+			})
+		}
+	}
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	data := metricsBatch(b, 500)
+
+	for _, name := range []string{Gzip, Zstd, Snappy} {
+		codec, err := Lookup(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		compressed, err := Compress(codec, data)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r, err := codec.NewReader(bytes.NewReader(compressed))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(io.Discard, r); err != nil {
+					b.Fatal(err)
+				}
+				r.Close()
+			}
+		})
+	}
+}
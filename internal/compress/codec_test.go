@@ -0,0 +1,150 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	data := metricsBatch(t, 200)
+
+	for _, name := range []string{Gzip, Zstd, Snappy} {
+		t.Run(name, func(t *testing.T) {
+			codec, err := Lookup(name)
+			require.NoError(t, err)
+
+			compressed, err := Compress(codec, data)
+			require.NoError(t, err)
+			assert.Less(t, len(compressed), len(data))
+
+			r, err := codec.NewReader(bytes.NewReader(compressed))
+			require.NoError(t, err)
+			defer r.Close()
+
+			decompressed, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, data, decompressed)
+		})
+	}
+}
+
+func TestLookup_Unsupported(t *testing.T) {
+	_, err := Lookup("br")
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
+
+func TestNegotiate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "empty", header: "", expected: ""},
+		{name: "gzip_only", header: "gzip", expected: Gzip},
+		{name: "server_preference", header: "gzip, snappy, zstd", expected: Zstd},
+		{name: "client_weights", header: "zstd;q=0.5, gzip;q=0.9", expected: Gzip},
+		{name: "excluded", header: "zstd;q=0, snappy", expected: Snappy},
+		{name: "wildcard", header: "*", expected: Zstd},
+		{name: "unsupported", header: "br, deflate", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			codec, ok := Negotiate(tc.header)
+			if tc.expected == "" {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, tc.expected, codec.Name())
+		})
+	}
+}
+
+func TestCompressWriter(t *testing.T) {
+	codec, err := Lookup(Snappy)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	cw := NewCompressWriter(rec, codec)
+	cw.WriteHeader(http.StatusOK)
+	_, err = cw.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, cw.Close())
+
+	assert.Equal(t, Snappy, rec.Header().Get("Content-Encoding"))
+
+	cr, err := NewCompressReader(io.NopCloser(rec.Body), codec)
+	require.NoError(t, err)
+	body, err := io.ReadAll(cr)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+}
+
+func TestCompressWriter_Status(t *testing.T) {
+	codec, err := Lookup(Gzip)
+	require.NoError(t, err)
+
+	// ответ с ошибкой сжимается и помечается так же, как успешный
+	rec := httptest.NewRecorder()
+	cw := NewCompressWriter(rec, codec)
+	http.Error(cw, "signature mismatch", http.StatusForbidden)
+	require.NoError(t, cw.Close())
+	assert.Equal(t, Gzip, rec.Header().Get("Content-Encoding"))
+
+	// Write без WriteHeader начинает ответ 200 со сжатием
+	rec = httptest.NewRecorder()
+	cw = NewCompressWriter(rec, codec)
+	_, err = cw.Write([]byte("ok"))
+	require.NoError(t, err)
+	require.NoError(t, cw.Close())
+	assert.Equal(t, Gzip, rec.Header().Get("Content-Encoding"))
+
+	// у ответа без тела нет ни заголовка, ни сжатых данных
+	rec = httptest.NewRecorder()
+	cw = NewCompressWriter(rec, codec)
+	cw.WriteHeader(http.StatusNoContent)
+	require.NoError(t, cw.Close())
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Zero(t, rec.Body.Len())
+}
+
+func TestZstd_Limits(t *testing.T) {
+	codec, err := Lookup(Zstd)
+	require.NoError(t, err)
+
+	// кадр с окном больше zstdMaxWindow отклоняется, не выделяя под него память
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf, zstd.WithWindowSize(64<<20))
+	require.NoError(t, err)
+	_, err = zw.Write(metricsBatch(t, 20000))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	r, err := codec.NewReader(bytes.NewReader(buf.Bytes()))
+	if err == nil {
+		_, err = io.ReadAll(r)
+		r.Close()
+	}
+	assert.Error(t, err)
+
+	// декодировщик из пула после ошибки распаковывает следующий поток
+	data := metricsBatch(t, 50)
+	for range 3 {
+		compressed, err := Compress(codec, data)
+		require.NoError(t, err)
+		r, err := codec.NewReader(bytes.NewReader(compressed))
+		require.NoError(t, err)
+		decompressed, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		assert.Equal(t, data, decompressed)
+	}
+}
@@ -0,0 +1,95 @@
+package compress
+
+import (
+	"io"
+	"net/http"
+)
+
+// compressWriter реализует интерфейс http.ResponseWriter и позволяет прозрачно для сервера
+// сжимать передаваемые данные и выставлять правильные HTTP-заголовки
+type compressWriter struct {
+	w           http.ResponseWriter
+	zw          io.WriteCloser // nil, пока ответ не начат, и для ответов без тела
+	codec       Codec
+	wroteHeader bool
+}
+
+// NewCompressWriter оборачивает w так, что тело ответа сжимается кодеком codec.
+func NewCompressWriter(w http.ResponseWriter, codec Codec) *compressWriter {
+	return &compressWriter{
+		w:     w,
+		codec: codec,
+	}
+}
+
+func (c *compressWriter) Header() http.Header {
+	return c.w.Header()
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.zw == nil {
+		return c.w.Write(p)
+	}
+	return c.zw.Write(p)
+}
+
+// WriteHeader один раз решает, сжимать ли ответ: сжимается тело ответа с любым кодом
+// состояния, в том числе с ошибкой, кроме ответов, у которых тела быть не может.
+// Заголовок Content-Encoding выставляется тогда и только тогда, когда тело сжимается.
+func (c *compressWriter) WriteHeader(statusCode int) {
+	if c.wroteHeader || statusCode < http.StatusOK {
+		c.w.WriteHeader(statusCode)
+		return
+	}
+	c.wroteHeader = true
+
+	if statusCode != http.StatusNoContent && statusCode != http.StatusNotModified {
+		c.w.Header().Set("Content-Encoding", c.codec.Name())
+		c.w.Header().Del("Content-Length")
+		c.zw = c.codec.NewWriter(c.w)
+	}
+	c.w.WriteHeader(statusCode)
+}
+
+// Close закрывает сжимающий writer и досылает все данные из буфера. Если ответ не был
+// начат, ничего не отправляется.
+func (c *compressWriter) Close() error {
+	if c.zw == nil {
+		return nil
+	}
+	return c.zw.Close()
+}
+
+// compressReader реализует интерфейс io.ReadCloser и позволяет прозрачно для сервера
+// декомпрессировать получаемые от клиента данные
+type compressReader struct {
+	r  io.ReadCloser
+	zr io.ReadCloser
+}
+
+// NewCompressReader оборачивает тело запроса r, сжатое кодеком codec.
+func NewCompressReader(r io.ReadCloser, codec Codec) (*compressReader, error) {
+	zr, err := codec.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compressReader{
+		r:  r,
+		zr: zr,
+	}, nil
+}
+
+func (c compressReader) Read(p []byte) (n int, err error) {
+	return c.zr.Read(p)
+}
+
+func (c *compressReader) Close() error {
+	if err := c.r.Close(); err != nil {
+		return err
+	}
+	return c.zr.Close()
+}
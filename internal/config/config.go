@@ -6,25 +6,96 @@ import (
 	"os"
 	"time"
 
+	"github.com/Himany/go-musthave-metrics-tpl/internal/retry"
 	"go.uber.org/zap/zapcore"
 )
 
+// RetryConfig содержит настройки политики повторов. Поля — указатели, чтобы явно
+// заданный ноль отличался от незаданного значения: нулевые MaxInterval и MaxElapsedTime
+// снимают соответствующее ограничение, нулевой Jitter отключает джиттер. Нулевой
+// MaxAttempts оставляет только ограничение MaxElapsedTime, а если и оно не задано,
+// выполняется одна попытка без повторов.
+type RetryConfig struct {
+	MaxAttempts     *int           `env:"MAX_ATTEMPTS"`
+	InitialInterval *time.Duration `env:"INITIAL_INTERVAL"`
+	MaxInterval     *time.Duration `env:"MAX_INTERVAL"`
+	Multiplier      *float64       `env:"MULTIPLIER"`
+	Jitter          *float64       `env:"JITTER"`
+	MaxElapsedTime  *time.Duration `env:"MAX_ELAPSED_TIME"`
+}
+
+// Policy возвращает политику повторов, в которой заданные поля конфигурации переопределяют base
+func (c RetryConfig) Policy(base retry.Policy) retry.Policy {
+	if c.MaxAttempts != nil {
+		base.MaxAttempts = *c.MaxAttempts
+	}
+	if c.InitialInterval != nil {
+		base.InitialInterval = *c.InitialInterval
+	}
+	if c.MaxInterval != nil {
+		base.MaxInterval = *c.MaxInterval
+	}
+	if c.Multiplier != nil {
+		base.Multiplier = *c.Multiplier
+	}
+	if c.Jitter != nil {
+		base.Jitter = *c.Jitter
+	}
+	if c.MaxElapsedTime != nil {
+		base.MaxElapsedTime = *c.MaxElapsedTime
+	}
+	return base
+}
+
 // ServerConfig содержит настройки сервера
 type ServerConfig struct {
 	Address       string `env:"ADDRESS"`
 	StoreInterval int    `env:"STORE_INTERVAL"`
 	Restore       bool   `env:"RESTORE"`
 	PprofAddr     string `env:"PPROF_ADDR"`
+
+	Limits     LimitsConfig
+	Validation ValidationConfig
+}
+
+// ValidationConfig содержит правила проверки метрик, принимаемых сервером.
+type ValidationConfig struct {
+	// NamePattern — регулярное выражение, которому должно целиком соответствовать имя метрики
+	NamePattern string `env:"METRIC_NAME_PATTERN"`
+	// MaxNameLength — наибольшая длина имени метрики в байтах, 0 — без ограничения
+	MaxNameLength int `env:"METRIC_NAME_MAX_LENGTH"`
+	// ReservedPrefixes — префиксы имён, запрещённые для клиентов
+	ReservedPrefixes []string `env:"METRIC_RESERVED_PREFIXES" envSeparator:","`
+	// NonFinite — что делать с NaN и ±Inf в gauge: "reject" (по умолчанию) или "clamp"
+	NonFinite string `env:"METRIC_NON_FINITE"`
+	// MinDelta и MaxDelta ограничивают приращение counter
+	MinDelta *int64 `env:"COUNTER_MIN_DELTA"`
+	MaxDelta *int64 `env:"COUNTER_MAX_DELTA"`
+}
+
+// LimitsConfig содержит ограничения на размер и частоту запросов к серверу.
+// Нулевые значения MaxBatchSize и RateLimit снимают соответствующее ограничение.
+type LimitsConfig struct {
+	// MaxBodySize — наибольший размер тела запроса в байтах после распаковки
+	MaxBodySize int64 `env:"MAX_BODY_SIZE"`
+	// MaxBatchSize — наибольшее число метрик в одном запросе /updates/
+	MaxBatchSize int `env:"MAX_BATCH_SIZE"`
+	// RateLimit — число запросов в секунду, которое может отправлять один клиент
+	RateLimit float64 `env:"CLIENT_RATE_LIMIT"`
+	// RateBurst — сколько запросов клиент может отправить подряд сверх RateLimit
+	RateBurst int `env:"CLIENT_RATE_BURST"`
 }
 
 // DatabaseConfig содержит настройки базы данных
 type DatabaseConfig struct {
-	DSN string `env:"DATABASE_DSN"`
+	DSN   string      `env:"DATABASE_DSN"`
+	Retry RetryConfig `envPrefix:"DB_RETRY_"`
 }
 
 // StorageConfig содержит настройки хранилища
 type StorageConfig struct {
-	FileStoragePath string `env:"FILE_STORAGE_PATH"`
+	FileStoragePath string      `env:"FILE_STORAGE_PATH"`
+	Retry           RetryConfig `envPrefix:"FILE_RETRY_"`
 }
 
 // AgentConfig содержит настройки агента
@@ -32,12 +103,121 @@ type AgentConfig struct {
 	ReportInterval int `env:"REPORT_INTERVAL"`
 	PollInterval   int `env:"POLL_INTERVAL"`
 	RateLimit      int `env:"RATE_LIMIT"`
+	// MaxBatchSize — наибольшее число метрик в одном запросе агента, 0 — без ограничения
+	MaxBatchSize int `env:"AGENT_MAX_BATCH_SIZE"`
+
+	Compression string `env:"COMPRESSION"`
+
+	Retry   RetryConfig `envPrefix:"AGENT_RETRY_"`
+	Breaker BreakerConfig
+	Spool   SpoolConfig
+	Changes ChangeReportingConfig
+
+	Instance InstanceConfig
+
+	EnabledCollectors []string `env:"COLLECTORS" envSeparator:","`
+	Collectors        map[string]CollectorConfig
+	Processes         []ProcessWatchConfig
+	CgroupPath        string `env:"CGROUP_PATH"`
+	StatsDAddress     string `env:"STATSD_ADDRESS"`
+	PushAddress       string `env:"PUSH_ADDRESS"`
+	ScrapeTargets     []ScrapeTargetConfig
+
+	// StatsDMaxSeries ограничивает число серий StatsD между отправками, новые серии сверх него отбрасываются
+	StatsDMaxSeries int `env:"STATSD_MAX_SERIES"`
+	// StatsDGaugeTTL — через сколько интервалов отправки без обновления gauge StatsD перестаёт отправляться
+	StatsDGaugeTTL int `env:"STATSD_GAUGE_TTL"`
+}
+
+// ScrapeTargetConfig описывает endpoint в текстовом формате Prometheus на loopback-адресе,
+// который опрашивает агент.
+type ScrapeTargetConfig struct {
+	URL    string `json:"url"`
+	Prefix string `json:"prefix"`
+}
+
+// ProcessWatchConfig описывает группу процессов, за которой наблюдает агент.
+// Процессы ищутся по PID-файлу, регулярному выражению имени или каталогу cgroup.
+type ProcessWatchConfig struct {
+	Name      string `json:"name"`
+	PIDFile   string `json:"pid_file"`
+	NameRegex string `json:"name_regex"`
+	Cgroup    string `json:"cgroup"`
+}
+
+// CollectorConfig содержит настройки отдельного коллектора метрик агента
+type CollectorConfig struct {
+	Enabled      *bool
+	PollInterval time.Duration
+}
+
+// SpoolConfig содержит настройки очереди неотправленных пакетов на диске
+type SpoolConfig struct {
+	Dir        string        `env:"SPOOL_DIR"`
+	MaxBatches int           `env:"SPOOL_MAX_BATCHES"`
+	MaxBytes   int64         `env:"SPOOL_MAX_BYTES"`
+	MaxAge     time.Duration `env:"SPOOL_MAX_AGE"`
+}
+
+// InstanceConfig задаёт идентификатор агента, добавляемый к каждой метрике в виде
+// префикса имени (Mode "prefix") или метки instance (Mode "labels"). Пустой Mode
+// отключает добавление, пустой ID заменяется именем хоста.
+type InstanceConfig struct {
+	ID   string            `env:"INSTANCE_ID"`
+	Mode string            `env:"INSTANCE_MODE"`
+	Tags map[string]string `env:"INSTANCE_TAGS" envSeparator:"," envKeyValSeparator:"="`
+}
+
+// ChangeReportingConfig содержит настройки отправки только изменившихся gauge.
+// Нулевые пороги означают, что отправляется любое изменение.
+type ChangeReportingConfig struct {
+	Enabled           bool          `env:"CHANGES_ONLY"`
+	AbsoluteThreshold float64       `env:"CHANGES_ABS_THRESHOLD"`
+	RelativeThreshold float64       `env:"CHANGES_REL_THRESHOLD"`
+	ResyncInterval    time.Duration `env:"CHANGES_RESYNC_INTERVAL"`
+}
+
+// BreakerConfig содержит настройки автоматического выключателя отправки метрик.
+// Threshold — указатель, чтобы явно заданный ноль, отключающий выключатель, отличался
+// от незаданного значения.
+type BreakerConfig struct {
+	Threshold   *int          `env:"BREAKER_THRESHOLD"`
+	OpenTimeout time.Duration `env:"BREAKER_OPEN_TIMEOUT"`
 }
 
 // SecurityConfig содержит настройки безопасности
 type SecurityConfig struct {
 	Key       string `env:"KEY"`
 	CryptoKey string `env:"CRYPTO_KEY"`
+	// SignatureMaxSkew — допустимое расхождение метки времени подписанного запроса с часами сервера
+	SignatureMaxSkew time.Duration `env:"SIGNATURE_MAX_SKEW"`
+	// SignatureLegacy принимает запросы без подписи и подписи только тела от агентов без
+	// метки времени и nonce. По умолчанию при заданном ключе такие запросы отклоняются:
+	// они не защищены ни от подделки, ни от повтора.
+	SignatureLegacy bool `env:"SIGNATURE_LEGACY"`
+	// CryptoKeyDir — каталог приватных ключей сервера *.pem для ротации ключей
+	CryptoKeyDir string `env:"CRYPTO_KEY_DIR"`
+
+	// TLSCert и TLSKey — сертификат сервера или клиентский сертификат агента для mTLS
+	TLSCert string `env:"TLS_CERT"`
+	TLSKey  string `env:"TLS_KEY"`
+	// TLSClientCA — центры сертификации, которыми сервер проверяет сертификаты агентов;
+	// файл перечитывается по SIGHUP вместе с сертификатом сервера
+	TLSClientCA string `env:"TLS_CLIENT_CA"`
+	// TLSCA — центры сертификации, которыми агент проверяет сертификат сервера
+	TLSCA string `env:"TLS_CA"`
+
+	// APIKeysFile — файл ключей API агентов и их прав на сервере
+	APIKeysFile string `env:"API_KEYS_FILE"`
+	// APIKey — ключ API агента вида "<id>.<secret>"
+	APIKey string `env:"API_KEY"`
+
+	// JWKSFile — локальный файл JWKS с ключами проверки JWT клиентов чтения
+	JWKSFile string `env:"JWT_JWKS_FILE"`
+	// JWTIssuer — ожидаемый издатель JWT (claim iss)
+	JWTIssuer string `env:"JWT_ISSUER"`
+	// JWTAudience — ожидаемая аудитория JWT (claim aud)
+	JWTAudience string `env:"JWT_AUDIENCE"`
 }
 
 // AuditConfig содержит настройки аудита
@@ -65,12 +245,31 @@ func (c *Config) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	enc.AddInt("pollInterval", c.Agent.PollInterval)
 	enc.AddInt("storeInterval", c.Server.StoreInterval)
 	enc.AddInt("rateLimit", c.Agent.RateLimit)
+	enc.AddInt("agentMaxBatchSize", c.Agent.MaxBatchSize)
+	enc.AddString("compression", c.Agent.Compression)
 	enc.AddString("fileStoragePath", c.Storage.FileStoragePath)
 	enc.AddBool("restore", c.Server.Restore)
 	enc.AddString("dataBaseDSN", c.Database.DSN)
 	enc.AddString("key", c.Security.Key)
 	enc.AddString("cryptoKey", c.Security.CryptoKey)
+	enc.AddString("cryptoKeyDir", c.Security.CryptoKeyDir)
+	enc.AddDuration("signatureMaxSkew", c.Security.SignatureMaxSkew)
+	enc.AddBool("signatureLegacy", c.Security.SignatureLegacy)
+	enc.AddString("tlsCert", c.Security.TLSCert)
+	enc.AddString("tlsClientCA", c.Security.TLSClientCA)
+	enc.AddString("tlsCA", c.Security.TLSCA)
+	enc.AddString("apiKeysFile", c.Security.APIKeysFile)
+	enc.AddString("jwksFile", c.Security.JWKSFile)
+	enc.AddString("jwtIssuer", c.Security.JWTIssuer)
+	enc.AddString("jwtAudience", c.Security.JWTAudience)
 	enc.AddString("pprofAddr", c.Server.PprofAddr)
+	enc.AddInt64("maxBodySize", c.Server.Limits.MaxBodySize)
+	enc.AddInt("maxBatchSize", c.Server.Limits.MaxBatchSize)
+	enc.AddFloat64("clientRateLimit", c.Server.Limits.RateLimit)
+	enc.AddInt("clientRateBurst", c.Server.Limits.RateBurst)
+	enc.AddString("metricNamePattern", c.Server.Validation.NamePattern)
+	enc.AddInt("metricNameMaxLength", c.Server.Validation.MaxNameLength)
+	enc.AddString("metricNonFinite", c.Server.Validation.NonFinite)
 	enc.AddString("auditFile", c.Audit.File)
 	enc.AddString("auditURL", c.Audit.URL)
 	return nil
@@ -84,6 +283,37 @@ type ServerJSONConfig struct {
 	StoreFile     string `json:"store_file"`
 	DatabaseDSN   string `json:"database_dsn"`
 	CryptoKey     string `json:"crypto_key"`
+	CryptoKeyDir  string `json:"crypto_key_dir"`
+	TLSCert       string `json:"tls_cert"`
+	TLSKey        string `json:"tls_key"`
+	TLSClientCA   string `json:"tls_client_ca"`
+
+	SignatureMaxSkew string `json:"signature_max_skew"`
+	SignatureLegacy  bool   `json:"signature_legacy"`
+	APIKeysFile      string `json:"api_keys_file"`
+	JWKSFile         string `json:"jwt_jwks_file"`
+	JWTIssuer        string `json:"jwt_issuer"`
+	JWTAudience      string `json:"jwt_audience"`
+
+	MaxBodySize     int64   `json:"max_body_size"`
+	MaxBatchSize    int     `json:"max_batch_size"`
+	ClientRateLimit float64 `json:"client_rate_limit"`
+	ClientRateBurst int     `json:"client_rate_burst"`
+
+	Validation *ValidationJSONConfig `json:"validation"`
+
+	FileRetry *RetryJSONConfig `json:"file_retry"`
+	DBRetry   *RetryJSONConfig `json:"db_retry"`
+}
+
+// ValidationJSONConfig представляет JSON конфигурацию проверки метрик
+type ValidationJSONConfig struct {
+	NamePattern      string   `json:"name_pattern"`
+	MaxNameLength    int      `json:"max_name_length"`
+	ReservedPrefixes []string `json:"reserved_prefixes"`
+	NonFinite        string   `json:"non_finite"`
+	MinDelta         *int64   `json:"counter_min_delta"`
+	MaxDelta         *int64   `json:"counter_max_delta"`
 }
 
 // AgentJSONConfig представляет JSON конфигурацию агента
@@ -92,6 +322,108 @@ type AgentJSONConfig struct {
 	ReportInterval string `json:"report_interval"`
 	PollInterval   string `json:"poll_interval"`
 	CryptoKey      string `json:"crypto_key"`
+	Compression    string `json:"compression"`
+	MaxBatchSize   int    `json:"max_batch_size"`
+	TLSCA          string `json:"tls_ca"`
+	TLSCert        string `json:"tls_cert"`
+	TLSKey         string `json:"tls_key"`
+	APIKey         string `json:"api_key"`
+
+	Retry   *RetryJSONConfig   `json:"retry"`
+	Breaker *BreakerJSONConfig `json:"breaker"`
+	Spool   *SpoolJSONConfig   `json:"spool"`
+	Changes *ChangesJSONConfig `json:"changes"`
+
+	Instance *InstanceJSONConfig `json:"instance"`
+
+	Collectors      map[string]CollectorJSONConfig `json:"collectors"`
+	Processes       []ProcessWatchConfig           `json:"processes"`
+	CgroupPath      string                         `json:"cgroup_path"`
+	StatsDAddress   string                         `json:"statsd_address"`
+	StatsDMaxSeries int                            `json:"statsd_max_series"`
+	StatsDGaugeTTL  int                            `json:"statsd_gauge_ttl"`
+	PushAddress     string                         `json:"push_address"`
+	ScrapeTargets   []ScrapeTargetConfig           `json:"scrape_targets"`
+}
+
+// CollectorJSONConfig представляет JSON конфигурацию коллектора метрик
+type CollectorJSONConfig struct {
+	Enabled      *bool  `json:"enabled"`
+	PollInterval string `json:"poll_interval"`
+}
+
+// SpoolJSONConfig представляет JSON конфигурацию очереди неотправленных пакетов
+type SpoolJSONConfig struct {
+	Dir        string `json:"dir"`
+	MaxBatches int    `json:"max_batches"`
+	MaxBytes   int64  `json:"max_bytes"`
+	MaxAge     string `json:"max_age"`
+}
+
+// InstanceJSONConfig представляет JSON конфигурацию идентификатора агента
+type InstanceJSONConfig struct {
+	ID   string            `json:"id"`
+	Mode string            `json:"mode"`
+	Tags map[string]string `json:"tags"`
+}
+
+// ChangesJSONConfig представляет JSON конфигурацию отправки только изменившихся gauge
+type ChangesJSONConfig struct {
+	Enabled           bool    `json:"enabled"`
+	AbsoluteThreshold float64 `json:"abs_threshold"`
+	RelativeThreshold float64 `json:"rel_threshold"`
+	ResyncInterval    string  `json:"resync_interval"`
+}
+
+// BreakerJSONConfig представляет JSON конфигурацию автоматического выключателя
+type BreakerJSONConfig struct {
+	Threshold   *int   `json:"threshold"`
+	OpenTimeout string `json:"open_timeout"`
+}
+
+// RetryJSONConfig представляет JSON конфигурацию политики повторов
+type RetryJSONConfig struct {
+	MaxAttempts     *int     `json:"max_attempts"`
+	InitialInterval *string  `json:"initial_interval"`
+	MaxInterval     *string  `json:"max_interval"`
+	Multiplier      *float64 `json:"multiplier"`
+	Jitter          *float64 `json:"jitter"`
+	MaxElapsedTime  *string  `json:"max_elapsed_time"`
+}
+
+// parse преобразует JSON конфигурацию политики повторов в RetryConfig
+func (j *RetryJSONConfig) parse() (RetryConfig, error) {
+	if j == nil {
+		return RetryConfig{}, nil
+	}
+
+	cfg := RetryConfig{
+		MaxAttempts: j.MaxAttempts,
+		Multiplier:  j.Multiplier,
+		Jitter:      j.Jitter,
+	}
+
+	durations := []struct {
+		name  string
+		value *string
+		dst   **time.Duration
+	}{
+		{"initial_interval", j.InitialInterval, &cfg.InitialInterval},
+		{"max_interval", j.MaxInterval, &cfg.MaxInterval},
+		{"max_elapsed_time", j.MaxElapsedTime, &cfg.MaxElapsedTime},
+	}
+	for _, d := range durations {
+		if d.value == nil {
+			continue
+		}
+		parsed, err := time.ParseDuration(*d.value)
+		if err != nil {
+			return RetryConfig{}, fmt.Errorf("invalid %s format: %w", d.name, err)
+		}
+		*d.dst = &parsed
+	}
+
+	return cfg, nil
 }
 
 // LoadServerConfigFromFile загружает конфигурацию сервера из JSON файла
@@ -138,6 +470,54 @@ func LoadServerConfigFromFile(filepath string) (*Config, error) {
 		config.Security.CryptoKey = jsonConfig.CryptoKey
 	}
 
+	if jsonConfig.CryptoKeyDir != "" {
+		config.Security.CryptoKeyDir = jsonConfig.CryptoKeyDir
+	}
+
+	config.Security.TLSCert = jsonConfig.TLSCert
+	config.Security.TLSKey = jsonConfig.TLSKey
+	config.Security.TLSClientCA = jsonConfig.TLSClientCA
+
+	config.Security.SignatureLegacy = jsonConfig.SignatureLegacy
+	config.Security.APIKeysFile = jsonConfig.APIKeysFile
+	config.Security.JWKSFile = jsonConfig.JWKSFile
+	config.Security.JWTIssuer = jsonConfig.JWTIssuer
+	config.Security.JWTAudience = jsonConfig.JWTAudience
+
+	config.Server.Limits = LimitsConfig{
+		MaxBodySize:  jsonConfig.MaxBodySize,
+		MaxBatchSize: jsonConfig.MaxBatchSize,
+		RateLimit:    jsonConfig.ClientRateLimit,
+		RateBurst:    jsonConfig.ClientRateBurst,
+	}
+
+	if v := jsonConfig.Validation; v != nil {
+		config.Server.Validation = ValidationConfig{
+			NamePattern:      v.NamePattern,
+			MaxNameLength:    v.MaxNameLength,
+			ReservedPrefixes: v.ReservedPrefixes,
+			NonFinite:        v.NonFinite,
+			MinDelta:         v.MinDelta,
+			MaxDelta:         v.MaxDelta,
+		}
+	}
+
+	if jsonConfig.SignatureMaxSkew != "" {
+		duration, err := time.ParseDuration(jsonConfig.SignatureMaxSkew)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature_max_skew format: %w", err)
+		}
+		config.Security.SignatureMaxSkew = duration
+	}
+
+	if config.Storage.Retry, err = jsonConfig.FileRetry.parse(); err != nil {
+		return nil, fmt.Errorf("invalid file_retry: %w", err)
+	}
+
+	if config.Database.Retry, err = jsonConfig.DBRetry.parse(); err != nil {
+		return nil, fmt.Errorf("invalid db_retry: %w", err)
+	}
+
 	return config, nil
 }
 
@@ -183,6 +563,86 @@ func LoadAgentConfigFromFile(filepath string) (*Config, error) {
 		config.Security.CryptoKey = jsonConfig.CryptoKey
 	}
 
+	config.Agent.Compression = jsonConfig.Compression
+	config.Agent.MaxBatchSize = jsonConfig.MaxBatchSize
+
+	config.Security.TLSCA = jsonConfig.TLSCA
+	config.Security.APIKey = jsonConfig.APIKey
+	config.Security.TLSCert = jsonConfig.TLSCert
+	config.Security.TLSKey = jsonConfig.TLSKey
+
+	if config.Agent.Retry, err = jsonConfig.Retry.parse(); err != nil {
+		return nil, fmt.Errorf("invalid retry: %w", err)
+	}
+
+	if jsonConfig.Breaker != nil {
+		config.Agent.Breaker.Threshold = jsonConfig.Breaker.Threshold
+		if jsonConfig.Breaker.OpenTimeout != "" {
+			duration, err := time.ParseDuration(jsonConfig.Breaker.OpenTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid breaker open_timeout format: %w", err)
+			}
+			config.Agent.Breaker.OpenTimeout = duration
+		}
+	}
+
+	if jsonConfig.Spool != nil {
+		config.Agent.Spool.Dir = jsonConfig.Spool.Dir
+		config.Agent.Spool.MaxBatches = jsonConfig.Spool.MaxBatches
+		config.Agent.Spool.MaxBytes = jsonConfig.Spool.MaxBytes
+		if jsonConfig.Spool.MaxAge != "" {
+			duration, err := time.ParseDuration(jsonConfig.Spool.MaxAge)
+			if err != nil {
+				return nil, fmt.Errorf("invalid spool max_age format: %w", err)
+			}
+			config.Agent.Spool.MaxAge = duration
+		}
+	}
+
+	if jsonConfig.Changes != nil {
+		config.Agent.Changes.Enabled = jsonConfig.Changes.Enabled
+		config.Agent.Changes.AbsoluteThreshold = jsonConfig.Changes.AbsoluteThreshold
+		config.Agent.Changes.RelativeThreshold = jsonConfig.Changes.RelativeThreshold
+		if jsonConfig.Changes.ResyncInterval != "" {
+			duration, err := time.ParseDuration(jsonConfig.Changes.ResyncInterval)
+			if err != nil {
+				return nil, fmt.Errorf("invalid changes resync_interval format: %w", err)
+			}
+			config.Agent.Changes.ResyncInterval = duration
+		}
+	}
+
+	if len(jsonConfig.Collectors) > 0 {
+		config.Agent.Collectors = make(map[string]CollectorConfig, len(jsonConfig.Collectors))
+		for name, c := range jsonConfig.Collectors {
+			cc := CollectorConfig{Enabled: c.Enabled}
+			if c.PollInterval != "" {
+				duration, err := time.ParseDuration(c.PollInterval)
+				if err != nil {
+					return nil, fmt.Errorf("invalid poll_interval format for collector %s: %w", name, err)
+				}
+				cc.PollInterval = duration
+			}
+			config.Agent.Collectors[name] = cc
+		}
+	}
+
+	if jsonConfig.Instance != nil {
+		config.Agent.Instance = InstanceConfig{
+			ID:   jsonConfig.Instance.ID,
+			Mode: jsonConfig.Instance.Mode,
+			Tags: jsonConfig.Instance.Tags,
+		}
+	}
+
+	config.Agent.Processes = jsonConfig.Processes
+	config.Agent.CgroupPath = jsonConfig.CgroupPath
+	config.Agent.StatsDAddress = jsonConfig.StatsDAddress
+	config.Agent.StatsDMaxSeries = jsonConfig.StatsDMaxSeries
+	config.Agent.StatsDGaugeTTL = jsonConfig.StatsDGaugeTTL
+	config.Agent.PushAddress = jsonConfig.PushAddress
+	config.Agent.ScrapeTargets = jsonConfig.ScrapeTargets
+
 	return config, nil
 }
 
@@ -201,6 +661,36 @@ func MergeConfigs(higher, lower *Config) *Config {
 	if higher.Server.StoreInterval != 0 {
 		result.Server.StoreInterval = higher.Server.StoreInterval
 	}
+	if higher.Server.Limits.MaxBodySize != 0 {
+		result.Server.Limits.MaxBodySize = higher.Server.Limits.MaxBodySize
+	}
+	if higher.Server.Limits.MaxBatchSize != 0 {
+		result.Server.Limits.MaxBatchSize = higher.Server.Limits.MaxBatchSize
+	}
+	if higher.Server.Limits.RateLimit != 0 {
+		result.Server.Limits.RateLimit = higher.Server.Limits.RateLimit
+	}
+	if higher.Server.Limits.RateBurst != 0 {
+		result.Server.Limits.RateBurst = higher.Server.Limits.RateBurst
+	}
+	if higher.Server.Validation.NamePattern != "" {
+		result.Server.Validation.NamePattern = higher.Server.Validation.NamePattern
+	}
+	if higher.Server.Validation.MaxNameLength != 0 {
+		result.Server.Validation.MaxNameLength = higher.Server.Validation.MaxNameLength
+	}
+	if len(higher.Server.Validation.ReservedPrefixes) > 0 {
+		result.Server.Validation.ReservedPrefixes = higher.Server.Validation.ReservedPrefixes
+	}
+	if higher.Server.Validation.NonFinite != "" {
+		result.Server.Validation.NonFinite = higher.Server.Validation.NonFinite
+	}
+	if higher.Server.Validation.MinDelta != nil {
+		result.Server.Validation.MinDelta = higher.Server.Validation.MinDelta
+	}
+	if higher.Server.Validation.MaxDelta != nil {
+		result.Server.Validation.MaxDelta = higher.Server.Validation.MaxDelta
+	}
 	if higher.Server.PprofAddr != "" {
 		result.Server.PprofAddr = higher.Server.PprofAddr
 	}
@@ -211,11 +701,13 @@ func MergeConfigs(higher, lower *Config) *Config {
 	if higher.Database.DSN != "" {
 		result.Database.DSN = higher.Database.DSN
 	}
+	result.Database.Retry = mergeRetry(higher.Database.Retry, lower.Database.Retry)
 
 	// Storage config
 	if higher.Storage.FileStoragePath != "" {
 		result.Storage.FileStoragePath = higher.Storage.FileStoragePath
 	}
+	result.Storage.Retry = mergeRetry(higher.Storage.Retry, lower.Storage.Retry)
 
 	// Agent config
 	if higher.Agent.ReportInterval != 0 {
@@ -227,6 +719,79 @@ func MergeConfigs(higher, lower *Config) *Config {
 	if higher.Agent.RateLimit != 0 {
 		result.Agent.RateLimit = higher.Agent.RateLimit
 	}
+	if higher.Agent.MaxBatchSize != 0 {
+		result.Agent.MaxBatchSize = higher.Agent.MaxBatchSize
+	}
+	if higher.Agent.Compression != "" {
+		result.Agent.Compression = higher.Agent.Compression
+	}
+	result.Agent.Retry = mergeRetry(higher.Agent.Retry, lower.Agent.Retry)
+	if higher.Agent.Breaker.Threshold != nil {
+		result.Agent.Breaker.Threshold = higher.Agent.Breaker.Threshold
+	}
+	if higher.Agent.Breaker.OpenTimeout != 0 {
+		result.Agent.Breaker.OpenTimeout = higher.Agent.Breaker.OpenTimeout
+	}
+	if higher.Agent.Spool.Dir != "" {
+		result.Agent.Spool.Dir = higher.Agent.Spool.Dir
+	}
+	if higher.Agent.Spool.MaxBatches != 0 {
+		result.Agent.Spool.MaxBatches = higher.Agent.Spool.MaxBatches
+	}
+	if higher.Agent.Spool.MaxBytes != 0 {
+		result.Agent.Spool.MaxBytes = higher.Agent.Spool.MaxBytes
+	}
+	if higher.Agent.Spool.MaxAge != 0 {
+		result.Agent.Spool.MaxAge = higher.Agent.Spool.MaxAge
+	}
+	if higher.Agent.Instance.ID != "" {
+		result.Agent.Instance.ID = higher.Agent.Instance.ID
+	}
+	if higher.Agent.Instance.Mode != "" {
+		result.Agent.Instance.Mode = higher.Agent.Instance.Mode
+	}
+	if len(higher.Agent.Instance.Tags) > 0 {
+		result.Agent.Instance.Tags = higher.Agent.Instance.Tags
+	}
+	if higher.Agent.Changes.Enabled {
+		result.Agent.Changes.Enabled = true
+	}
+	if higher.Agent.Changes.AbsoluteThreshold != 0 {
+		result.Agent.Changes.AbsoluteThreshold = higher.Agent.Changes.AbsoluteThreshold
+	}
+	if higher.Agent.Changes.RelativeThreshold != 0 {
+		result.Agent.Changes.RelativeThreshold = higher.Agent.Changes.RelativeThreshold
+	}
+	if higher.Agent.Changes.ResyncInterval != 0 {
+		result.Agent.Changes.ResyncInterval = higher.Agent.Changes.ResyncInterval
+	}
+	if len(higher.Agent.EnabledCollectors) > 0 {
+		result.Agent.EnabledCollectors = higher.Agent.EnabledCollectors
+	}
+	if len(higher.Agent.Collectors) > 0 {
+		result.Agent.Collectors = higher.Agent.Collectors
+	}
+	if len(higher.Agent.Processes) > 0 {
+		result.Agent.Processes = higher.Agent.Processes
+	}
+	if higher.Agent.CgroupPath != "" {
+		result.Agent.CgroupPath = higher.Agent.CgroupPath
+	}
+	if higher.Agent.StatsDAddress != "" {
+		result.Agent.StatsDAddress = higher.Agent.StatsDAddress
+	}
+	if higher.Agent.StatsDMaxSeries != 0 {
+		result.Agent.StatsDMaxSeries = higher.Agent.StatsDMaxSeries
+	}
+	if higher.Agent.StatsDGaugeTTL != 0 {
+		result.Agent.StatsDGaugeTTL = higher.Agent.StatsDGaugeTTL
+	}
+	if higher.Agent.PushAddress != "" {
+		result.Agent.PushAddress = higher.Agent.PushAddress
+	}
+	if len(higher.Agent.ScrapeTargets) > 0 {
+		result.Agent.ScrapeTargets = higher.Agent.ScrapeTargets
+	}
 
 	// Security config
 	if higher.Security.Key != "" {
@@ -235,6 +800,43 @@ func MergeConfigs(higher, lower *Config) *Config {
 	if higher.Security.CryptoKey != "" {
 		result.Security.CryptoKey = higher.Security.CryptoKey
 	}
+	// режим совместимости включается, если он задан в любом источнике
+	if higher.Security.SignatureLegacy {
+		result.Security.SignatureLegacy = true
+	}
+	if higher.Security.SignatureMaxSkew != 0 {
+		result.Security.SignatureMaxSkew = higher.Security.SignatureMaxSkew
+	}
+	if higher.Security.CryptoKeyDir != "" {
+		result.Security.CryptoKeyDir = higher.Security.CryptoKeyDir
+	}
+	if higher.Security.TLSCert != "" {
+		result.Security.TLSCert = higher.Security.TLSCert
+	}
+	if higher.Security.TLSKey != "" {
+		result.Security.TLSKey = higher.Security.TLSKey
+	}
+	if higher.Security.TLSClientCA != "" {
+		result.Security.TLSClientCA = higher.Security.TLSClientCA
+	}
+	if higher.Security.TLSCA != "" {
+		result.Security.TLSCA = higher.Security.TLSCA
+	}
+	if higher.Security.APIKeysFile != "" {
+		result.Security.APIKeysFile = higher.Security.APIKeysFile
+	}
+	if higher.Security.APIKey != "" {
+		result.Security.APIKey = higher.Security.APIKey
+	}
+	if higher.Security.JWKSFile != "" {
+		result.Security.JWKSFile = higher.Security.JWKSFile
+	}
+	if higher.Security.JWTIssuer != "" {
+		result.Security.JWTIssuer = higher.Security.JWTIssuer
+	}
+	if higher.Security.JWTAudience != "" {
+		result.Security.JWTAudience = higher.Security.JWTAudience
+	}
 
 	// Audit config
 	if higher.Audit.File != "" {
@@ -247,6 +849,30 @@ func MergeConfigs(higher, lower *Config) *Config {
 	return &result
 }
 
+// mergeRetry объединяет настройки политики повторов, заданные поля higher имеют приоритет
+func mergeRetry(higher, lower RetryConfig) RetryConfig {
+	result := lower
+	if higher.MaxAttempts != nil {
+		result.MaxAttempts = higher.MaxAttempts
+	}
+	if higher.InitialInterval != nil {
+		result.InitialInterval = higher.InitialInterval
+	}
+	if higher.MaxInterval != nil {
+		result.MaxInterval = higher.MaxInterval
+	}
+	if higher.Multiplier != nil {
+		result.Multiplier = higher.Multiplier
+	}
+	if higher.Jitter != nil {
+		result.Jitter = higher.Jitter
+	}
+	if higher.MaxElapsedTime != nil {
+		result.MaxElapsedTime = higher.MaxElapsedTime
+	}
+	return result
+}
+
 // SetDefaultsForServer устанавливает значения по умолчанию для сервера
 func SetDefaultsForServer(cfg *Config) {
 	if cfg.Server.Address == "" {
@@ -258,6 +884,12 @@ func SetDefaultsForServer(cfg *Config) {
 	if cfg.Storage.FileStoragePath == "" {
 		cfg.Storage.FileStoragePath = "metrics_data"
 	}
+	if cfg.Security.SignatureMaxSkew == 0 {
+		cfg.Security.SignatureMaxSkew = 5 * time.Minute
+	}
+	if cfg.Server.Limits.MaxBodySize == 0 {
+		cfg.Server.Limits.MaxBodySize = 10 << 20
+	}
 	if cfg.LogLevel == "" {
 		cfg.LogLevel = "info"
 	}
@@ -274,6 +906,19 @@ func SetDefaultsForAgent(cfg *Config) {
 	if cfg.Agent.PollInterval == 0 {
 		cfg.Agent.PollInterval = 2
 	}
+	if cfg.Agent.Breaker.Threshold == nil {
+		threshold := 5
+		cfg.Agent.Breaker.Threshold = &threshold
+	}
+	if cfg.Agent.Breaker.OpenTimeout == 0 {
+		cfg.Agent.Breaker.OpenTimeout = 30 * time.Second
+	}
+	if cfg.Agent.Compression == "" {
+		cfg.Agent.Compression = "gzip"
+	}
+	if cfg.Agent.Changes.ResyncInterval == 0 {
+		cfg.Agent.Changes.ResyncInterval = 5 * time.Minute
+	}
 	if cfg.LogLevel == "" {
 		cfg.LogLevel = "info"
 	}
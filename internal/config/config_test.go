@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/retry"
+)
+
+func TestRetryConfig_ExplicitZero(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"retry":{"jitter":0,"max_interval":"0s","multiplier":3}}`), 0o600))
+
+	fileConfig, err := LoadAgentConfigFromFile(path)
+	require.NoError(t, err)
+
+	t.Setenv("AGENT_RETRY_MAX_ATTEMPTS", "0")
+	t.Setenv("AGENT_RETRY_MAX_ELAPSED_TIME", "30s")
+	var envConfig Config
+	require.NoError(t, env.Parse(&envConfig))
+
+	merged := MergeConfigs(&envConfig, fileConfig)
+	policy := merged.Agent.Retry.Policy(retry.DefaultPolicy())
+
+	// явно заданный ноль снимает ограничение или отключает джиттер
+	assert.Equal(t, 0, policy.MaxAttempts)
+	assert.Equal(t, 0.0, policy.Jitter)
+	assert.Equal(t, time.Duration(0), policy.MaxInterval)
+	assert.Equal(t, 30*time.Second, policy.MaxElapsedTime)
+	assert.Equal(t, 3.0, policy.Multiplier)
+	// незаданные поля берутся из политики по умолчанию
+	assert.Equal(t, time.Second, policy.InitialInterval)
+
+	// без настроек политика не меняется
+	assert.Equal(t, retry.DefaultPolicy(), RetryConfig{}.Policy(retry.DefaultPolicy()))
+}
+
+func TestBreakerConfig_ExplicitZero(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"breaker":{"threshold":3}}`), 0o600))
+
+	fileConfig, err := LoadAgentConfigFromFile(path)
+	require.NoError(t, err)
+
+	// явно заданный ноль отключает выключатель и не заменяется ни файлом, ни значением по умолчанию
+	t.Setenv("BREAKER_THRESHOLD", "0")
+	var envConfig Config
+	require.NoError(t, env.Parse(&envConfig))
+
+	merged := MergeConfigs(&envConfig, fileConfig)
+	SetDefaultsForAgent(merged)
+	require.NotNil(t, merged.Agent.Breaker.Threshold)
+	assert.Equal(t, 0, *merged.Agent.Breaker.Threshold)
+
+	// значение из файла используется, если переменная окружения не задана
+	merged = MergeConfigs(&Config{}, fileConfig)
+	SetDefaultsForAgent(merged)
+	assert.Equal(t, 3, *merged.Agent.Breaker.Threshold)
+
+	// без настроек используется порог по умолчанию
+	cfg := &Config{}
+	SetDefaultsForAgent(cfg)
+	assert.Equal(t, 5, *cfg.Agent.Breaker.Threshold)
+}
@@ -1,19 +1,79 @@
 package crypto
 
 import (
+	"crypto/ecdh"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
-	"encoding/pem"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"os"
 )
 
+// ErrUnknownKeyID возвращается, если конверт зашифрован ключом, которого нет у получателя.
+var ErrUnknownKeyID = errors.New("unknown key id")
+
+// Encryptor шифрует тела запросов агента публичным ключом сервера.
+type Encryptor interface {
+	Encrypt(data []byte) ([]byte, error)
+	// IsEnabled возвращает true, если шифрование настроено.
+	IsEnabled() bool
+	// KeyID возвращает идентификатор ключа, который записывается в конверт.
+	KeyID() string
+}
+
+// Decryptor дешифрует тела запросов на сервере.
+type Decryptor interface {
+	Decrypt(encryptedData []byte) ([]byte, error)
+	// IsEnabled возвращает true, если дешифрование настроено.
+	IsEnabled() bool
+}
+
+// NewEncryptor создаёт шифратор по публичному ключу из файла: RSAEncryptor для ключей RSA
+// и ECIESEncryptor для ключей X25519, Ed25519 и ECDSA. Файл может содержать публичный
+// ключ PKIX или PKCS#1 либо сертификат. При пустом пути шифрование выключено.
+func NewEncryptor(publicKeyPath string) (Encryptor, error) {
+	if publicKeyPath == "" {
+		return &RSAEncryptor{}, nil
+	}
+
+	publicKey, err := loadPublicKey(publicKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load public key: %w", err)
+	}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return &RSAEncryptor{publicKey: key, keyID: KeyID(key)}, nil
+	case *ecdh.PublicKey:
+		return &ECIESEncryptor{publicKey: key, keyID: KeyID(key)}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+}
+
+// KeyID возвращает идентификатор ключа: первые 8 байт SHA-256 от публичного ключа в
+// формате PKIX в шестнадцатеричном виде. Идентификатор вычисляется из самого ключа,
+// поэтому агенту и серверу не нужно согласовывать его отдельно. Ключи Ed25519 и ECDSA
+// предварительно приводятся к ключам ECDH, которыми выполняется шифрование.
+func KeyID(pub any) string {
+	pub, err := normalizePublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
+
 // RSAEncryptor предоставляет функции для асимметричного шифрования RSA
 type RSAEncryptor struct {
 	publicKey  *rsa.PublicKey
 	privateKey *rsa.PrivateKey
+	keyID      string
 }
 
 // NewRSAEncryptorFromPublicKey создает новый RSAEncryptor с публичным ключом для шифрования
@@ -27,8 +87,14 @@ func NewRSAEncryptorFromPublicKey(publicKeyPath string) (*RSAEncryptor, error) {
 		return nil, fmt.Errorf("failed to load public key: %w", err)
 	}
 
+	rsaPub, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA public key")
+	}
+
 	return &RSAEncryptor{
-		publicKey: publicKey,
+		publicKey: rsaPub,
+		keyID:     KeyID(rsaPub),
 	}, nil
 }
 
@@ -43,19 +109,32 @@ func NewRSAEncryptorFromPrivateKey(privateKeyPath string) (*RSAEncryptor, error)
 		return nil, fmt.Errorf("failed to load private key: %w", err)
 	}
 
+	rsaKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA private key")
+	}
+
 	return &RSAEncryptor{
-		privateKey: privateKey,
-		publicKey:  &privateKey.PublicKey,
+		privateKey: rsaKey,
+		publicKey:  &rsaKey.PublicKey,
+		keyID:      KeyID(&rsaKey.PublicKey),
 	}, nil
 }
 
-// Encrypt шифрует данные с помощью публичного ключа
+// KeyID возвращает идентификатор ключа шифрования.
+func (r *RSAEncryptor) KeyID() string {
+	return r.keyID
+}
+
+// Encrypt шифрует данные любого размера в конверт: данные шифруются случайным ключом
+// AES-256-GCM, который шифруется публичным ключом RSA. В конверт записывается
+// идентификатор ключа, по которому сервер выбирает приватный ключ.
 func (r *RSAEncryptor) Encrypt(data []byte) ([]byte, error) {
 	if r.publicKey == nil {
 		return data, nil
 	}
 
-	encryptedData, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, r.publicKey, data, nil)
+	encryptedData, err := sealRSA(r.publicKey, r.keyID, data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encrypt data: %w", err)
 	}
@@ -63,18 +142,18 @@ func (r *RSAEncryptor) Encrypt(data []byte) ([]byte, error) {
 	return encryptedData, nil
 }
 
-// Decrypt дешифрует данные с помощью приватного ключа
+// Decrypt дешифрует данные с помощью приватного ключа. Кроме конвертов поддерживаются
+// данные, целиком зашифрованные RSA-OAEP, которые отправляют агенты предыдущих версий.
 func (r *RSAEncryptor) Decrypt(encryptedData []byte) ([]byte, error) {
 	if r.privateKey == nil {
 		return encryptedData, nil
 	}
 
-	decryptedData, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, r.privateKey, encryptedData, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	if isEnvelope(encryptedData) {
+		return openOwnEnvelope(r.privateKey, r.keyID, encryptedData)
 	}
 
-	return decryptedData, nil
+	return decryptLegacy(r.privateKey, encryptedData)
 }
 
 // IsEnabled возвращает true, если шифрование включено (есть ключи)
@@ -82,47 +161,85 @@ func (r *RSAEncryptor) IsEnabled() bool {
 	return r.publicKey != nil || r.privateKey != nil
 }
 
-// loadPublicKey загружает публичный ключ из файла
-func loadPublicKey(path string) (*rsa.PublicKey, error) {
-	keyData, err := os.ReadFile(path)
+// ECIESEncryptor шифрует данные по схеме ECIES: общий секрет эфемерного ключа и ключа
+// получателя (X25519 или кривая NIST) даёт ключ AES-256-GCM для данных.
+type ECIESEncryptor struct {
+	publicKey  *ecdh.PublicKey
+	privateKey *ecdh.PrivateKey
+	keyID      string
+}
+
+// NewECIESEncryptorFromPrivateKey создаёт ECIESEncryptor с приватным ключом X25519,
+// Ed25519 или ECDSA для дешифрования.
+func NewECIESEncryptorFromPrivateKey(privateKeyPath string) (*ECIESEncryptor, error) {
+	privateKey, err := loadPrivateKey(privateKeyPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read public key file: %w", err)
+		return nil, fmt.Errorf("failed to load private key: %w", err)
 	}
 
-	block, _ := pem.Decode(keyData)
-	if block == nil {
-		return nil, fmt.Errorf("failed to decode PEM block containing public key")
+	ecdhKey, ok := privateKey.(*ecdh.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ECDH-capable private key")
 	}
 
-	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	return &ECIESEncryptor{
+		privateKey: ecdhKey,
+		publicKey:  ecdhKey.PublicKey(),
+		keyID:      KeyID(ecdhKey.PublicKey()),
+	}, nil
+}
+
+// KeyID возвращает идентификатор ключа шифрования.
+func (e *ECIESEncryptor) KeyID() string {
+	return e.keyID
+}
+
+// Encrypt шифрует данные в конверт с эфемерным публичным ключом отправителя.
+func (e *ECIESEncryptor) Encrypt(data []byte) ([]byte, error) {
+	if e.publicKey == nil {
+		return data, nil
+	}
+
+	encryptedData, err := sealECIES(e.publicKey, e.keyID, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %w", err)
+		return nil, fmt.Errorf("failed to encrypt data: %w", err)
 	}
 
-	rsaPub, ok := pub.(*rsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("not an RSA public key")
+	return encryptedData, nil
+}
+
+// Decrypt дешифрует конверт приватным ключом.
+func (e *ECIESEncryptor) Decrypt(encryptedData []byte) ([]byte, error) {
+	if e.privateKey == nil {
+		return encryptedData, nil
 	}
 
-	return rsaPub, nil
+	return openOwnEnvelope(e.privateKey, e.keyID, encryptedData)
 }
 
-// loadPrivateKey загружает приватный ключ из файла
-func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
-	keyData, err := os.ReadFile(path)
+// IsEnabled возвращает true, если шифрование включено (есть ключи)
+func (e *ECIESEncryptor) IsEnabled() bool {
+	return e.publicKey != nil || e.privateKey != nil
+}
+
+// openOwnEnvelope дешифрует конверт единственным ключом получателя с идентификатором keyID.
+func openOwnEnvelope(privateKey any, keyID string, encryptedData []byte) ([]byte, error) {
+	env, err := parseEnvelope(encryptedData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read private key file: %w", err)
+		return nil, err
 	}
-
-	block, _ := pem.Decode(keyData)
-	if block == nil {
-		return nil, fmt.Errorf("failed to decode PEM block containing private key")
+	if env.keyID != "" && env.keyID != keyID {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyID, env.keyID)
 	}
+	return env.open(privateKey)
+}
 
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+// decryptLegacy дешифрует данные, целиком зашифрованные RSA-OAEP.
+func decryptLegacy(privateKey *rsa.PrivateKey, encryptedData []byte) ([]byte, error) {
+	decryptedData, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encryptedData, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
 	}
 
-	return privateKey, nil
+	return decryptedData, nil
 }
@@ -0,0 +1,143 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeyPair создаёт пару ключей RSA и сохраняет её в PEM-файлы в формате, который
+// ожидают конструкторы: PKIX для публичного ключа и PKCS#1 для приватного.
+func writeKeyPair(t *testing.T) (publicPath, privatePath string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	publicPath = filepath.Join(dir, "public.pem")
+	privatePath = filepath.Join(dir, "private.pem")
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o600))
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600))
+
+	return publicPath, privatePath
+}
+
+// largeBatch возвращает JSON пакета из n метрик.
+func largeBatch(t *testing.T, n int) []byte {
+	t.Helper()
+
+	type metric struct {
+		ID    string  `json:"id"`
+		MType string  `json:"type"`
+		Value float64 `json:"value"`
+	}
+	batch := make([]metric, n)
+	for i := range batch {
+		batch[i] = metric{ID: fmt.Sprintf("Gauge%d", i), MType: "gauge", Value: float64(i) * 1.5}
+	}
+
+	data, err := json.Marshal(batch)
+	require.NoError(t, err)
+	return data
+}
+
+func newKeyPair(t *testing.T) (*RSAEncryptor, *RSAEncryptor) {
+	t.Helper()
+
+	publicPath, privatePath := writeKeyPair(t)
+	encryptor, err := NewRSAEncryptorFromPublicKey(publicPath)
+	require.NoError(t, err)
+	decryptor, err := NewRSAEncryptorFromPrivateKey(privatePath)
+	require.NoError(t, err)
+	return encryptor, decryptor
+}
+
+func TestRSAEncryptor_LargeBatches(t *testing.T) {
+	encryptor, decryptor := newKeyPair(t)
+
+	for _, n := range []int{1, 100, 5000} {
+		data := largeBatch(t, n)
+		t.Run(fmt.Sprintf("%d_bytes", len(data)), func(t *testing.T) {
+			encrypted, err := encryptor.Encrypt(data)
+			require.NoError(t, err)
+			assert.NotContains(t, string(encrypted), "Gauge0")
+
+			decrypted, err := decryptor.Decrypt(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, data, decrypted)
+		})
+	}
+}
+
+func TestRSAEncryptor_Tampering(t *testing.T) {
+	encryptor, decryptor := newKeyPair(t)
+
+	encrypted, err := encryptor.Encrypt(largeBatch(t, 100))
+	require.NoError(t, err)
+
+	// magic, версия, алгоритм, длина ID ключа, ID ключа и длина зашифрованного ключа
+	headerLen := 9 + len(encryptor.KeyID())
+
+	testCases := []struct {
+		name   string
+		modify func([]byte) []byte
+		err    error
+	}{
+		{name: "ciphertext", modify: func(b []byte) []byte { b[len(b)-1] ^= 1; return b }},
+		{name: "nonce", modify: func(b []byte) []byte { b[headerLen+256] ^= 1; return b }},
+		{name: "wrapped_key", modify: func(b []byte) []byte { b[headerLen] ^= 1; return b }},
+		{name: "key_id", modify: func(b []byte) []byte { b[7] ^= 1; return b }, err: ErrUnknownKeyID},
+		{name: "version", modify: func(b []byte) []byte { b[4] = 99; return b }, err: ErrUnsupportedEnvelope},
+		{name: "truncated", modify: func(b []byte) []byte { return b[:headerLen+10] }, err: ErrInvalidEnvelope},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			modified := tc.modify(append([]byte(nil), encrypted...))
+			_, err := decryptor.Decrypt(modified)
+			require.Error(t, err)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestRSAEncryptor_LegacyPayload(t *testing.T) {
+	encryptor, decryptor := newKeyPair(t)
+
+	data := []byte(`{"id":"PollCount","type":"counter","delta":1}`)
+	legacy, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, encryptor.publicKey, data, nil)
+	require.NoError(t, err)
+
+	decrypted, err := decryptor.Decrypt(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, data, decrypted)
+}
+
+func TestRSAEncryptor_KeyID(t *testing.T) {
+	encryptor, decryptor := newKeyPair(t)
+	require.Len(t, encryptor.KeyID(), 16)
+	assert.Equal(t, encryptor.KeyID(), decryptor.KeyID())
+
+	otherEncryptor, _ := newKeyPair(t)
+	encrypted, err := otherEncryptor.Encrypt([]byte("data"))
+	require.NoError(t, err)
+
+	_, err = decryptor.Decrypt(encrypted)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+}
@@ -0,0 +1,249 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Конверт шифрования версии 2 имеет формат
+//
+//	magic (4 байта) | версия (1) | алгоритм (1) | длина ID ключа (1) | ID ключа |
+//	длина ключа (2, big-endian) | ключ | nonce (12) | шифротекст с тегом AES-GCM
+//
+// Для RSA ключом служит ключ AES, зашифрованный RSA-OAEP, для ECIES — эфемерный
+// публичный ключ отправителя. Версия 1 отличается отсутствием длины и ID ключа.
+// Заголовок до nonce включительно передаётся в AES-GCM как дополнительные данные,
+// поэтому его изменение обнаруживается при расшифровке.
+const (
+	envelopeVersion1 = 1
+	envelopeVersion2 = 2
+
+	// algRSAOAEPAES256GCM — ключ AES-256-GCM, зашифрованный RSA-OAEP с SHA-256.
+	algRSAOAEPAES256GCM = 1
+	// algECIESAES256GCM — ключ AES-256-GCM, выведенный HKDF-SHA256 из общего секрета
+	// ECDH эфемерного ключа отправителя и ключа получателя (X25519 или кривые NIST).
+	algECIESAES256GCM = 2
+
+	contentKeySize = 32
+	gcmNonceSize   = 12
+	gcmTagSize     = 16
+)
+
+// eciesInfo — контекст HKDF при выводе ключа AES из общего секрета ECDH.
+const eciesInfo = "metrics envelope v2 ECIES AES-256-GCM"
+
+var envelopeMagic = []byte("MENV")
+
+// Ошибки разбора конверта
+var (
+	ErrInvalidEnvelope     = errors.New("invalid encryption envelope")
+	ErrUnsupportedEnvelope = errors.New("unsupported envelope version or algorithm")
+)
+
+// envelope — разобранный конверт шифрования.
+type envelope struct {
+	version    byte
+	alg        byte
+	keyID      string
+	wrappedKey []byte
+	nonce      []byte
+	header     []byte // дополнительные данные AES-GCM
+	ciphertext []byte
+}
+
+// isEnvelope сообщает, начинаются ли данные с сигнатуры конверта.
+func isEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, envelopeMagic)
+}
+
+// sealRSA шифрует data случайным ключом AES-256-GCM и упаковывает его вместе
+// с ключом, зашифрованным публичным ключом RSA получателя с идентификатором keyID.
+func sealRSA(pub *rsa.PublicKey, keyID string, data []byte) ([]byte, error) {
+	contentKey := make([]byte, contentKeySize)
+	if _, err := rand.Read(contentKey); err != nil {
+		return nil, fmt.Errorf("failed to generate content key: %w", err)
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, contentKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap content key: %w", err)
+	}
+
+	return sealEnvelope(algRSAOAEPAES256GCM, keyID, wrappedKey, contentKey, data)
+}
+
+// sealECIES шифрует data ключом AES-256-GCM, выведенным из общего секрета эфемерного
+// ключа и публичного ключа ECDH получателя с идентификатором keyID.
+func sealECIES(pub *ecdh.PublicKey, keyID string, data []byte) ([]byte, error) {
+	ephemeral, err := pub.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+
+	contentKey, err := eciesKey(ephemeral, pub, ephemeral.PublicKey(), pub)
+	if err != nil {
+		return nil, err
+	}
+
+	return sealEnvelope(algECIESAES256GCM, keyID, ephemeral.PublicKey().Bytes(), contentKey, data)
+}
+
+// eciesKey выводит ключ AES из общего секрета priv и peer. Солью служат эфемерный
+// ключ и ключ получателя, чтобы ключ AES был привязан к обоим участникам.
+func eciesKey(priv *ecdh.PrivateKey, peer, ephemeral, recipient *ecdh.PublicKey) ([]byte, error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	salt := append(append([]byte(nil), ephemeral.Bytes()...), recipient.Bytes()...)
+
+	key, err := hkdf.Key(sha256.New, shared, salt, eciesInfo, contentKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive content key: %w", err)
+	}
+	return key, nil
+}
+
+// sealEnvelope шифрует data ключом contentKey и упаковывает в конверт версии 2 вместе
+// с ключом wrappedKey, по которому получатель восстановит contentKey.
+func sealEnvelope(alg byte, keyID string, wrappedKey, contentKey, data []byte) ([]byte, error) {
+	if len(keyID) > 255 {
+		return nil, fmt.Errorf("key id is too long: %d bytes", len(keyID))
+	}
+
+	aead, err := newGCM(contentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, 9+len(keyID)+len(wrappedKey)+gcmNonceSize)
+	header = append(header, envelopeMagic...)
+	header = append(header, envelopeVersion2, alg, byte(len(keyID)))
+	header = append(header, keyID...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	header = append(header, nonce...)
+
+	out := make([]byte, len(header), len(header)+len(data)+aead.Overhead())
+	copy(out, header)
+	return aead.Seal(out, nonce, data, header), nil
+}
+
+// parseEnvelope разбирает заголовок конверта версии 1 или 2.
+func parseEnvelope(data []byte) (*envelope, error) {
+	if len(data) < 6 || !isEnvelope(data) {
+		return nil, ErrInvalidEnvelope
+	}
+
+	env := &envelope{version: data[4], alg: data[5]}
+	supported := (env.version == envelopeVersion1 && env.alg == algRSAOAEPAES256GCM) ||
+		(env.version == envelopeVersion2 && (env.alg == algRSAOAEPAES256GCM || env.alg == algECIESAES256GCM))
+	if !supported {
+		return nil, fmt.Errorf("%w: version %d, algorithm %d", ErrUnsupportedEnvelope, env.version, env.alg)
+	}
+
+	pos := 6
+	if env.version == envelopeVersion2 {
+		if len(data) < pos+1 {
+			return nil, ErrInvalidEnvelope
+		}
+		kidLen := int(data[pos])
+		pos++
+		if len(data) < pos+kidLen {
+			return nil, ErrInvalidEnvelope
+		}
+		env.keyID = string(data[pos : pos+kidLen])
+		pos += kidLen
+	}
+
+	if len(data) < pos+2 {
+		return nil, ErrInvalidEnvelope
+	}
+	keyLen := int(binary.BigEndian.Uint16(data[pos:]))
+	pos += 2
+
+	if len(data) < pos+keyLen+gcmNonceSize+gcmTagSize {
+		return nil, ErrInvalidEnvelope
+	}
+	env.wrappedKey = data[pos : pos+keyLen]
+	pos += keyLen
+	env.nonce = data[pos : pos+gcmNonceSize]
+	pos += gcmNonceSize
+	env.header = data[:pos]
+	env.ciphertext = data[pos:]
+
+	return env, nil
+}
+
+// open расшифровывает конверт приватным ключом получателя: *rsa.PrivateKey для RSA
+// или *ecdh.PrivateKey для ECIES.
+func (env *envelope) open(priv any) ([]byte, error) {
+	contentKey, err := env.contentKey(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(contentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := aead.Open(nil, env.nonce, env.ciphertext, env.header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt envelope: %w", err)
+	}
+
+	return data, nil
+}
+
+// contentKey восстанавливает ключ AES конверта.
+func (env *envelope) contentKey(priv any) ([]byte, error) {
+	switch key := priv.(type) {
+	case *rsa.PrivateKey:
+		if env.alg != algRSAOAEPAES256GCM {
+			break
+		}
+		contentKey, err := rsa.DecryptOAEP(sha256.New(), nil, key, env.wrappedKey, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap content key: %w", err)
+		}
+		return contentKey, nil
+	case *ecdh.PrivateKey:
+		if env.alg != algECIESAES256GCM {
+			break
+		}
+		ephemeral, err := key.Curve().NewPublicKey(env.wrappedKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid ephemeral key: %v", ErrInvalidEnvelope, err)
+		}
+		return eciesKey(key, ephemeral, ephemeral, key.PublicKey())
+	}
+	return nil, fmt.Errorf("%w: algorithm %d does not match %T", ErrUnsupportedEnvelope, env.alg, priv)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
@@ -0,0 +1,174 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// keyFileExt — расширение файлов приватных ключей в каталоге ключей.
+const keyFileExt = ".pem"
+
+// KeyRing хранит несколько приватных ключей сервера, индексированных по идентификатору
+// ключа. Конверты версии 2 дешифруются ключом, указанным в конверте, поэтому агенты
+// могут переходить на новый ключ постепенно, пока старый ещё загружен. Конверты без
+// идентификатора и данные старых агентов дешифруются перебором ключей.
+type KeyRing struct {
+	keyFile string
+	keyDir  string
+
+	mu    sync.RWMutex
+	keys  map[string]any // *rsa.PrivateKey или *ecdh.PrivateKey
+	order []string
+}
+
+// NewKeyRing загружает приватный ключ из файла keyFile и все ключи *.pem из каталога keyDir.
+// Поддерживаются ключи RSA, X25519, Ed25519 и ECDSA в форматах PKCS#1, PKCS#8 и SEC 1.
+// Пустые пути пропускаются; если оба пути пустые, дешифрование выключено.
+func NewKeyRing(keyFile, keyDir string) (*KeyRing, error) {
+	k := &KeyRing{keyFile: keyFile, keyDir: keyDir}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload заново читает ключи из файла и каталога. Если хотя бы один ключ не загрузился,
+// остаются ранее загруженные ключи, чтобы ошибка в каталоге не остановила приём метрик.
+func (k *KeyRing) Reload() error {
+	paths, err := k.keyPaths()
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]any, len(paths))
+	order := make([]string, 0, len(paths))
+	for _, path := range paths {
+		privateKey, err := loadPrivateKey(path)
+		if err != nil {
+			return fmt.Errorf("failed to load private key %s: %w", path, err)
+		}
+
+		id := KeyID(publicKeyOf(privateKey))
+		if _, ok := keys[id]; ok {
+			continue
+		}
+		keys[id] = privateKey
+		order = append(order, id)
+	}
+
+	if (k.keyFile != "" || k.keyDir != "") && len(keys) == 0 {
+		return errors.New("no private keys found")
+	}
+
+	k.mu.Lock()
+	k.keys, k.order = keys, order
+	k.mu.Unlock()
+	return nil
+}
+
+// keyPaths возвращает файл ключа и отсортированные файлы *.pem из каталога ключей.
+func (k *KeyRing) keyPaths() ([]string, error) {
+	var paths []string
+	if k.keyFile != "" {
+		paths = append(paths, k.keyFile)
+	}
+	if k.keyDir == "" {
+		return paths, nil
+	}
+
+	entries, err := os.ReadDir(k.keyDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key directory: %w", err)
+	}
+
+	var dirPaths []string
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != keyFileExt {
+			continue
+		}
+		dirPaths = append(dirPaths, filepath.Join(k.keyDir, e.Name()))
+	}
+	sort.Strings(dirPaths)
+
+	return append(paths, dirPaths...), nil
+}
+
+// KeyIDs возвращает идентификаторы загруженных ключей.
+func (k *KeyRing) KeyIDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return append([]string(nil), k.order...)
+}
+
+// IsEnabled возвращает true, если загружен хотя бы один ключ.
+func (k *KeyRing) IsEnabled() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.keys) > 0
+}
+
+// Decrypt дешифрует данные ключом из конверта или перебором ключей для конвертов версии 1
+// и данных, целиком зашифрованных RSA-OAEP.
+func (k *KeyRing) Decrypt(encryptedData []byte) ([]byte, error) {
+	k.mu.RLock()
+	keys, order := k.keys, k.order
+	k.mu.RUnlock()
+
+	if len(keys) == 0 {
+		return encryptedData, nil
+	}
+
+	if !isEnvelope(encryptedData) {
+		return tryKeys(keys, order, func(privateKey any) ([]byte, error) {
+			rsaKey, ok := privateKey.(*rsa.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("%w: legacy payload requires an RSA key", ErrUnsupportedEnvelope)
+			}
+			return decryptLegacy(rsaKey, encryptedData)
+		})
+	}
+
+	env, err := parseEnvelope(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+
+	if env.keyID == "" {
+		return tryKeys(keys, order, env.open)
+	}
+
+	privateKey, ok := keys[env.keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyID, env.keyID)
+	}
+	return env.open(privateKey)
+}
+
+// tryKeys вызывает decrypt с каждым ключом по порядку до первого успеха.
+func tryKeys(keys map[string]any, order []string, decrypt func(any) ([]byte, error)) ([]byte, error) {
+	var err error
+	for _, id := range order {
+		var data []byte
+		if data, err = decrypt(keys[id]); err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+// publicKeyOf возвращает публичный ключ приватного ключа RSA или ECDH.
+func publicKeyOf(privateKey any) any {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return &key.PublicKey
+	case *ecdh.PrivateKey:
+		return key.PublicKey()
+	}
+	return nil
+}
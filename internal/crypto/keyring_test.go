@@ -0,0 +1,151 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// moveKey переносит приватный ключ в каталог ключей под именем name.
+func moveKey(t *testing.T, privatePath, dir, name string) {
+	t.Helper()
+	data, err := os.ReadFile(privatePath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+}
+
+// sealEnvelopeV1 шифрует data в конверт версии 1, который отправляли агенты до
+// появления идентификаторов ключей.
+func sealEnvelopeV1(t *testing.T, encryptor *RSAEncryptor, data []byte) []byte {
+	t.Helper()
+
+	contentKey := make([]byte, contentKeySize)
+	_, err := rand.Read(contentKey)
+	require.NoError(t, err)
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, encryptor.publicKey, contentKey, nil)
+	require.NoError(t, err)
+	aead, err := newGCM(contentKey)
+	require.NoError(t, err)
+
+	header := append([]byte(nil), envelopeMagic...)
+	header = append(header, envelopeVersion1, algRSAOAEPAES256GCM)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+	nonce := make([]byte, gcmNonceSize)
+	header = append(header, nonce...)
+
+	return aead.Seal(header, nonce, data, header)
+}
+
+func newEncryptor(t *testing.T, publicPath string) *RSAEncryptor {
+	t.Helper()
+	encryptor, err := NewRSAEncryptorFromPublicKey(publicPath)
+	require.NoError(t, err)
+	return encryptor
+}
+
+func TestKeyRing_Rotation(t *testing.T) {
+	oldPublic, oldPrivate := writeKeyPair(t)
+	newPublic, newPrivate := writeKeyPair(t)
+	oldAgent, newAgent := newEncryptor(t, oldPublic), newEncryptor(t, newPublic)
+
+	dir := t.TempDir()
+	moveKey(t, oldPrivate, dir, "old.pem")
+	// файлы с другим расширением не считаются ключами
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("keys"), 0o600))
+
+	ring, err := NewKeyRing("", dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{oldAgent.KeyID()}, ring.KeyIDs())
+
+	data := []byte(`{"id":"PollCount","type":"counter","delta":1}`)
+	fromNew, err := newAgent.Encrypt(data)
+	require.NoError(t, err)
+	_, err = ring.Decrypt(fromNew)
+	require.ErrorIs(t, err, ErrUnknownKeyID)
+
+	// новый ключ добавляется без перезапуска, старый продолжает работать
+	moveKey(t, newPrivate, dir, "new.pem")
+	require.NoError(t, ring.Reload())
+	assert.ElementsMatch(t, []string{oldAgent.KeyID(), newAgent.KeyID()}, ring.KeyIDs())
+
+	for _, agent := range []*RSAEncryptor{oldAgent, newAgent} {
+		encrypted, err := agent.Encrypt(data)
+		require.NoError(t, err)
+		decrypted, err := ring.Decrypt(encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, data, decrypted)
+	}
+
+	// после удаления старого ключа его конверты отклоняются
+	require.NoError(t, os.Remove(filepath.Join(dir, "old.pem")))
+	require.NoError(t, ring.Reload())
+	fromOld, err := oldAgent.Encrypt(data)
+	require.NoError(t, err)
+	_, err = ring.Decrypt(fromOld)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+}
+
+func TestKeyRing_ReloadKeepsKeysOnError(t *testing.T) {
+	publicPath, privatePath := writeKeyPair(t)
+	dir := t.TempDir()
+	moveKey(t, privatePath, dir, "a.pem")
+
+	ring, err := NewKeyRing("", dir)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a key"), 0o600))
+	require.Error(t, ring.Reload())
+
+	encrypted, err := newEncryptor(t, publicPath).Encrypt([]byte("data"))
+	require.NoError(t, err)
+	decrypted, err := ring.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), decrypted)
+}
+
+func TestKeyRing_UntaggedPayloads(t *testing.T) {
+	_, firstPrivate := writeKeyPair(t)
+	publicPath, secondPrivate := writeKeyPair(t)
+	dir := t.TempDir()
+	moveKey(t, secondPrivate, dir, "second.pem")
+
+	ring, err := NewKeyRing(firstPrivate, dir)
+	require.NoError(t, err)
+	require.Len(t, ring.KeyIDs(), 2)
+
+	encryptor := newEncryptor(t, publicPath)
+	data := []byte("legacy agent")
+
+	legacy, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, encryptor.publicKey, data, nil)
+	require.NoError(t, err)
+	decrypted, err := ring.Decrypt(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, data, decrypted)
+
+	// конверт версии 1 не содержит идентификатора ключа
+	v1 := sealEnvelopeV1(t, encryptor, data)
+	decrypted, err = ring.Decrypt(v1)
+	require.NoError(t, err)
+	assert.Equal(t, data, decrypted)
+}
+
+func TestKeyRing_Disabled(t *testing.T) {
+	ring, err := NewKeyRing("", "")
+	require.NoError(t, err)
+	assert.False(t, ring.IsEnabled())
+
+	data, err := ring.Decrypt([]byte("plain"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("plain"), data)
+
+	_, err = NewKeyRing("", t.TempDir())
+	assert.Error(t, err)
+}
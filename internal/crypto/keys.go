@@ -0,0 +1,147 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+)
+
+// loadPublicKey загружает публичный ключ из файла: PKIX (PUBLIC KEY), PKCS#1
+// (RSA PUBLIC KEY) или сертификат X.509 (CERTIFICATE). Возвращает *rsa.PublicKey
+// или *ecdh.PublicKey.
+func loadPublicKey(path string) (any, error) {
+	keyData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key file: %w", err)
+	}
+
+	for block, rest := pem.Decode(keyData); block != nil; block, rest = pem.Decode(rest) {
+		var pub any
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				pub = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		return normalizePublicKey(pub)
+	}
+
+	return nil, fmt.Errorf("failed to decode PEM block containing public key")
+}
+
+// loadPrivateKey загружает приватный ключ из файла: PKCS#1 (RSA PRIVATE KEY),
+// PKCS#8 (PRIVATE KEY) или SEC 1 (EC PRIVATE KEY). Возвращает *rsa.PrivateKey
+// или *ecdh.PrivateKey.
+func loadPrivateKey(path string) (any, error) {
+	keyData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+
+	for block, rest := pem.Decode(keyData); block != nil; block, rest = pem.Decode(rest) {
+		var key any
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		default:
+			// например, EC PARAMETERS перед ключом в выводе openssl ecparam
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		return normalizePrivateKey(key)
+	}
+
+	return nil, fmt.Errorf("failed to decode PEM block containing private key")
+}
+
+// normalizePublicKey приводит публичный ключ к ключу, которым выполняется шифрование:
+// RSA остаётся как есть, ECDSA и Ed25519 преобразуются в ключи ECDH.
+func normalizePublicKey(pub any) (any, error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey, *ecdh.PublicKey:
+		return key, nil
+	case *ecdsa.PublicKey:
+		return key.ECDH()
+	case ed25519.PublicKey:
+		return ed25519PublicKeyToX25519(key)
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// normalizePrivateKey приводит приватный ключ к ключу, которым выполняется дешифрование.
+func normalizePrivateKey(priv any) (any, error) {
+	switch key := priv.(type) {
+	case *rsa.PrivateKey, *ecdh.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key.ECDH()
+	case ed25519.PrivateKey:
+		return ed25519PrivateKeyToX25519(key)
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", priv)
+}
+
+// curve25519P — порядок поля кривых Curve25519 и Edwards25519: 2^255 - 19.
+var curve25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// ed25519PublicKeyToX25519 переводит точку Edwards25519 в координату u кривой
+// Curve25519 по формуле u = (1 + y) / (1 - y) (RFC 7748, раздел 4.1).
+func ed25519PublicKeyToX25519(pub ed25519.PublicKey) (*ecdh.PublicKey, error) {
+	if len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 public key size %d", len(pub))
+	}
+
+	// y записан в little-endian, старший бит — знак x
+	yBytes := slices.Clone([]byte(pub))
+	yBytes[31] &= 0x7f
+	slices.Reverse(yBytes)
+	y := new(big.Int).SetBytes(yBytes)
+	if y.Cmp(curve25519P) >= 0 {
+		return nil, fmt.Errorf("invalid Ed25519 public key")
+	}
+
+	num := new(big.Int).Add(big.NewInt(1), y)
+	den := new(big.Int).Sub(big.NewInt(1), y)
+	den.Mod(den, curve25519P)
+	if den.Sign() == 0 {
+		return nil, fmt.Errorf("invalid Ed25519 public key")
+	}
+
+	u := num.Mul(num, den.ModInverse(den, curve25519P))
+	u.Mod(u, curve25519P)
+
+	uBytes := u.FillBytes(make([]byte, 32))
+	slices.Reverse(uBytes)
+	return ecdh.X25519().NewPublicKey(uBytes)
+}
+
+// ed25519PrivateKeyToX25519 возвращает ключ X25519 с тем же скаляром, что и ключ Ed25519:
+// первой половиной SHA-512 от seed (ограничение битов выполняет X25519).
+func ed25519PrivateKeyToX25519(priv ed25519.PrivateKey) (*ecdh.PrivateKey, error) {
+	h := sha512.Sum512(priv.Seed())
+	return ecdh.X25519().NewPrivateKey(h[:32])
+}
@@ -0,0 +1,187 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePEM сохраняет блоки PEM в файл dir/name.
+func writePEM(t *testing.T, dir, name string, blocks ...*pem.Block) string {
+	t.Helper()
+
+	var data []byte
+	for _, b := range blocks {
+		data = append(data, pem.EncodeToMemory(b)...)
+	}
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+// writePKCS8Pair сохраняет приватный ключ в PKCS#8 и публичный в PKIX, как openssl genpkey.
+func writePKCS8Pair(t *testing.T, dir string, priv any, pub any) (publicPath, privatePath string) {
+	t.Helper()
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+
+	privatePath = writePEM(t, dir, "private.pem", &pem.Block{Type: "PRIVATE KEY", Bytes: privDER})
+	publicPath = writePEM(t, dir, "public.pem", &pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	return publicPath, privatePath
+}
+
+func TestEncryptor_KeyTypes(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name  string
+		priv  any
+		pub   any
+		ecies bool
+	}{
+		{name: "rsa", priv: rsaKey, pub: &rsaKey.PublicKey},
+		{name: "x25519", priv: x25519Key, pub: x25519Key.PublicKey(), ecies: true},
+		{name: "ed25519", priv: edPriv, pub: edPub, ecies: true},
+		{name: "ecdsa_p256", priv: p256Key, pub: &p256Key.PublicKey, ecies: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			publicPath, privatePath := writePKCS8Pair(t, dir, tc.priv, tc.pub)
+
+			encryptor, err := NewEncryptor(publicPath)
+			require.NoError(t, err)
+			require.True(t, encryptor.IsEnabled())
+			_, isECIES := encryptor.(*ECIESEncryptor)
+			assert.Equal(t, tc.ecies, isECIES)
+
+			ring, err := NewKeyRing(privatePath, "")
+			require.NoError(t, err)
+			assert.Equal(t, []string{encryptor.KeyID()}, ring.KeyIDs())
+
+			data := largeBatch(t, 1000)
+			encrypted, err := encryptor.Encrypt(data)
+			require.NoError(t, err)
+			decrypted, err := ring.Decrypt(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, data, decrypted)
+		})
+	}
+}
+
+func TestEncryptor_CertificateAsPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "metrics server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certPath := writePEM(t, dir, "server.crt", &pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyPath := writePEM(t, dir, "server.key", &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	encryptor, err := NewRSAEncryptorFromPublicKey(certPath)
+	require.NoError(t, err)
+	decryptor, err := NewRSAEncryptorFromPrivateKey(keyPath)
+	require.NoError(t, err)
+
+	encrypted, err := encryptor.Encrypt([]byte("data"))
+	require.NoError(t, err)
+	decrypted, err := decryptor.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), decrypted)
+}
+
+func TestLoadPrivateKey_SEC1WithParameters(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	// openssl ecparam -genkey записывает параметры кривой перед ключом
+	path := writePEM(t, t.TempDir(), "ec.pem",
+		&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}},
+		&pem.Block{Type: "EC PRIVATE KEY", Bytes: der},
+	)
+
+	decryptor, err := NewECIESEncryptorFromPrivateKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, KeyID(&key.PublicKey), decryptor.KeyID())
+
+	_, err = NewRSAEncryptorFromPrivateKey(path)
+	assert.Error(t, err)
+}
+
+func TestEd25519ToX25519(t *testing.T) {
+	for range 20 {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		xPub, err := ed25519PublicKeyToX25519(pub)
+		require.NoError(t, err)
+		xPriv, err := ed25519PrivateKeyToX25519(priv)
+		require.NoError(t, err)
+		assert.True(t, xPriv.PublicKey().Equal(xPub))
+	}
+}
+
+func TestECIESEncryptor_Tampering(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	publicPath, privatePath := writePKCS8Pair(t, t.TempDir(), key, key.PublicKey())
+
+	encryptor, err := NewEncryptor(publicPath)
+	require.NoError(t, err)
+	decryptor, err := NewECIESEncryptorFromPrivateKey(privatePath)
+	require.NoError(t, err)
+
+	encrypted, err := encryptor.Encrypt([]byte("data"))
+	require.NoError(t, err)
+
+	// эфемерный ключ следует за идентификатором ключа и его длиной
+	ephemeralPos := 9 + len(encryptor.KeyID())
+	modified := append([]byte(nil), encrypted...)
+	modified[ephemeralPos] ^= 1
+	_, err = decryptor.Decrypt(modified)
+	assert.Error(t, err)
+
+	// конверт ECIES нельзя открыть ключом RSA
+	env, err := parseEnvelope(encrypted)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = env.open(rsaKey)
+	assert.ErrorIs(t, err, ErrUnsupportedEnvelope)
+}
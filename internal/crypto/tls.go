@@ -0,0 +1,206 @@
+package crypto
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval — как часто при рукопожатии проверяется время изменения файлов сертификата.
+const certCheckInterval = 10 * time.Second
+
+// CertReloader хранит сертификат TLS и перечитывает его с диска, когда файлы
+// сертификата или ключа изменились, поэтому обновлённый сертификат начинает
+// использоваться без перезапуска. Reload позволяет перечитать файлы принудительно.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	checkInterval time.Duration
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// NewCertReloader загружает сертификат и ключ в формате PEM.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both certificate and key files are required")
+	}
+
+	c := &CertReloader{certFile: certFile, keyFile: keyFile, checkInterval: certCheckInterval}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload перечитывает сертификат и ключ. При ошибке остаётся прежний сертификат.
+func (c *CertReloader) Reload() error {
+	modTime, err := c.filesModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	c.mu.Lock()
+	c.cert, c.modTime, c.lastCheck = &cert, modTime, time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// filesModTime возвращает наибольшее время изменения файлов сертификата и ключа.
+func (c *CertReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat certificate file: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// current возвращает сертификат, перечитывая его не чаще checkInterval, если файлы изменились.
+// Ошибка перечитывания не прерывает рукопожатие: используется прежний сертификат.
+func (c *CertReloader) current() *tls.Certificate {
+	c.mu.RLock()
+	cert, modTime, lastCheck := c.cert, c.modTime, c.lastCheck
+	c.mu.RUnlock()
+
+	if time.Since(lastCheck) < c.checkInterval {
+		return cert
+	}
+
+	c.mu.Lock()
+	c.lastCheck = time.Now()
+	c.mu.Unlock()
+
+	if latest, err := c.filesModTime(); err == nil && latest.After(modTime) {
+		if err := c.Reload(); err == nil {
+			c.mu.RLock()
+			cert = c.cert
+			c.mu.RUnlock()
+		}
+	}
+	return cert
+}
+
+// GetCertificate используется как tls.Config.GetCertificate на сервере.
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.current(), nil
+}
+
+// GetClientCertificate используется как tls.Config.GetClientCertificate на агенте.
+func (c *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.current(), nil
+}
+
+// CAPool хранит центры сертификации из PEM-файла. Reload перечитывает файл, и новые
+// центры сертификации применяются к следующим рукопожатиям.
+type CAPool struct {
+	file string
+
+	mu   sync.RWMutex
+	pool *x509.CertPool
+}
+
+// NewCAPool загружает центры сертификации из PEM-файла.
+func NewCAPool(file string) (*CAPool, error) {
+	p := &CAPool{file: file}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload перечитывает файл. При ошибке остаются прежние центры сертификации.
+func (p *CAPool) Reload() error {
+	pool, err := loadCertPool(p.file)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.pool = pool
+	p.mu.Unlock()
+	return nil
+}
+
+// Pool возвращает текущий набор центров сертификации.
+func (p *CAPool) Pool() *x509.CertPool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pool
+}
+
+// ServerTLSConfig возвращает настройки TLS сервера. Если задан clientCAs, сервер
+// требует от клиентов сертификат, подписанный одним из центров сертификации из набора,
+// и при каждом рукопожатии использует набор, загруженный последним.
+func ServerTLSConfig(certs *CertReloader, clientCAs *CAPool) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+
+	if clientCAs != nil {
+		cfg.ClientCAs = clientCAs.Pool()
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			current := cfg.Clone()
+			current.GetConfigForClient = nil
+			current.ClientCAs = clientCAs.Pool()
+			return current, nil
+		}
+	}
+
+	return cfg, nil
+}
+
+// ClientTLSConfig возвращает настройки TLS агента. Если задан caFile, сертификат сервера
+// проверяется только по центрам сертификации из файла, без системного хранилища.
+// Если задан certs, агент предъявляет клиентский сертификат для mTLS.
+func ClientTLSConfig(caFile string, certs *CertReloader) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certs != nil {
+		cfg.GetClientCertificate = certs.GetClientCertificate
+	}
+
+	return cfg, nil
+}
+
+// loadCertPool загружает сертификаты центров сертификации из PEM-файла.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,255 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA — центр сертификации для тестов, выпускающий сертификаты сервера и клиентов.
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	bundle string
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	bundle := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return &testCA{cert: cert, key: key, bundle: bundle}
+}
+
+// issue выпускает сертификат и сохраняет его с ключом в dir/name.crt и dir/name.key.
+func (ca *testCA) issue(t *testing.T, dir, name string, serial int64, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+// startTLSServer запускает HTTPS-сервер с заданными настройками TLS и возвращает его URL.
+// httptest.Server.StartTLS не подходит: он подставляет свой сертификат, и
+// GetCertificate не вызывается.
+func startTLSServer(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		TLSConfig: cfg,
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+
+	return "https://" + ln.Addr().String()
+}
+
+func get(t *testing.T, cfg *tls.Config, url string) (*x509.Certificate, error) {
+	t.Helper()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return resp.TLS.PeerCertificates[0], nil
+}
+
+func TestTLS_MutualAuthentication(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	serverCert, serverKey := ca.issue(t, dir, "server", 2, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "agent", 3, x509.ExtKeyUsageClientAuth)
+
+	serverCerts, err := NewCertReloader(serverCert, serverKey)
+	require.NoError(t, err)
+	clientCAs, err := NewCAPool(ca.bundle)
+	require.NoError(t, err)
+	serverConfig, err := ServerTLSConfig(serverCerts, clientCAs)
+	require.NoError(t, err)
+	url := startTLSServer(t, serverConfig)
+
+	clientCerts, err := NewCertReloader(clientCert, clientKey)
+	require.NoError(t, err)
+	withCert, err := ClientTLSConfig(ca.bundle, clientCerts)
+	require.NoError(t, err)
+	_, err = get(t, withCert, url)
+	require.NoError(t, err)
+
+	withoutCert, err := ClientTLSConfig(ca.bundle, nil)
+	require.NoError(t, err)
+	_, err = get(t, withoutCert, url)
+	assert.Error(t, err)
+}
+
+func TestTLS_ClientCAReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	serverCert, serverKey := ca.issue(t, dir, "server", 2, x509.ExtKeyUsageServerAuth)
+
+	otherDir := t.TempDir()
+	other := newTestCA(t, otherDir)
+	clientCert, clientKey := other.issue(t, otherDir, "agent", 3, x509.ExtKeyUsageClientAuth)
+
+	clientCABundle := filepath.Join(t.TempDir(), "clients.pem")
+	data, err := os.ReadFile(ca.bundle)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(clientCABundle, data, 0o600))
+
+	serverCerts, err := NewCertReloader(serverCert, serverKey)
+	require.NoError(t, err)
+	clientCAs, err := NewCAPool(clientCABundle)
+	require.NoError(t, err)
+	serverConfig, err := ServerTLSConfig(serverCerts, clientCAs)
+	require.NoError(t, err)
+	url := startTLSServer(t, serverConfig)
+
+	clientCerts, err := NewCertReloader(clientCert, clientKey)
+	require.NoError(t, err)
+	clientConfig, err := ClientTLSConfig(ca.bundle, clientCerts)
+	require.NoError(t, err)
+	clientConfig.ClientSessionCache = nil
+
+	// сертификат агента выпущен центром сертификации, которого ещё нет в наборе сервера
+	_, err = get(t, clientConfig, url)
+	require.Error(t, err)
+
+	// после перечитывания набора тот же сервер принимает агента без перезапуска
+	data, err = os.ReadFile(other.bundle)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(clientCABundle, data, 0o600))
+	require.NoError(t, clientCAs.Reload())
+	_, err = get(t, clientConfig, url)
+	require.NoError(t, err)
+
+	// некорректный файл не заменяет загруженный набор
+	require.NoError(t, os.WriteFile(clientCABundle, []byte("broken"), 0o600))
+	assert.Error(t, clientCAs.Reload())
+	_, err = get(t, clientConfig, url)
+	assert.NoError(t, err)
+}
+
+func TestTLS_CAPinning(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	serverCert, serverKey := ca.issue(t, dir, "server", 2, x509.ExtKeyUsageServerAuth)
+
+	serverCerts, err := NewCertReloader(serverCert, serverKey)
+	require.NoError(t, err)
+	serverConfig, err := ServerTLSConfig(serverCerts, nil)
+	require.NoError(t, err)
+	url := startTLSServer(t, serverConfig)
+
+	pinned, err := ClientTLSConfig(ca.bundle, nil)
+	require.NoError(t, err)
+	_, err = get(t, pinned, url)
+	require.NoError(t, err)
+
+	// сертификат, выпущенный другим центром сертификации, отклоняется
+	otherDir := t.TempDir()
+	other, err := ClientTLSConfig(newTestCA(t, otherDir).bundle, nil)
+	require.NoError(t, err)
+	_, err = get(t, other, url)
+	assert.Error(t, err)
+}
+
+func TestCertReloader_HotReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	serverCert, serverKey := ca.issue(t, dir, "server", 2, x509.ExtKeyUsageServerAuth)
+
+	certs, err := NewCertReloader(serverCert, serverKey)
+	require.NoError(t, err)
+	certs.checkInterval = 0
+	serverConfig, err := ServerTLSConfig(certs, nil)
+	require.NoError(t, err)
+	url := startTLSServer(t, serverConfig)
+
+	clientConfig, err := ClientTLSConfig(ca.bundle, nil)
+	require.NoError(t, err)
+	clientConfig.ClientSessionCache = nil
+
+	peer, err := get(t, clientConfig, url)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), peer.SerialNumber.Int64())
+
+	// новый сертификат записывается поверх старого, сервер подхватывает его без перезапуска
+	newCert, newKey := ca.issue(t, t.TempDir(), "server", 4, x509.ExtKeyUsageServerAuth)
+	for src, dst := range map[string]string{newCert: serverCert, newKey: serverKey} {
+		data, err := os.ReadFile(src)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(dst, data, 0o600))
+		future := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(dst, future, future))
+	}
+
+	peer, err = get(t, clientConfig, url)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), peer.SerialNumber.Int64())
+
+	// некорректные файлы не заменяют загруженный сертификат
+	require.NoError(t, os.WriteFile(serverKey, []byte("broken"), 0o600))
+	require.Error(t, certs.Reload())
+	peer, err = get(t, clientConfig, url)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), peer.SerialNumber.Int64())
+}
@@ -21,4 +21,15 @@ var (
 	ErrEmptyMetrics         = errors.New("empty metrics")
 	ErrMetricIDRequired     = errors.New("metric ID is required")
 	ErrInvalidMetricType    = errors.New("invalid metric type")
+	ErrInstanceRequired     = errors.New("instance is required")
+	ErrInstanceNotFound     = errors.New("instance not found")
+)
+
+// Ошибки политики проверки метрик
+var (
+	ErrInvalidMetricName  = errors.New("invalid metric name")
+	ErrMetricNameTooLong  = errors.New("metric name too long")
+	ErrReservedMetricName = errors.New("metric name uses reserved prefix")
+	ErrNonFiniteValue     = errors.New("gauge value must be finite")
+	ErrDeltaOutOfRange    = errors.New("counter delta out of allowed range")
 )
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"go.uber.org/zap"
+)
+
+// LimitBody читает тело запроса целиком и отклоняет с кодом 413 тела больше maxBytes.
+// Подключается после Gzip, поэтому ограничивается размер распакованного тела и сжатое
+// тело не может развернуться в память без предела. При maxBytes <= 0 размер не ограничен.
+func LimitBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if maxBytes <= 0 {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					logger.Log.Debug("Request body too large", zap.String("uri", r.RequestURI), zap.Int64("limit", maxBytes))
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimiterSweepEvery — через сколько проверок из RateLimiter удаляются полные
+// корзины клиентов, которые не отличаются от новых.
+const rateLimiterSweepEvery = 1024
+
+// RateLimiter ограничивает частоту запросов каждого клиента алгоритмом token bucket:
+// корзина вмещает burst запросов и пополняется со скоростью rate запросов в секунду.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	checks  int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter создаёт RateLimiter. При burst <= 0 корзина вмещает запросы
+// за одну секунду, но не меньше одного. При rate <= 0 ограничение выключено.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst <= 0 {
+		burst = max(1, int(math.Ceil(rate)))
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Enabled возвращает true, если частота запросов ограничена.
+func (l *RateLimiter) Enabled() bool {
+	return l != nil && l.rate > 0
+}
+
+// Allow забирает запрос из корзины клиента key. Если корзина пуста, возвращает false
+// и время, через которое в ней появится запрос.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.checks++
+	if l.checks%rateLimiterSweepEvery == 0 {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / l.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimit отклоняет запросы клиентов, превысивших частоту limiter, с кодом 429
+// и заголовком Retry-After. Клиент определяется по адресу соединения: заголовки
+// X-Forwarded-For и X-Real-IP задаёт сам клиент, и по ним ограничение легко обойти.
+func RateLimit(limiter *RateLimiter) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if !limiter.Enabled() {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				client = r.RemoteAddr
+			}
+
+			if ok, wait := limiter.Allow(client); !ok {
+				seconds := int(math.Ceil(wait.Seconds()))
+				logger.Log.Debug("Rate limit exceeded", zap.String("client", client), zap.Int("retryAfter", seconds))
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, seconds)))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
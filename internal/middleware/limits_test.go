@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/compress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitBody(t *testing.T) {
+	var received int
+	h := Gzip(LimitBody(4096)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received = len(body)
+	})))
+
+	codec, err := compress.Lookup(compress.Gzip)
+	require.NoError(t, err)
+	// 1 МиБ нулей сжимается примерно в килобайт и проходит по размеру сжатого тела
+	bomb, err := compress.Compress(codec, make([]byte, 1<<20))
+	require.NoError(t, err)
+	require.Less(t, len(bomb), 4096)
+	small, err := compress.Compress(codec, make([]byte, 1000))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		body     []byte
+		encoding string
+		status   int
+		received int
+	}{
+		{name: "plain", body: make([]byte, 4096), status: http.StatusOK, received: 4096},
+		{name: "plain_too_large", body: make([]byte, 4097), status: http.StatusRequestEntityTooLarge},
+		{name: "gzip", body: small, encoding: compress.Gzip, status: http.StatusOK, received: 1000},
+		{name: "gzip_bomb", body: bomb, encoding: compress.Gzip, status: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			received = 0
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(tc.body))
+			if tc.encoding != "" {
+				req.Header.Set("Content-Encoding", tc.encoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.status, rec.Code)
+			assert.Equal(t, tc.received, received)
+		})
+	}
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := NewRateLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for range 3 {
+		ok, _ := l.Allow("10.0.0.1")
+		require.True(t, ok)
+	}
+	ok, wait := l.Allow("10.0.0.1")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// у другого клиента своя корзина
+	ok, _ = l.Allow("10.0.0.2")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("10.0.0.1")
+	assert.True(t, ok)
+
+	// корзина пополняется не больше чем до burst
+	now = now.Add(time.Hour)
+	for range 3 {
+		ok, _ = l.Allow("10.0.0.1")
+		require.True(t, ok)
+	}
+	ok, _ = l.Allow("10.0.0.1")
+	assert.False(t, ok)
+}
+
+func TestRateLimit(t *testing.T) {
+	l := NewRateLimiter(0.1, 1)
+	h := RateLimit(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, serve("10.0.0.1:5000", "").Code)
+
+	// другой порт и подменённый X-Forwarded-For не дают новой корзины
+	rec := serve("10.0.0.1:5001", "192.168.1.1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, serve("10.0.0.2:5000", "").Code)
+
+	// без ограничения все запросы проходят
+	h = RateLimit(NewRateLimiter(0, 0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for range 10 {
+		assert.Equal(t, http.StatusOK, serve("10.0.0.1:5000", "").Code)
+	}
+}
@@ -2,9 +2,7 @@ package middleware
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
@@ -13,6 +11,7 @@ import (
 	"github.com/Himany/go-musthave-metrics-tpl/internal/compress"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/crypto"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/sign"
 	"go.uber.org/zap"
 )
 
@@ -42,30 +41,34 @@ func CheckPlainTextContentType(h http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// Gzip распаковывает тело запроса по заголовку Content-Encoding и сжимает ответ кодеком,
+// выбранным по заголовку Accept-Encoding. Поддерживаются gzip, zstd и snappy, запрос
+// с неизвестным способом сжатия отклоняется с кодом 415.
 func Gzip(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// по умолчанию устанавливаем оригинальный http.ResponseWriter как тот,
 		// который будем передавать следующей функции
 		ow := w
 
-		// проверяем, что клиент умеет получать от сервера сжатые данные в формате gzip
-		acceptEncoding := r.Header.Get("Accept-Encoding")
-		supportsGzip := strings.Contains(acceptEncoding, "gzip")
-		if supportsGzip {
+		// выбираем формат сжатия ответа из тех, что умеет получать клиент
+		if codec, ok := compress.Negotiate(r.Header.Get("Accept-Encoding")); ok {
 			// оборачиваем оригинальный http.ResponseWriter новым с поддержкой сжатия
-			cw := compress.NewCompressWriter(w)
+			cw := compress.NewCompressWriter(w, codec)
 			// меняем оригинальный http.ResponseWriter на новый
 			ow = cw
 			// не забываем отправить клиенту все сжатые данные после завершения middleware
 			defer cw.Close()
 		}
 
-		// проверяем, что клиент отправил серверу сжатые данные в формате gzip
-		contentEncoding := r.Header.Get("Content-Encoding")
-		sendsGzip := strings.Contains(contentEncoding, "gzip")
-		if sendsGzip {
+		// проверяем, что клиент отправил серверу сжатые данные
+		if contentEncoding := r.Header.Get("Content-Encoding"); contentEncoding != "" && contentEncoding != "identity" {
+			codec, err := compress.Lookup(contentEncoding)
+			if err != nil {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
 			// оборачиваем тело запроса в io.Reader с поддержкой декомпрессии
-			cr, err := compress.NewCompressReader(r.Body)
+			cr, err := compress.NewCompressReader(r.Body, codec)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				return
@@ -80,9 +83,11 @@ func Gzip(h http.Handler) http.Handler {
 	})
 }
 
-func CheckHash(key string, h http.HandlerFunc) http.HandlerFunc {
+// CheckHash проверяет подпись тела запроса, метку времени и nonce. Если обработчик
+// ответил ошибкой сервера, nonce забывается, чтобы агент мог повторить запрос.
+func CheckHash(verifier *sign.Verifier, h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if key == "" {
+		if !verifier.Enabled() {
 			h(w, r)
 			return
 		}
@@ -94,28 +99,41 @@ func CheckHash(key string, h http.HandlerFunc) http.HandlerFunc {
 		}
 		r.Body = io.NopCloser(bytes.NewReader(body))
 
-		receivedHash := r.Header.Get("HashSHA256")
-		if receivedHash == "" || receivedHash == "none" {
+		verifySignature(verifier, body, h, w, r)
+	}
+}
+
+// CheckPathHash проверяет подпись запросов без тела, например /update/{type}/{name}/{value}:
+// вместо тела подписывается путь запроса.
+func CheckPathHash(verifier *sign.Verifier, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !verifier.Enabled() {
 			h(w, r)
 			return
 		}
 
-		hasher := hmac.New(sha256.New, []byte(key))
-		hasher.Write(body)
-		expectedHash := hasher.Sum(nil)
-
-		receivedHashBytes, err := hex.DecodeString(receivedHash)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+		verifySignature(verifier, []byte(r.URL.Path), h, w, r)
+	}
+}
 
-		if !hmac.Equal(expectedHash, receivedHashBytes) {
-			w.WriteHeader(http.StatusBadRequest)
-			return
+// verifySignature вызывает h, если подпись payload корректна. Запрос без подписи
+// отклоняется с кодом 401, запрос с неверной, устаревшей или повторной подписью — 403.
+// Причина отказа передаётся в теле ответа.
+func verifySignature(verifier *sign.Verifier, payload []byte, h http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	if err := verifier.Verify(r.Header, payload); err != nil {
+		logger.Log.Debug("Signature verification failed", zap.String("uri", r.RequestURI), zap.Error(err))
+		status := http.StatusForbidden
+		if errors.Is(err, sign.ErrMissingSignature) {
+			status = http.StatusUnauthorized
 		}
+		http.Error(w, err.Error(), status)
+		return
+	}
 
-		h(w, r)
+	lw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	h(lw, r)
+	if lw.statusCode >= http.StatusInternalServerError {
+		verifier.Forget(r.Header)
 	}
 }
 
@@ -154,7 +172,7 @@ func LoggingMiddleware(h http.Handler) http.Handler {
 }
 
 // DecryptBody дешифрует тело запроса если включено шифрование
-func DecryptBody(decryptor *crypto.RSAEncryptor) func(http.Handler) http.Handler {
+func DecryptBody(decryptor crypto.Decryptor) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if decryptor == nil || !decryptor.IsEnabled() {
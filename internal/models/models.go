@@ -1,6 +1,10 @@
 package models
 
-import "strconv"
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
 
 // Metrics описывает структуру метрики, передаваемую между агентом и сервером.
 // generate:reset
@@ -11,6 +15,13 @@ type Metrics struct {
 	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
 }
 
+// BatchError описывает метрику пакета, которая не прошла проверку и не была записана.
+type BatchError struct {
+	Index int    `json:"index"` // позиция метрики в пакете
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
 // FormatGaugeValue форматирует значение gauge метрики в строку
 func FormatGaugeValue(value float64) string {
 	return strconv.FormatFloat(value, 'g', -1, 64)
@@ -20,3 +31,88 @@ func FormatGaugeValue(value float64) string {
 func FormatCounterValue(value int64) string {
 	return strconv.FormatInt(value, 10)
 }
+
+// SeriesID формирует имя метрики с метками в виде name{key1=value1,key2=value2}.
+// Метки сортируются по ключу, поэтому одинаковый набор меток всегда даёт одно имя.
+// Метка без значения записывается одним ключом.
+func SeriesID(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		if v := labels[k]; v != "" {
+			b.WriteByte('=')
+			b.WriteString(v)
+		}
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ParseSeriesID разбирает имя, сформированное SeriesID, на имя метрики и метки.
+// Для имени без меток возвращается пустой набор меток.
+func ParseSeriesID(id string) (string, map[string]string) {
+	start := strings.IndexByte(id, '{')
+	if start < 0 || !strings.HasSuffix(id, "}") {
+		return id, nil
+	}
+
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(id[start+1:len(id)-1], ",") {
+		if pair == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		labels[k] = v
+	}
+	return id[:start], labels
+}
+
+// labelReplacer заменяет символы, которые разделяют имя и метки в SeriesID.
+var labelReplacer = strings.NewReplacer(",", "_", "=", "_", "{", "_", "}", "_")
+
+// SanitizeLabel заменяет в ключе или значении метки разделители SeriesID подчёркиванием,
+// чтобы метки из внешних источников не меняли разбор имени в ParseSeriesID.
+func SanitizeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+// Идентификатор агента добавляется к имени метрики префиксом с разделителем
+// InstanceSeparator либо меткой InstanceLabel. Разделитель не может встречаться в именах
+// Prometheus, поэтому имена правил записи вида job:rate5m не принимаются за префикс.
+const (
+	InstanceSeparator = "@"
+	InstanceLabel     = "instance"
+)
+
+// SplitInstance выделяет из имени метрики идентификатор агента и возвращает имя без него.
+// Идентификатором считается значение метки InstanceLabel или префикс до InstanceSeparator.
+// Если идентификатора нет, ok равен false.
+func SplitInstance(id string) (instance string, name string, ok bool) {
+	base, labels := ParseSeriesID(id)
+	if instance, ok := labels[InstanceLabel]; ok {
+		delete(labels, InstanceLabel)
+		return instance, SeriesID(base, labels), true
+	}
+
+	// разделитель ищется только в имени, значения меток могут его содержать
+	instance, rest, ok := strings.Cut(base, InstanceSeparator)
+	if !ok || instance == "" || rest == "" {
+		return "", id, false
+	}
+	return instance, id[len(instance)+len(InstanceSeparator):], true
+}
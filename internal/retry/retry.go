@@ -1,43 +1,143 @@
 package retry
 
 import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
 	"time"
 
 	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
 	"go.uber.org/zap"
 )
 
-// WithRetry повторяет операцию с динамической паузой.
+// Policy описывает политику повторов: экспоненциальная пауза с джиттером,
+// ограничение числа попыток и общего времени выполнения.
+type Policy struct {
+	MaxAttempts     int           // максимальное число попыток (0 — ограничено только MaxElapsedTime)
+	InitialInterval time.Duration // пауза перед второй попыткой
+	MaxInterval     time.Duration // верхняя граница паузы (0 — без ограничения)
+	Multiplier      float64       // множитель роста паузы между попытками
+	Jitter          float64       // доля случайного отклонения паузы в диапазоне [0, 1]
+	MaxElapsedTime  time.Duration // ограничение общего времени (0 — без ограничения)
+}
+
+// Result содержит сведения о выполнении операции с повторами.
+type Result struct {
+	Attempts int           // количество выполненных попыток
+	Elapsed  time.Duration // общее время выполнения с учётом пауз
+}
+
+// DefaultPolicy возвращает политику по умолчанию: 4 попытки с паузами около 1, 2 и 4 секунд.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:     4,
+		InitialInterval: time.Second,
+		MaxInterval:     5 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+	}
+}
+
+// WithRetry повторяет операцию по политике по умолчанию.
 func WithRetry(operation func() error, isRetruableError func(error) bool, inType string) error {
-	retryDelays := []int{0, 1, 3, 5}
+	_, err := DefaultPolicy().Do(context.Background(), operation, isRetruableError, inType)
+	return err
+}
+
+// Do выполняет операцию, повторяя её при ошибках, признанных isRetriable.
+// Первая попытка выполняется всегда, отмена ctx прерывает ожидание между попытками.
+func (p Policy) Do(ctx context.Context, operation func() error, isRetriable func(error) bool, inType string) (Result, error) {
+	start := time.Now()
+	maxAttempts := p.MaxAttempts
+	if maxAttempts <= 0 && p.MaxElapsedTime <= 0 {
+		maxAttempts = 1
+	}
+
+	var res Result
 	var lastErr error
 
-	for attempt := 0; attempt < len(retryDelays); attempt++ {
+	for {
+		res.Attempts++
 		err := operation()
+		res.Elapsed = time.Since(start)
 		if err == nil {
-			return nil
+			return res, nil
 		}
 
 		lastErr = err
-		if !isRetruableError(err) {
-			return err
+		if !isRetriable(err) {
+			return res, err
+		}
+
+		if maxAttempts > 0 && res.Attempts >= maxAttempts {
+			break
+		}
+
+		delay := p.Backoff(res.Attempts)
+		if p.MaxElapsedTime > 0 && res.Elapsed+delay > p.MaxElapsedTime {
+			break
 		}
 
 		logger.Log.Warn("Retriable",
 			zap.String("operation", inType),
-			zap.Int("attempt", attempt+1),
+			zap.Int("attempt", res.Attempts),
+			zap.Duration("delay", delay),
 			zap.Error(err),
 		)
 
-		if retryDelays[attempt] != 0 {
-			time.Sleep(time.Duration(retryDelays[attempt]) * time.Second)
+		if err := sleep(ctx, delay); err != nil {
+			res.Elapsed = time.Since(start)
+			return res, fmt.Errorf("%w: %w", err, lastErr)
 		}
 	}
 
 	logger.Log.Error("operation failed",
 		zap.String("operation", inType),
+		zap.Int("attempts", res.Attempts),
+		zap.Duration("elapsed", res.Elapsed),
 		zap.Error(lastErr),
 	)
 
-	return lastErr
+	return res, lastErr
+}
+
+// Backoff возвращает паузу после попытки с номером attempt (начиная с 1).
+func (p Policy) Backoff(attempt int) time.Duration {
+	if p.InitialInterval <= 0 || attempt < 1 {
+		return 0
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialInterval) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 && delay > float64(p.MaxInterval) {
+		delay = float64(p.MaxInterval)
+	}
+
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay *= 1 + jitter*(2*rand.Float64()-1)
+	}
+
+	return time.Duration(delay)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
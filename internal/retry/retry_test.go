@@ -0,0 +1,108 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTemporary = errors.New("temporary error")
+
+func alwaysRetriable(error) bool { return true }
+
+func TestPolicy_Backoff(t *testing.T) {
+	p := Policy{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2}
+
+	testCases := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{attempt: 0, expected: 0},
+		{attempt: 1, expected: 100 * time.Millisecond},
+		{attempt: 2, expected: 200 * time.Millisecond},
+		{attempt: 4, expected: 800 * time.Millisecond},
+		{attempt: 5, expected: time.Second},
+		{attempt: 10, expected: time.Second},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, p.Backoff(tc.attempt), "attempt %d", tc.attempt)
+	}
+}
+
+func TestPolicy_BackoffJitter(t *testing.T) {
+	p := Policy{InitialInterval: time.Second, Multiplier: 1, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		d := p.Backoff(1)
+		assert.GreaterOrEqual(t, d, 500*time.Millisecond)
+		assert.LessOrEqual(t, d, 1500*time.Millisecond)
+	}
+}
+
+func TestPolicy_Do(t *testing.T) {
+	testCases := []struct {
+		name           string
+		policy         Policy
+		failCount      int
+		retriable      bool
+		expectAttempts int
+		expectError    bool
+	}{
+		{name: "success_first", policy: Policy{MaxAttempts: 3}, failCount: 0, retriable: true, expectAttempts: 1},
+		{name: "success_after_retries", policy: Policy{MaxAttempts: 3}, failCount: 2, retriable: true, expectAttempts: 3},
+		{name: "max_attempts_exceeded", policy: Policy{MaxAttempts: 3}, failCount: 5, retriable: true, expectAttempts: 3, expectError: true},
+		{name: "non_retriable", policy: Policy{MaxAttempts: 3}, failCount: 5, retriable: false, expectAttempts: 1, expectError: true},
+		{name: "zero_policy_single_attempt", policy: Policy{}, failCount: 5, retriable: true, expectAttempts: 1, expectError: true},
+		{
+			name:           "max_elapsed_time",
+			policy:         Policy{InitialInterval: 20 * time.Millisecond, Multiplier: 1, MaxElapsedTime: 50 * time.Millisecond},
+			failCount:      10,
+			retriable:      true,
+			expectAttempts: 3,
+			expectError:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			res, err := tc.policy.Do(context.Background(), func() error {
+				calls++
+				if calls <= tc.failCount {
+					return errTemporary
+				}
+				return nil
+			}, func(error) bool { return tc.retriable }, tc.name)
+
+			assert.Equal(t, tc.expectAttempts, calls, "не совпадает количество вызовов")
+			assert.Equal(t, tc.expectAttempts, res.Attempts, "не совпадает количество попыток в результате")
+			if tc.expectError {
+				assert.ErrorIs(t, err, errTemporary)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPolicy_DoContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{MaxAttempts: 5, InitialInterval: time.Hour}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	res, err := p.Do(ctx, func() error { return errTemporary }, alwaysRetriable, "canceled")
+
+	assert.Less(t, time.Since(start), time.Second, "ожидание не было прервано")
+	assert.Equal(t, 1, res.Attempts)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, errTemporary)
+}
@@ -3,12 +3,22 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 
+	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"go.uber.org/zap"
 )
 
+// batchResponse — ответ на пакет, в котором часть метрик не прошла проверку.
+type batchResponse struct {
+	Accepted int                 `json:"accepted"`
+	Rejected []models.BatchError `json:"rejected"`
+}
+
 // BatchUpdateJSON обновляет несколько метрик, полученных в JSON-массиве одним запросом.
+// Метрики, не прошедшие проверку, не записываются и перечисляются в ответе.
 func (h *Handler) BatchUpdateJSON(w http.ResponseWriter, r *http.Request) {
 	var metrics []models.Metrics
 	var buf bytes.Buffer
@@ -30,20 +40,50 @@ func (h *Handler) BatchUpdateJSON(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	if h.Limits.MaxBatchSize > 0 && len(metrics) > h.Limits.MaxBatchSize {
+		http.Error(w, fmt.Sprintf("batch of %d metrics exceeds limit %d", len(metrics), h.Limits.MaxBatchSize), http.StatusRequestEntityTooLarge)
+		return
+	}
 
 	//Обновляем данные через сервис
-	err = h.Service.BatchUpdate(r.Context(), metrics)
+	rejected, err := h.Service.BatchUpdate(r.Context(), metrics)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	skip := make(map[int]bool, len(rejected))
+	for _, e := range rejected {
+		skip[e.Index] = true
+	}
 	var names []string
-	for _, m := range metrics {
-		names = append(names, m.ID)
+	for i, m := range metrics {
+		if !skip[i] {
+			names = append(names, m.ID)
+		}
 	}
 	h.Audit.Publish(r, names)
 
 	//Отвечаем на запрос
-	w.WriteHeader(http.StatusOK)
+	if len(rejected) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// отклонённые метрики перечисляются в ответе, пакет без принятых метрик — ошибка клиента
+	status := http.StatusOK
+	if len(names) == 0 {
+		status = http.StatusBadRequest
+	}
+	resp, err := json.Marshal(batchResponse{Accepted: len(names), Rejected: rejected})
+	if err != nil {
+		logger.Log.Error("BatchUpdateJSON", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(resp); err != nil {
+		logger.Log.Error("BatchUpdateJSON", zap.Error(err))
+	}
 }
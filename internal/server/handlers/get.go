@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/Himany/go-musthave-metrics-tpl/internal/auth"
 	apperrors "github.com/Himany/go-musthave-metrics-tpl/internal/errors"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
@@ -16,6 +17,7 @@ import (
 )
 
 // GetAllMetrics возвращает список всех доступных метрик в виде HTML-страницы.
+// Метрики, которые клиенту запрещено читать, в список не попадают.
 func (h *Handler) GetAllMetrics(w http.ResponseWriter, r *http.Request) {
 	metricsData, err := h.Service.GetAllMetricsData(r.Context())
 	if err != nil {
@@ -25,6 +27,9 @@ func (h *Handler) GetAllMetrics(w http.ResponseWriter, r *http.Request) {
 
 	list := make([]string, 0, len(metricsData))
 	for name, value := range metricsData {
+		if !auth.CanRead(r.Context(), name) {
+			continue
+		}
 		list = append(list, name+": "+value+";")
 	}
 
@@ -59,6 +64,10 @@ func (h *Handler) GetMetricQuery(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	if !auth.CanRead(r.Context(), metricName) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
 
 	value, err := h.Service.GetMetric(r.Context(), metricType, metricName)
 	if err != nil {
@@ -105,6 +114,11 @@ func (h *Handler) GetMetricJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !auth.CanRead(r.Context(), metrics.ID) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
 	//Получаем данные через сервис
 	result, err := h.Service.GetMetricJSON(r.Context(), metrics)
 	if err != nil {
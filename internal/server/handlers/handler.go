@@ -19,7 +19,9 @@ type MetricsService interface {
 	GetMetric(ctx context.Context, metricType, name string) (interface{}, error)
 	GetMetricJSON(ctx context.Context, metric models.Metrics) (*models.Metrics, error)
 	UpdateMetric(ctx context.Context, metric models.Metrics) error
-	BatchUpdate(ctx context.Context, metrics []models.Metrics) error
+	BatchUpdate(ctx context.Context, metrics []models.Metrics) ([]models.BatchError, error)
+	ListInstances(ctx context.Context, allow func(key string) bool) ([]string, error)
+	GetInstanceMetrics(ctx context.Context, instance string, allow func(key string) bool) ([]models.Metrics, error)
 }
 
 // StorageHandler инкапсулирует доступ к хранилищу метрик.
@@ -32,6 +34,11 @@ type Signer struct {
 	Key string
 }
 
+// Limits ограничивает размер запросов к хендлерам. Нулевое значение снимает ограничение.
+type Limits struct {
+	MaxBatchSize int
+}
+
 // AuditNotifier отвечает за публикацию событий аудита.
 type AuditNotifier struct {
 	Publisher *audit.Publisher
@@ -52,4 +59,5 @@ type Handler struct {
 	Service MetricsService // Новый сервисный слой
 	Signer  Signer
 	Audit   AuditNotifier
+	Limits  Limits
 }
@@ -1,16 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/Himany/go-musthave-metrics-tpl/internal/auth"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/middleware"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/service"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/sign"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/storage"
 )
 
@@ -182,3 +188,262 @@ func TestGetAllMetrics(t *testing.T) {
 		assert.Contains(t, body, "TestCounterMetric: 42;", "Отсутствует counter-метрика в списке")
 	})
 }
+
+func TestGetInstances(t *testing.T) {
+	memStorage := storage.NewMemStorage("", false)
+	metricsService := service.NewMetricsService(memStorage)
+	handler := &Handler{
+		Storage: StorageHandler{Repo: memStorage},
+		Service: metricsService,
+	}
+
+	router := chi.NewRouter()
+	router.Get("/instances/", handler.GetInstances)
+	router.Get("/instances/{instance}", handler.GetInstanceMetrics)
+
+	ctx := context.Background()
+	memStorage.UpdateGauge(ctx, "host-a@Alloc", 1)
+	memStorage.UpdateGauge(ctx, "host-b@Alloc", 2)
+	// имя правила записи Prometheus не содержит идентификатора агента
+	memStorage.UpdateGauge(ctx, "job:rate5m", 4)
+	memStorage.UpdateCounter(ctx, "PollCount{env=prod,instance=host-c}", 5)
+	memStorage.UpdateGauge(ctx, "Alloc", 3)
+
+	t.Run("LIST", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/instances/", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `["host-a","host-b","host-c"]`, w.Body.String())
+	})
+
+	testCases := []struct {
+		name         string
+		instance     string
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "PREFIX", instance: "host-a", expectedCode: http.StatusOK, expectedBody: `[{"id":"Alloc","type":"gauge","value":1}]`},
+		{name: "LABELS", instance: "host-c", expectedCode: http.StatusOK, expectedBody: `[{"id":"PollCount{env=prod}","type":"counter","delta":5}]`},
+		{name: "UNKNOWN", instance: "host-x", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/instances/"+tc.instance, nil))
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			if tc.expectedBody != "" {
+				assert.JSONEq(t, tc.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpdate_StrictSignature(t *testing.T) {
+	memStorage := storage.NewMemStorage("", false)
+	handler := &Handler{
+		Storage: StorageHandler{Repo: memStorage},
+		Service: service.NewMetricsService(memStorage),
+	}
+	verifier := sign.NewVerifier("secret", time.Minute, false)
+
+	router := chi.NewRouter()
+	router.Post("/update/{type}/{name}/{value}", middleware.CheckPlainTextContentType(middleware.CheckPathHash(verifier, handler.UpdateHandlerQuery)))
+
+	const path = "/update/counter/PollCount/5"
+	signed := func(key, path string) map[string]string {
+		headers, err := sign.Headers(key, []byte(path), time.Now())
+		require.NoError(t, err)
+		return headers
+	}
+	replayed := signed("secret", path)
+
+	testCases := []struct {
+		name         string
+		headers      map[string]string
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "UNSIGNED", expectedCode: http.StatusUnauthorized, expectedBody: "signature required"},
+		{name: "WRONG_KEY", headers: signed("other", path), expectedCode: http.StatusForbidden, expectedBody: "invalid signature"},
+		{name: "OTHER_PATH", headers: signed("secret", "/update/counter/PollCount/500"), expectedCode: http.StatusForbidden, expectedBody: "invalid signature"},
+		{name: "SIGNED", headers: replayed, expectedCode: http.StatusOK},
+		{name: "REPLAYED", headers: replayed, expectedCode: http.StatusForbidden, expectedBody: "already used"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, path, nil)
+			req.Header.Set("Content-Type", "text/plain")
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Contains(t, w.Body.String(), tc.expectedBody)
+		})
+	}
+
+	value, ok := memStorage.GetCounter(context.Background(), "PollCount")
+	require.True(t, ok)
+	assert.Equal(t, int64(5), value)
+}
+
+func TestGet_MetricPrefixes(t *testing.T) {
+	memStorage := storage.NewMemStorage("", false)
+	handler := &Handler{
+		Storage: StorageHandler{Repo: memStorage},
+		Service: service.NewMetricsService(memStorage),
+	}
+	ctx := context.Background()
+	memStorage.UpdateGauge(ctx, "app.cpu", 1.5)
+	memStorage.UpdateGauge(ctx, "db.connections", 7)
+
+	router := chi.NewRouter()
+	router.Get("/", handler.GetAllMetrics)
+	router.Get("/value/{type}/{name}", handler.GetMetricQuery)
+	router.Post("/value/", handler.GetMetricJSON)
+
+	reader := &auth.Principal{ID: "dashboard", Scopes: []auth.Scope{auth.ScopeRead}, Prefixes: []string{"app."}}
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), reader)))
+		return w
+	}
+
+	w := serve(httptest.NewRequest(http.MethodGet, "/value/gauge/app.cpu", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1.5", w.Body.String())
+
+	w = serve(httptest.NewRequest(http.MethodGet, "/value/gauge/db.connections", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serve(httptest.NewRequest(http.MethodPost, "/value/", strings.NewReader(`{"id":"db.connections","type":"gauge"}`)))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serve(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "app.cpu")
+	assert.NotContains(t, w.Body.String(), "db.connections")
+}
+
+func TestBatchUpdate_MaxBatchSize(t *testing.T) {
+	memStorage := storage.NewMemStorage("", false)
+	handler := &Handler{
+		Storage: StorageHandler{Repo: memStorage},
+		Service: service.NewMetricsService(memStorage),
+		Limits:  Limits{MaxBatchSize: 2},
+	}
+
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "within_limit", body: `[{"id":"a","type":"counter","delta":1},{"id":"b","type":"counter","delta":1}]`, status: http.StatusOK},
+		{name: "over_limit", body: `[{"id":"a","type":"counter","delta":1},{"id":"b","type":"counter","delta":1},{"id":"c","type":"counter","delta":1}]`, status: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.BatchUpdateJSON(w, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(tc.body)))
+			assert.Equal(t, tc.status, w.Code)
+		})
+	}
+
+	// отклонённый пакет не применяется
+	_, ok := memStorage.GetCounter(context.Background(), "c")
+	assert.False(t, ok)
+}
+
+func TestBatchUpdate_RejectedItems(t *testing.T) {
+	memStorage := storage.NewMemStorage("", false)
+	metricsService := service.NewMetricsService(memStorage)
+	metricsService.SetValidationPolicy(service.ValidationPolicy{ReservedPrefixes: []string{"server."}})
+	handler := &Handler{
+		Storage: StorageHandler{Repo: memStorage},
+		Service: metricsService,
+	}
+
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+		resp   string
+	}{
+		{name: "all_valid", body: `[{"id":"a","type":"counter","delta":1}]`, status: http.StatusOK},
+		{
+			name:   "partial",
+			body:   `[{"id":"a","type":"counter","delta":1},{"id":"server.b","type":"counter","delta":1}]`,
+			status: http.StatusOK,
+			resp:   `{"accepted":1,"rejected":[{"index":1,"id":"server.b","error":"metric name uses reserved prefix: \"server.\""}]}`,
+		},
+		{
+			name:   "all_rejected",
+			body:   `[{"id":"server.b","type":"counter","delta":1}]`,
+			status: http.StatusBadRequest,
+			resp:   `{"accepted":0,"rejected":[{"index":0,"id":"server.b","error":"metric name uses reserved prefix: \"server.\""}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.BatchUpdateJSON(w, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(tc.body)))
+			assert.Equal(t, tc.status, w.Code)
+			if tc.resp == "" {
+				assert.Empty(t, w.Body.String())
+				return
+			}
+			assert.JSONEq(t, tc.resp, w.Body.String())
+		})
+	}
+
+	d, _ := memStorage.GetCounter(context.Background(), "a")
+	assert.Equal(t, int64(2), d)
+}
+
+func TestGetInstances_MetricPrefixes(t *testing.T) {
+	memStorage := storage.NewMemStorage("", false)
+	handler := &Handler{
+		Storage: StorageHandler{Repo: memStorage},
+		Service: service.NewMetricsService(memStorage),
+	}
+	ctx := context.Background()
+	memStorage.UpdateGauge(ctx, "host1@cpu", 1)
+	memStorage.UpdateGauge(ctx, "host2@cpu", 2)
+	memStorage.UpdateGauge(ctx, "cpu{instance=host3}", 3)
+
+	router := chi.NewRouter()
+	router.Get("/instances/", handler.GetInstances)
+	router.Get("/instances/{instance}", handler.GetInstanceMetrics)
+
+	serve := func(prefixes []string, path string) *httptest.ResponseRecorder {
+		reader := &auth.Principal{ID: "dashboard", Scopes: []auth.Scope{auth.ScopeRead}, Prefixes: prefixes}
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), reader)))
+		return w
+	}
+
+	w := serve([]string{"host1@"}, "/instances/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `["host1"]`, w.Body.String())
+
+	w = serve([]string{"host1@"}, "/instances/host1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"id":"cpu","type":"gauge","value":1}]`, w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, serve([]string{"host1@"}, "/instances/host2").Code)
+
+	// права проверяются по полному имени, как в /value/: префикс cpu открывает только
+	// метрики с меткой instance
+	w = serve([]string{"cpu"}, "/instances/")
+	assert.JSONEq(t, `["host3"]`, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, serve([]string{"cpu"}, "/instances/host1").Code)
+}
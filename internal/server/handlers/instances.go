@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/auth"
+	apperrors "github.com/Himany/go-musthave-metrics-tpl/internal/errors"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// GetInstances возвращает JSON-массив идентификаторов агентов, приславших метрики.
+// Агенты, ни одну метрику которых клиенту не разрешено читать, не перечисляются.
+func (h *Handler) GetInstances(w http.ResponseWriter, r *http.Request) {
+	instances, err := h.Service.ListInstances(r.Context(), readFilter(r))
+	if err != nil {
+		logger.Log.Error("GetInstances", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, instances, "GetInstances")
+}
+
+// GetInstanceMetrics возвращает JSON-массив метрик агента с именами без его идентификатора.
+// Метрики, которые клиенту запрещено читать, в ответ не попадают: права проверяются
+// по полному имени с идентификатором агента, как в /value/.
+func (h *Handler) GetInstanceMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics, err := h.Service.GetInstanceMetrics(r.Context(), chi.URLParam(r, "instance"), readFilter(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrInstanceNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, apperrors.ErrInstanceRequired):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			logger.Log.Error("GetInstanceMetrics", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, metrics, "GetInstanceMetrics")
+}
+
+// readFilter возвращает проверку права клиента запроса читать метрику по её полному имени.
+func readFilter(r *http.Request) func(key string) bool {
+	return func(key string) bool {
+		return auth.CanRead(r.Context(), key)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any, op string) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		logger.Log.Error(op, zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(resp); err != nil {
+		logger.Log.Error(op, zap.Error(err))
+	}
+}
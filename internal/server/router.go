@@ -3,28 +3,47 @@ package server
 import (
 	"net/http"
 
+	"github.com/Himany/go-musthave-metrics-tpl/internal/auth"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/crypto"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/middleware"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/server/handlers"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/sign"
 	"github.com/go-chi/chi/v5"
 )
 
-func CreateRouter(handler *handlers.Handler, key string, decryptor *crypto.RSAEncryptor) http.Handler {
+// CreateRouter создаёт роутер сервера. Ключи API apiKeys проверяются на всех маршрутах:
+// чтение требует права read, отправка метрик — write. JWT tokens принимаются только
+// на маршрутах чтения, поэтому агенты отправляют метрики без JWT. Частота запросов
+// ограничивается до распаковки тела, размер тела — после.
+func CreateRouter(handler *handlers.Handler, verifier *sign.Verifier, decryptor crypto.Decryptor, limits config.LimitsConfig, apiKeys, tokens auth.Authenticator) http.Handler {
 	r := chi.NewRouter()
+	r.Use(middleware.LimitBody(limits.MaxBodySize))
 
-	r.Get("/", middleware.CheckPlainTextContentType(handler.GetAllMetrics))
 	r.Get("/ping", handler.GetPing)
-	r.Get("/value/{type}/{name}", middleware.CheckPlainTextContentType(handler.GetMetricQuery))
-	r.Post("/value/", middleware.CheckApplicationJSONContentType(handler.GetMetricJSON))
-	r.Post("/update/{type}/{name}/{value}", middleware.CheckPlainTextContentType(handler.UpdateHandlerQuery))
-	r.With(middleware.DecryptBody(decryptor)).Post("/update/", middleware.CheckApplicationJSONContentType(middleware.CheckHash(key, handler.UpdateHandlerJSON)))
-	r.With(middleware.DecryptBody(decryptor)).Post("/updates/", middleware.CheckApplicationJSONContentType(middleware.CheckHash(key, handler.BatchUpdateJSON)))
 
-	return middleware.LoggingMiddleware(logger.RequestLogger(middleware.Gzip(r)))
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Require(auth.ScopeRead, apiKeys, tokens))
+		r.Get("/", middleware.CheckPlainTextContentType(handler.GetAllMetrics))
+		r.Get("/instances/", handler.GetInstances)
+		r.Get("/instances/{instance}", handler.GetInstanceMetrics)
+		r.Get("/value/{type}/{name}", middleware.CheckPlainTextContentType(handler.GetMetricQuery))
+		r.Post("/value/", middleware.CheckApplicationJSONContentType(handler.GetMetricJSON))
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Require(auth.ScopeWrite, apiKeys))
+		r.Post("/update/{type}/{name}/{value}", middleware.CheckPlainTextContentType(middleware.CheckPathHash(verifier, handler.UpdateHandlerQuery)))
+		r.With(middleware.DecryptBody(decryptor)).Post("/update/", middleware.CheckApplicationJSONContentType(middleware.CheckHash(verifier, handler.UpdateHandlerJSON)))
+		r.With(middleware.DecryptBody(decryptor)).Post("/updates/", middleware.CheckApplicationJSONContentType(middleware.CheckHash(verifier, handler.BatchUpdateJSON)))
+	})
+
+	limiter := middleware.NewRateLimiter(limits.RateLimit, limits.RateBurst)
+	return middleware.LoggingMiddleware(logger.RequestLogger(middleware.RateLimit(limiter)(middleware.Gzip(r))))
 }
 
-func Router(handler *handlers.Handler, runAddr string, key string, decryptor *crypto.RSAEncryptor) error {
-	router := CreateRouter(handler, key, decryptor)
+func Router(handler *handlers.Handler, runAddr string, verifier *sign.Verifier, decryptor crypto.Decryptor, limits config.LimitsConfig) error {
+	router := CreateRouter(handler, verifier, decryptor, limits, nil, nil)
 	return http.ListenAndServe(runAddr, router)
 }
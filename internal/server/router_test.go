@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/auth"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/compress"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/server/handlers"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/service"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/sign"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/storage"
+)
+
+func newTestHandler() *handlers.Handler {
+	repo := storage.NewMemStorage("", false)
+	return &handlers.Handler{
+		Storage: handlers.StorageHandler{Repo: repo},
+		Service: service.NewMetricsService(repo),
+	}
+}
+
+// serveGzip выполняет запрос через роутер от имени клиента, принимающего gzip, как
+// http-клиент Go и resty по умолчанию, и возвращает код ответа и тело, распакованное
+// по заголовку Content-Encoding.
+func serveGzip(t *testing.T, router http.Handler, req *http.Request) (int, string) {
+	t.Helper()
+
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	body := rec.Body.Bytes()
+	if encoding := rec.Header().Get("Content-Encoding"); encoding != "" {
+		codec, err := compress.Lookup(encoding)
+		require.NoError(t, err)
+		zr, err := codec.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		body, err = io.ReadAll(zr)
+		require.NoError(t, err)
+	}
+	return rec.Code, string(body)
+}
+
+func TestCreateRouter_CompressedErrorResponse(t *testing.T) {
+	handler := newTestHandler()
+	handler.Limits = handlers.Limits{MaxBatchSize: 1}
+	router := CreateRouter(handler, sign.NewVerifier("", 0, false), nil, config.LimitsConfig{}, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(`[{"id":"a","type":"counter","delta":1},{"id":"b","type":"counter","delta":1}]`))
+	req.Header.Set("Content-Type", "application/json")
+	code, body := serveGzip(t, router, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	assert.Equal(t, "batch of 2 metrics exceeds limit 1\n", body)
+}
+
+func TestCreateRouter_SignatureErrorReason(t *testing.T) {
+	router := CreateRouter(newTestHandler(), sign.NewVerifier("secret", time.Minute, false), nil, config.LimitsConfig{}, nil, nil)
+	body := `[{"id":"PollCount","type":"counter","delta":1}]`
+
+	// причина отказа читается клиентом, который принимает сжатые ответы
+	req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	code, reason := serveGzip(t, router, req)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "signature required: missing HashSHA256 header\n", reason)
+
+	headers, err := sign.Headers("other", []byte(body), time.Now())
+	require.NoError(t, err)
+	req = httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	code, reason = serveGzip(t, router, req)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "invalid signature: hash mismatch\n", reason)
+}
+
+func TestCreateRouter_BatchRejections(t *testing.T) {
+	repo := storage.NewMemStorage("", false)
+	svc := service.NewMetricsService(repo)
+	svc.SetValidationPolicy(service.ValidationPolicy{ReservedPrefixes: []string{"server."}})
+	handler := &handlers.Handler{Storage: handlers.StorageHandler{Repo: repo}, Service: svc}
+	router := CreateRouter(handler, sign.NewVerifier("", 0, false), nil, config.LimitsConfig{}, nil, nil)
+
+	// префикс агента не обходит запрет, а отказ по каждой метрике читается клиентом
+	req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(`[{"id":"host@server.cpu","type":"gauge","value":1}]`))
+	req.Header.Set("Content-Type", "application/json")
+	code, body := serveGzip(t, router, req)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	var resp struct {
+		Accepted int                 `json:"accepted"`
+		Rejected []models.BatchError `json:"rejected"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	require.Len(t, resp.Rejected, 1)
+	assert.Equal(t, "host@server.cpu", resp.Rejected[0].ID)
+	assert.Contains(t, resp.Rejected[0].Error, "reserved")
+}
+
+func TestCreateRouter_JWTOnlyGuardsReads(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	jwks := filepath.Join(t.TempDir(), "jwks.json")
+	key := base64.RawURLEncoding.EncodeToString(pub)
+	require.NoError(t, os.WriteFile(jwks, []byte(fmt.Sprintf(`{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"k1","x":"%s"}]}`, key)), 0o600))
+
+	tokens, err := auth.NewJWTAuthenticator(jwks, "idp", "metrics")
+	require.NoError(t, err)
+	apiKeys, err := auth.NewKeyRing("")
+	require.NoError(t, err)
+
+	router := CreateRouter(newTestHandler(), sign.NewVerifier("", 0, false), nil, config.LimitsConfig{}, apiKeys, tokens)
+
+	// агент без JWT по-прежнему отправляет метрики
+	req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(`[{"id":"PollCount","type":"counter","delta":1}]`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// чтение без токена отклоняется
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/value/counter/PollCount", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -3,15 +3,22 @@ package server
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/Himany/go-musthave-metrics-tpl/internal/auth"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/crypto"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/logger"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/retry"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/server/handlers"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/service"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/sign"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/storage"
 	"go.uber.org/zap"
 )
@@ -27,14 +34,17 @@ func Run(cfg *config.Config) error {
 		if err != nil {
 			logger.Log.Error("failed to open database (postgres)", zap.Error(err))
 		} else {
-			repo, err = storage.NewPostgresStorage(db)
+			dbStorage, err := storage.NewPostgresStorage(db)
 			if err != nil {
 				logger.Log.Fatal("failed to init database storage", zap.Error(err))
 			}
+			dbStorage.SetRetryPolicy(cfg.Database.Retry.Policy(retry.DefaultPolicy()))
+			repo = dbStorage
 		}
 	} else {
 		withSync := cfg.Server.StoreInterval == 0 && cfg.Storage.FileStoragePath != ""
 		memStorage = storage.NewMemStorage(cfg.Storage.FileStoragePath, withSync)
+		memStorage.SetRetryPolicy(cfg.Storage.Retry.Policy(retry.DefaultPolicy()))
 
 		if cfg.Storage.FileStoragePath != "" {
 			if cfg.Server.Restore {
@@ -49,28 +59,70 @@ func Run(cfg *config.Config) error {
 		repo = memStorage
 	}
 
+	policy, err := validationPolicy(cfg.Server.Validation)
+	if err != nil {
+		return err
+	}
+	metricsService := service.NewMetricsService(repo)
+	metricsService.SetValidationPolicy(policy)
+
 	handler := &handlers.Handler{
 		Storage: handlers.StorageHandler{Repo: repo},
+		Service: metricsService,
 		Signer:  handlers.Signer{Key: cfg.Security.Key},
+		Limits:  handlers.Limits{MaxBatchSize: cfg.Server.Limits.MaxBatchSize},
 	}
 
 	startPprof(cfg.Server.PprofAddr)
 
-	decryptor, err := crypto.NewRSAEncryptorFromPrivateKey(cfg.Security.CryptoKey)
+	decryptor, err := crypto.NewKeyRing(cfg.Security.CryptoKey, cfg.Security.CryptoKeyDir)
+	if err != nil {
+		return err
+	}
+	if decryptor.IsEnabled() {
+		logger.Log.Info("Private keys loaded", zap.Strings("keyIDs", decryptor.KeyIDs()))
+	}
+
+	verifier := sign.NewVerifier(cfg.Security.Key, cfg.Security.SignatureMaxSkew, cfg.Security.SignatureLegacy)
+	apiKeys, err := auth.NewKeyRing(cfg.Security.APIKeysFile)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := auth.NewJWTAuthenticator(cfg.Security.JWKSFile, cfg.Security.JWTIssuer, cfg.Security.JWTAudience)
 	if err != nil {
 		return err
 	}
 
-	r := CreateRouter(handler, cfg.Security.Key, decryptor)
+	r := CreateRouter(handler, verifier, decryptor, cfg.Server.Limits, apiKeys, tokens)
 
 	server := &http.Server{
 		Addr:    cfg.Server.Address,
 		Handler: r,
 	}
 
+	certs, clientCAs, err := serverTLS(cfg.Security)
+	if err != nil {
+		return err
+	}
+	if certs != nil {
+		if server.TLSConfig, err = crypto.ServerTLSConfig(certs, clientCAs); err != nil {
+			return err
+		}
+	}
+
 	go func() {
-		logger.Log.Info("Starting HTTP server", zap.String("address", cfg.Server.Address))
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Log.Info("Starting HTTP server", zap.String("address", cfg.Server.Address),
+			zap.Bool("tls", certs != nil), zap.Bool("mTLS", certs != nil && cfg.Security.TLSClientCA != ""))
+
+		var err error
+		if certs != nil {
+			// сертификат берётся из TLSConfig.GetCertificate
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Log.Fatal("Server startup failed", zap.Error(err))
 		}
 	}()
@@ -78,6 +130,8 @@ func Run(cfg *config.Config) error {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	defer stop()
 
+	go reloadOnHangup(ctx, decryptor, certs, clientCAs, apiKeys, tokens)
+
 	<-ctx.Done()
 
 	stop()
@@ -88,6 +142,114 @@ func Run(cfg *config.Config) error {
 	return gracefulShutdown(server, memStorage, db)
 }
 
+// serverTLS загружает сертификат сервера и центры сертификации агентов. Без настроек TLS
+// возвращаются nil. Если задан любой параметр TLS, сертификат и ключ обязательны, чтобы
+// сервер с неполной конфигурацией не принимал запросы без шифрования.
+func serverTLS(c config.SecurityConfig) (*crypto.CertReloader, *crypto.CAPool, error) {
+	if c.TLSCert == "" && c.TLSKey == "" && c.TLSClientCA == "" {
+		return nil, nil, nil
+	}
+	if c.TLSCert == "" || c.TLSKey == "" {
+		return nil, nil, errors.New("invalid TLS config: both TLS_CERT and TLS_KEY are required when TLS or mTLS is configured")
+	}
+
+	certs, err := crypto.NewCertReloader(c.TLSCert, c.TLSKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.TLSClientCA == "" {
+		return certs, nil, nil
+	}
+	clientCAs, err := crypto.NewCAPool(c.TLSClientCA)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certs, clientCAs, nil
+}
+
+// validationPolicy строит политику проверки метрик по конфигурации сервера.
+func validationPolicy(c config.ValidationConfig) (service.ValidationPolicy, error) {
+	pattern, err := service.CompileNamePattern(c.NamePattern)
+	if err != nil {
+		return service.ValidationPolicy{}, err
+	}
+
+	policy := service.ValidationPolicy{
+		NamePattern:      pattern,
+		MaxNameLength:    c.MaxNameLength,
+		ReservedPrefixes: c.ReservedPrefixes,
+		MinDelta:         c.MinDelta,
+		MaxDelta:         c.MaxDelta,
+	}
+
+	switch c.NonFinite {
+	case "", "reject":
+	case "clamp":
+		policy.ClampNonFinite = true
+	default:
+		return service.ValidationPolicy{}, fmt.Errorf("invalid non-finite mode %q: must be reject or clamp", c.NonFinite)
+	}
+
+	if c.MinDelta != nil && c.MaxDelta != nil && *c.MinDelta > *c.MaxDelta {
+		return service.ValidationPolicy{}, fmt.Errorf("counter min delta %d exceeds max delta %d", *c.MinDelta, *c.MaxDelta)
+	}
+
+	return policy, nil
+}
+
+// reloadOnHangup перечитывает приватные ключи, сертификат TLS, центры сертификации
+// агентов, ключи API и JWKS при получении SIGHUP до отмены ctx.
+func reloadOnHangup(ctx context.Context, keys *crypto.KeyRing, certs *crypto.CertReloader, clientCAs *crypto.CAPool, apiKeys *auth.KeyRing, tokens *auth.JWTAuthenticator) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := keys.Reload(); err != nil {
+				logger.Log.Error("Failed to reload private keys", zap.Error(err))
+			} else {
+				logger.Log.Info("Private keys reloaded", zap.Strings("keyIDs", keys.KeyIDs()))
+			}
+
+			if certs != nil {
+				if err := certs.Reload(); err != nil {
+					logger.Log.Error("Failed to reload TLS certificate", zap.Error(err))
+				} else {
+					logger.Log.Info("TLS certificate reloaded")
+				}
+			}
+
+			if clientCAs != nil {
+				if err := clientCAs.Reload(); err != nil {
+					logger.Log.Error("Failed to reload TLS client CA bundle", zap.Error(err))
+				} else {
+					logger.Log.Info("TLS client CA bundle reloaded")
+				}
+			}
+
+			if apiKeys.Enabled() {
+				if err := apiKeys.Reload(); err != nil {
+					logger.Log.Error("Failed to reload API keys", zap.Error(err))
+				} else {
+					logger.Log.Info("API keys reloaded")
+				}
+			}
+
+			if tokens.Enabled() {
+				if err := tokens.Reload(); err != nil {
+					logger.Log.Error("Failed to reload JWKS", zap.Error(err))
+				} else {
+					logger.Log.Info("JWKS reloaded")
+				}
+			}
+		}
+	}
+}
+
 // gracefulShutdown выполняет корректное завершение работы сервера
 func gracefulShutdown(server *http.Server, memStorage *storage.MemStorageData, db *sql.DB) error {
 	logger.Log.Info("Starting graceful shutdown...")
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Himany/go-musthave-metrics-tpl/internal/config"
+)
+
+func TestServerTLS_RequiresCertAndKey(t *testing.T) {
+	certs, clientCAs, err := serverTLS(config.SecurityConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, certs)
+	assert.Nil(t, clientCAs)
+
+	// неполная конфигурация TLS не превращается в сервер без шифрования
+	for name, c := range map[string]config.SecurityConfig{
+		"client_ca_only": {TLSClientCA: "ca.pem"},
+		"key_only":       {TLSKey: "server.key"},
+		"cert_only":      {TLSCert: "server.crt"},
+		"no_key":         {TLSCert: "server.crt", TLSClientCA: "ca.pem"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := serverTLS(c)
+			assert.ErrorContains(t, err, "TLS_CERT and TLS_KEY")
+		})
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"sort"
 
 	apperrors "github.com/Himany/go-musthave-metrics-tpl/internal/errors"
 	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
@@ -10,7 +11,8 @@ import (
 
 // MetricsService предоставляет бизнес-логику для работы с метриками
 type MetricsService struct {
-	repo repository.MetricsRepo
+	repo   repository.MetricsRepo
+	policy ValidationPolicy
 }
 
 // NewMetricsService создает новый экземпляр сервиса метрик
@@ -20,6 +22,11 @@ func NewMetricsService(repo repository.MetricsRepo) *MetricsService {
 	}
 }
 
+// SetValidationPolicy задаёт правила проверки метрик перед записью.
+func (s *MetricsService) SetValidationPolicy(policy ValidationPolicy) {
+	s.policy = policy
+}
+
 // GetAllMetricsData возвращает все метрики в формате для отображения
 func (s *MetricsService) GetAllMetricsData(ctx context.Context) (map[string]string, error) {
 	result := make(map[string]string)
@@ -108,20 +115,14 @@ func (s *MetricsService) GetMetricJSON(ctx context.Context, metric models.Metric
 
 // UpdateMetric обновляет метрику
 func (s *MetricsService) UpdateMetric(ctx context.Context, metric models.Metrics) error {
-	if err := s.validateUpdateMetric(metric); err != nil {
+	if err := s.validateUpdateMetric(&metric); err != nil {
 		return err
 	}
 
 	switch metric.MType {
 	case "gauge":
-		if metric.Value == nil {
-			return apperrors.ErrGaugeValueRequired
-		}
 		s.repo.UpdateGauge(ctx, metric.ID, *metric.Value)
 	case "counter":
-		if metric.Delta == nil {
-			return apperrors.ErrCounterDeltaRequired
-		}
 		current, _ := s.repo.GetCounter(ctx, metric.ID)
 		s.repo.UpdateCounter(ctx, metric.ID, current+*metric.Delta)
 	default:
@@ -131,13 +132,114 @@ func (s *MetricsService) UpdateMetric(ctx context.Context, metric models.Metrics
 	return nil
 }
 
-// BatchUpdate обновляет множество метрик одной операцией
-func (s *MetricsService) BatchUpdate(ctx context.Context, metrics []models.Metrics) error {
+// BatchUpdate обновляет множество метрик одной операцией. Метрики, не прошедшие
+// проверку, пропускаются и возвращаются списком ошибок, остальные записываются.
+// Если не прошла ни одна метрика, хранилище не вызывается.
+func (s *MetricsService) BatchUpdate(ctx context.Context, metrics []models.Metrics) ([]models.BatchError, error) {
 	if len(metrics) == 0 {
-		return apperrors.ErrEmptyMetrics
+		return nil, apperrors.ErrEmptyMetrics
+	}
+
+	var rejected []models.BatchError
+	valid := make([]models.Metrics, 0, len(metrics))
+	for i, m := range metrics {
+		if err := s.validateUpdateMetric(&m); err != nil {
+			rejected = append(rejected, models.BatchError{Index: i, ID: m.ID, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, m)
+	}
+
+	if len(valid) == 0 {
+		return rejected, nil
+	}
+	return rejected, s.repo.BatchUpdate(ctx, valid)
+}
+
+// ListInstances возвращает отсортированный список идентификаторов агентов,
+// добавленных к именам метрик. Если задан allow, учитываются только метрики,
+// полные имена которых он пропускает.
+func (s *MetricsService) ListInstances(ctx context.Context, allow func(key string) bool) ([]string, error) {
+	keys, err := s.allKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	instances := make([]string, 0)
+	for _, key := range keys {
+		instance, _, ok := models.SplitInstance(key)
+		if ok && !seen[instance] && (allow == nil || allow(key)) {
+			seen[instance] = true
+			instances = append(instances, instance)
+		}
+	}
+	sort.Strings(instances)
+
+	return instances, nil
+}
+
+// GetInstanceMetrics возвращает метрики агента instance с именами без идентификатора агента.
+// Если задан allow, возвращаются только метрики, полные имена которых он пропускает.
+func (s *MetricsService) GetInstanceMetrics(ctx context.Context, instance string, allow func(key string) bool) ([]models.Metrics, error) {
+	if instance == "" {
+		return nil, apperrors.ErrInstanceRequired
+	}
+
+	keysGauge, err := s.repo.GetKeyGauge(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keysCounter, err := s.repo.GetKeyCounter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.Metrics, 0)
+	for _, key := range keysGauge {
+		inst, name, ok := models.SplitInstance(key)
+		if !ok || inst != instance || (allow != nil && !allow(key)) {
+			continue
+		}
+		if value, exists := s.repo.GetGauge(ctx, key); exists {
+			result = append(result, models.Metrics{ID: name, MType: "gauge", Value: &value})
+		}
+	}
+	for _, key := range keysCounter {
+		inst, name, ok := models.SplitInstance(key)
+		if !ok || inst != instance || (allow != nil && !allow(key)) {
+			continue
+		}
+		if value, exists := s.repo.GetCounter(ctx, key); exists {
+			result = append(result, models.Metrics{ID: name, MType: "counter", Delta: &value})
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, apperrors.ErrInstanceNotFound
 	}
 
-	return s.repo.BatchUpdate(ctx, metrics)
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ID != result[j].ID {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].MType < result[j].MType
+	})
+
+	return result, nil
+}
+
+// allKeys возвращает имена всех метрик обоих типов.
+func (s *MetricsService) allKeys(ctx context.Context) ([]string, error) {
+	keysGauge, err := s.repo.GetKeyGauge(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keysCounter, err := s.repo.GetKeyCounter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(keysGauge, keysCounter...), nil
 }
 
 // validateGetMetricJSON проверяет корректность данных для получения метрики
@@ -151,13 +253,23 @@ func (s *MetricsService) validateGetMetricJSON(metric models.Metrics) error {
 	return nil
 }
 
-// validateUpdateMetric проверяет корректность данных для обновления метрики
-func (s *MetricsService) validateUpdateMetric(metric models.Metrics) error {
+// validateUpdateMetric проверяет корректность данных для обновления метрики и применяет
+// политику проверки, которая может заменить значение метрики.
+func (s *MetricsService) validateUpdateMetric(metric *models.Metrics) error {
 	if metric.ID == "" {
 		return apperrors.ErrMetricIDRequired
 	}
-	if metric.MType != "gauge" && metric.MType != "counter" {
+	switch metric.MType {
+	case "gauge":
+		if metric.Value == nil {
+			return apperrors.ErrGaugeValueRequired
+		}
+	case "counter":
+		if metric.Delta == nil {
+			return apperrors.ErrCounterDeltaRequired
+		}
+	default:
 		return apperrors.ErrInvalidMetricType
 	}
-	return nil
+	return s.policy.validate(metric)
 }
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	apperrors "github.com/Himany/go-musthave-metrics-tpl/internal/errors"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+)
+
+// ValidationPolicy задаёт правила проверки метрик перед записью. Нулевое значение
+// принимает любые имена и приращения и отклоняет NaN и бесконечные значения gauge.
+type ValidationPolicy struct {
+	// NamePattern — регулярное выражение, которому должно целиком соответствовать имя,
+	// включая идентификатор агента и метки
+	NamePattern *regexp.Regexp
+	// MaxNameLength — наибольшая длина имени в байтах, 0 — без ограничения
+	MaxNameLength int
+	// ReservedPrefixes — префиксы имён, которые клиенты не могут использовать. Проверяется
+	// и имя целиком, и имя без идентификатора агента, чтобы префикс host@ не обходил запрет
+	ReservedPrefixes []string
+	// ClampNonFinite заменяет ±Inf на наибольшее по модулю конечное значение вместо
+	// отказа. NaN не имеет ближайшего конечного значения и отклоняется всегда.
+	ClampNonFinite bool
+	// MinDelta и MaxDelta ограничивают приращение counter, nil — без ограничения
+	MinDelta *int64
+	MaxDelta *int64
+}
+
+// CompileNamePattern компилирует шаблон имени так, чтобы он совпадал с именем целиком.
+// Для пустого шаблона возвращается nil.
+func CompileNamePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metric name pattern: %w", err)
+	}
+	return re, nil
+}
+
+// validate проверяет метрику по политике. В режиме ClampNonFinite бесконечное
+// значение gauge заменяется в metric.
+func (p ValidationPolicy) validate(metric *models.Metrics) error {
+	if p.MaxNameLength > 0 && len(metric.ID) > p.MaxNameLength {
+		return fmt.Errorf("%w: %d bytes, limit %d", apperrors.ErrMetricNameTooLong, len(metric.ID), p.MaxNameLength)
+	}
+	_, name, _ := models.SplitInstance(metric.ID)
+	for _, prefix := range p.ReservedPrefixes {
+		if strings.HasPrefix(metric.ID, prefix) || strings.HasPrefix(name, prefix) {
+			return fmt.Errorf("%w: %q", apperrors.ErrReservedMetricName, prefix)
+		}
+	}
+	if p.NamePattern != nil && !p.NamePattern.MatchString(metric.ID) {
+		return fmt.Errorf("%w: must match %s", apperrors.ErrInvalidMetricName, p.NamePattern)
+	}
+
+	switch metric.MType {
+	case "gauge":
+		v := *metric.Value
+		switch {
+		case math.IsNaN(v):
+			return fmt.Errorf("%w: NaN", apperrors.ErrNonFiniteValue)
+		case math.IsInf(v, 0) && !p.ClampNonFinite:
+			return fmt.Errorf("%w: %v", apperrors.ErrNonFiniteValue, v)
+		case math.IsInf(v, 1):
+			clamped := math.MaxFloat64
+			metric.Value = &clamped
+		case math.IsInf(v, -1):
+			clamped := -math.MaxFloat64
+			metric.Value = &clamped
+		}
+	case "counter":
+		d := *metric.Delta
+		if (p.MinDelta != nil && d < *p.MinDelta) || (p.MaxDelta != nil && d > *p.MaxDelta) {
+			return fmt.Errorf("%w: %d", apperrors.ErrDeltaOutOfRange, d)
+		}
+	}
+	return nil
+}
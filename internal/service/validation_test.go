@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	apperrors "github.com/Himany/go-musthave-metrics-tpl/internal/errors"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/models"
+	"github.com/Himany/go-musthave-metrics-tpl/internal/storage"
+)
+
+func gauge(id string, v float64) models.Metrics {
+	return models.Metrics{ID: id, MType: "gauge", Value: &v}
+}
+
+func counter(id string, d int64) models.Metrics {
+	return models.Metrics{ID: id, MType: "counter", Delta: &d}
+}
+
+func TestValidationPolicy(t *testing.T) {
+	pattern, err := CompileNamePattern(`[A-Za-z][A-Za-z0-9_.]*`)
+	require.NoError(t, err)
+	minDelta, maxDelta := int64(0), int64(1000)
+	policy := ValidationPolicy{
+		NamePattern:      pattern,
+		MaxNameLength:    16,
+		ReservedPrefixes: []string{"server."},
+		MinDelta:         &minDelta,
+		MaxDelta:         &maxDelta,
+	}
+
+	testCases := []struct {
+		name   string
+		metric models.Metrics
+		err    error
+	}{
+		{name: "valid_gauge", metric: gauge("Alloc", 1.5)},
+		{name: "valid_counter", metric: counter("PollCount", 1000)},
+		{name: "pattern_partial_match", metric: gauge("Alloc bytes", 1), err: apperrors.ErrInvalidMetricName},
+		{name: "pattern", metric: gauge("1Alloc", 1), err: apperrors.ErrInvalidMetricName},
+		{name: "too_long", metric: gauge(strings.Repeat("a", 17), 1), err: apperrors.ErrMetricNameTooLong},
+		{name: "reserved", metric: gauge("server.uptime", 1), err: apperrors.ErrReservedMetricName},
+		{name: "reserved_instance_prefix", metric: gauge("h@server.cpu", 1), err: apperrors.ErrReservedMetricName},
+		{name: "nan", metric: gauge("Alloc", math.NaN()), err: apperrors.ErrNonFiniteValue},
+		{name: "inf", metric: gauge("Alloc", math.Inf(1)), err: apperrors.ErrNonFiniteValue},
+		{name: "negative_delta", metric: counter("PollCount", -1), err: apperrors.ErrDeltaOutOfRange},
+		{name: "large_delta", metric: counter("PollCount", 1001), err: apperrors.ErrDeltaOutOfRange},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.validate(&tc.metric)
+			if tc.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestValidationPolicy_Clamp(t *testing.T) {
+	policy := ValidationPolicy{ClampNonFinite: true}
+
+	m := gauge("Alloc", math.Inf(1))
+	require.NoError(t, policy.validate(&m))
+	assert.Equal(t, math.MaxFloat64, *m.Value)
+
+	m = gauge("Alloc", math.Inf(-1))
+	require.NoError(t, policy.validate(&m))
+	assert.Equal(t, -math.MaxFloat64, *m.Value)
+
+	m = gauge("Alloc", math.NaN())
+	assert.ErrorIs(t, policy.validate(&m), apperrors.ErrNonFiniteValue)
+}
+
+func TestMetricsService_BatchUpdate(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.NewMemStorage("", false)
+	s := NewMetricsService(repo)
+	s.SetValidationPolicy(ValidationPolicy{ReservedPrefixes: []string{"server."}})
+
+	rejected, err := s.BatchUpdate(ctx, []models.Metrics{
+		gauge("Alloc", 1),
+		gauge("server.uptime", 1),
+		gauge("Frees", math.NaN()),
+		{ID: "PollCount", MType: "counter"},
+		counter("PollCount", 2),
+	})
+	require.NoError(t, err)
+
+	require.Len(t, rejected, 3)
+	assert.Equal(t, []int{1, 2, 3}, []int{rejected[0].Index, rejected[1].Index, rejected[2].Index})
+	assert.Equal(t, "server.uptime", rejected[0].ID)
+	assert.Contains(t, rejected[2].Error, apperrors.ErrCounterDeltaRequired.Error())
+
+	// принятые метрики записаны, отклонённые — нет
+	v, ok := repo.GetGauge(ctx, "Alloc")
+	require.True(t, ok)
+	assert.Equal(t, 1.0, v)
+	d, ok := repo.GetCounter(ctx, "PollCount")
+	require.True(t, ok)
+	assert.Equal(t, int64(2), d)
+	_, ok = repo.GetGauge(ctx, "server.uptime")
+	assert.False(t, ok)
+
+	// пакет без принятых метрик не доходит до хранилища
+	rejected, err = s.BatchUpdate(ctx, []models.Metrics{gauge("server.cpu", 1)})
+	require.NoError(t, err)
+	assert.Len(t, rejected, 1)
+}
+
+func TestMetricsService_UpdateMetricPolicy(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.NewMemStorage("", false)
+	s := NewMetricsService(repo)
+
+	// по умолчанию бесконечные значения отклоняются
+	assert.ErrorIs(t, s.UpdateMetric(ctx, gauge("Alloc", math.Inf(1))), apperrors.ErrNonFiniteValue)
+
+	s.SetValidationPolicy(ValidationPolicy{ClampNonFinite: true})
+	require.NoError(t, s.UpdateMetric(ctx, gauge("Alloc", math.Inf(1))))
+	v, _ := repo.GetGauge(ctx, "Alloc")
+	assert.Equal(t, math.MaxFloat64, v)
+}
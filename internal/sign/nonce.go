@@ -0,0 +1,60 @@
+package sign
+
+import (
+	"sync"
+	"time"
+)
+
+// nonceSweepEvery — через сколько добавлений из кэша удаляются просроченные nonce.
+const nonceSweepEvery = 1024
+
+// NonceCache хранит использованные nonce до истечения срока, после которого запрос
+// с ними всё равно будет отклонён по метке времени.
+type NonceCache struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	adds    int
+}
+
+func NewNonceCache() *NonceCache {
+	return &NonceCache{expires: make(map[string]time.Time)}
+}
+
+// Add запоминает nonce до момента expires и возвращает false, если nonce уже использован.
+func (c *NonceCache) Add(nonce string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if exp, ok := c.expires[nonce]; ok && now.Before(exp) {
+		return false
+	}
+	c.expires[nonce] = expires
+
+	c.adds++
+	if c.adds%nonceSweepEvery == 0 {
+		c.sweep(now)
+	}
+	return true
+}
+
+// Remove удаляет nonce из кэша.
+func (c *NonceCache) Remove(nonce string) {
+	c.mu.Lock()
+	delete(c.expires, nonce)
+	c.mu.Unlock()
+}
+
+// Len возвращает число nonce в кэше.
+func (c *NonceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.expires)
+}
+
+func (c *NonceCache) sweep(now time.Time) {
+	for nonce, exp := range c.expires {
+		if !now.Before(exp) {
+			delete(c.expires, nonce)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package sign подписывает запросы агента HMAC-SHA256 и проверяет подписи на сервере.
+//
+// Подписываются метка времени, одноразовый nonce и тело запроса, поэтому перехваченный
+// запрос нельзя отправить повторно: сервер отклоняет запросы со старой меткой времени
+// и с уже встречавшимся nonce. У запросов без тела вместо тела подписывается путь
+// запроса, например /update/counter/PollCount/1.
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Заголовки подписи
+const (
+	HeaderHash      = "HashSHA256"
+	HeaderTimestamp = "X-Signature-Timestamp"
+	HeaderNonce     = "X-Signature-Nonce"
+)
+
+// nonceSize — размер nonce в байтах до кодирования в hex.
+const nonceSize = 16
+
+// Ошибки проверки подписи
+var (
+	ErrMissingSignature = errors.New("signature required")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrStaleTimestamp   = errors.New("timestamp outside allowed clock skew")
+	ErrReplayedRequest  = errors.New("request nonce already used")
+)
+
+// Sum вычисляет HMAC-SHA256 от метки времени, nonce и тела. Без метки времени и nonce
+// подпись совпадает с подписью тела, которую отправляют агенты предыдущих версий.
+func Sum(key, timestamp, nonce string, body []byte) []byte {
+	hasher := hmac.New(sha256.New, []byte(key))
+	if timestamp != "" || nonce != "" {
+		hasher.Write([]byte(timestamp + "\n" + nonce + "\n"))
+	}
+	hasher.Write(body)
+	return hasher.Sum(nil)
+}
+
+// Headers возвращает заголовки подписи тела body на момент now. При пустом ключе
+// возвращается nil.
+func Headers(key string, body []byte, now time.Time) (map[string]string, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	nonceBytes := make([]byte, nonceSize)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	return map[string]string{
+		HeaderHash:      hex.EncodeToString(Sum(key, timestamp, nonce, body)),
+		HeaderTimestamp: timestamp,
+		HeaderNonce:     nonce,
+	}, nil
+}
+
+// Verifier проверяет подписи запросов. Запросы с меткой времени и nonce проверяются
+// на повтор, запросы без подписи и подписи только тела отклоняются. В режиме
+// совместимости legacy они принимаются от старых агентов, хотя перехваченный запрос
+// с такой подписью можно повторять сколько угодно.
+type Verifier struct {
+	key     string
+	maxSkew time.Duration
+	legacy  bool
+	nonces  *NonceCache
+	now     func() time.Time
+}
+
+// NewVerifier создаёт Verifier. Метка времени запроса не должна отличаться от времени
+// сервера больше чем на maxSkew; nonce запоминаются на время, в течение которого
+// запрос с той же меткой времени ещё может быть принят.
+func NewVerifier(key string, maxSkew time.Duration, legacy bool) *Verifier {
+	return &Verifier{
+		key:     key,
+		maxSkew: maxSkew,
+		legacy:  legacy,
+		nonces:  NewNonceCache(),
+		now:     time.Now,
+	}
+}
+
+// Enabled возвращает true, если задан ключ подписи.
+func (v *Verifier) Enabled() bool {
+	return v != nil && v.key != ""
+}
+
+// Verify проверяет подпись тела body по заголовкам запроса и запоминает nonce.
+// В режиме совместимости запрос без подписи считается корректным.
+func (v *Verifier) Verify(header http.Header, body []byte) error {
+	received := header.Get(HeaderHash)
+	if received == "" || received == "none" {
+		if !v.legacy {
+			return fmt.Errorf("%w: missing %s header", ErrMissingSignature, HeaderHash)
+		}
+		return nil
+	}
+
+	receivedBytes, err := hex.DecodeString(received)
+	if err != nil {
+		return fmt.Errorf("%w: malformed hash", ErrInvalidSignature)
+	}
+
+	timestamp, nonce := header.Get(HeaderTimestamp), header.Get(HeaderNonce)
+	if !hmac.Equal(Sum(v.key, timestamp, nonce, body), receivedBytes) {
+		return fmt.Errorf("%w: hash mismatch", ErrInvalidSignature)
+	}
+
+	if timestamp == "" && nonce == "" {
+		if !v.legacy {
+			return fmt.Errorf("%w: %s and %s headers are required", ErrMissingSignature, HeaderTimestamp, HeaderNonce)
+		}
+		return nil
+	}
+	if timestamp == "" || nonce == "" {
+		return fmt.Errorf("%w: both timestamp and nonce are required", ErrInvalidSignature)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp", ErrInvalidSignature)
+	}
+	sent := time.Unix(seconds, 0)
+	now := v.now()
+	if skew := now.Sub(sent).Abs(); skew > v.maxSkew {
+		return fmt.Errorf("%w: %s", ErrStaleTimestamp, skew.Truncate(time.Second))
+	}
+
+	// запрос с меткой sent принимается до sent+maxSkew, столько же хранится его nonce
+	if !v.nonces.Add(nonce, sent.Add(v.maxSkew), now) {
+		return ErrReplayedRequest
+	}
+	return nil
+}
+
+// Forget удаляет nonce запроса из кэша, чтобы агент мог повторить запрос,
+// который сервер не смог обработать.
+func (v *Verifier) Forget(header http.Header) {
+	if nonce := header.Get(HeaderNonce); nonce != "" {
+		v.nonces.Remove(nonce)
+	}
+}
@@ -0,0 +1,187 @@
+package sign
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signedHeader(t *testing.T, key string, body []byte, at time.Time) http.Header {
+	t.Helper()
+
+	headers, err := Headers(key, body, at)
+	require.NoError(t, err)
+	h := make(http.Header)
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+	return h
+}
+
+func newTestVerifier(now time.Time) *Verifier {
+	v := NewVerifier("secret", time.Minute, false)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+
+	testCases := []struct {
+		name   string
+		header func() http.Header
+		err    error
+	}{
+		{name: "valid", header: func() http.Header { return signedHeader(t, "secret", body, now) }},
+		{name: "within_skew", header: func() http.Header { return signedHeader(t, "secret", body, now.Add(-50*time.Second)) }},
+		{name: "unsigned", header: func() http.Header { return http.Header{} }, err: ErrMissingSignature},
+		{
+			name: "legacy_wrong_key",
+			header: func() http.Header {
+				h := make(http.Header)
+				h.Set(HeaderHash, hex.EncodeToString(Sum("other", "", "", body)))
+				return h
+			},
+			err: ErrInvalidSignature,
+		},
+		{
+			name: "legacy_body_only",
+			header: func() http.Header {
+				h := make(http.Header)
+				h.Set(HeaderHash, hex.EncodeToString(Sum("secret", "", "", body)))
+				return h
+			},
+			err: ErrMissingSignature,
+		},
+		{name: "wrong_key", header: func() http.Header { return signedHeader(t, "other", body, now) }, err: ErrInvalidSignature},
+		{name: "stale", header: func() http.Header { return signedHeader(t, "secret", body, now.Add(-2*time.Minute)) }, err: ErrStaleTimestamp},
+		{name: "future", header: func() http.Header { return signedHeader(t, "secret", body, now.Add(2*time.Minute)) }, err: ErrStaleTimestamp},
+		{
+			name: "changed_timestamp",
+			header: func() http.Header {
+				h := signedHeader(t, "secret", body, now)
+				h.Set(HeaderTimestamp, strconv.FormatInt(now.Unix()+1, 10))
+				return h
+			},
+			err: ErrInvalidSignature,
+		},
+		{
+			name: "nonce_removed",
+			header: func() http.Header {
+				h := signedHeader(t, "secret", body, now)
+				h.Del(HeaderNonce)
+				return h
+			},
+			err: ErrInvalidSignature,
+		},
+		{
+			name: "malformed_hash",
+			header: func() http.Header {
+				h := make(http.Header)
+				h.Set(HeaderHash, "zz")
+				return h
+			},
+			err: ErrInvalidSignature,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := newTestVerifier(now).Verify(tc.header(), body)
+			if tc.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestVerifier_Replay(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := newTestVerifier(now)
+	body := []byte("batch")
+
+	h := signedHeader(t, "secret", body, now)
+	require.NoError(t, v.Verify(h, body))
+	assert.ErrorIs(t, v.Verify(h, body), ErrReplayedRequest)
+
+	// после ошибки обработки nonce забывается и запрос можно повторить
+	v.Forget(h)
+	require.NoError(t, v.Verify(h, body))
+
+	// новый nonce для того же тела принимается
+	require.NoError(t, v.Verify(signedHeader(t, "secret", body, now), body))
+}
+
+func TestNonceCache_Expiry(t *testing.T) {
+	c := NewNonceCache()
+	now := time.Unix(1_700_000_000, 0)
+
+	require.True(t, c.Add("a", now.Add(time.Minute), now))
+	assert.False(t, c.Add("a", now.Add(time.Minute), now.Add(30*time.Second)))
+	// после истечения срока nonce может быть использован снова
+	assert.True(t, c.Add("a", now.Add(3*time.Minute), now.Add(2*time.Minute)))
+
+	// просроченные nonce удаляются при периодической очистке
+	later := now.Add(time.Hour)
+	for i := range nonceSweepEvery {
+		c.Add(fmt.Sprint(i), later.Add(time.Minute), later)
+	}
+	assert.Equal(t, nonceSweepEvery, c.Len())
+}
+
+func TestHeaders_NoKey(t *testing.T) {
+	headers, err := Headers("", []byte("body"), time.Now())
+	require.NoError(t, err)
+	assert.Nil(t, headers)
+}
+
+func TestVerifier_RequiresSignature(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := NewVerifier("secret", time.Minute, false)
+	v.now = func() time.Time { return now }
+	body := []byte("batch")
+
+	require.NoError(t, v.Verify(signedHeader(t, "secret", body, now), body))
+
+	assert.ErrorIs(t, v.Verify(http.Header{}, body), ErrMissingSignature)
+
+	none := make(http.Header)
+	none.Set(HeaderHash, "none")
+	assert.ErrorIs(t, v.Verify(none, body), ErrMissingSignature)
+
+	// подпись только тела не защищает от повтора и по умолчанию не принимается
+	legacy := make(http.Header)
+	legacy.Set(HeaderHash, hex.EncodeToString(Sum("secret", "", "", body)))
+	assert.ErrorIs(t, v.Verify(legacy, body), ErrMissingSignature)
+
+	assert.ErrorIs(t, v.Verify(signedHeader(t, "other", body, now), body), ErrInvalidSignature)
+}
+
+func TestVerifier_Legacy(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := NewVerifier("secret", time.Minute, true)
+	v.now = func() time.Time { return now }
+	body := []byte("batch")
+
+	// в режиме совместимости подпись только тела принимается
+	legacy := make(http.Header)
+	legacy.Set(HeaderHash, hex.EncodeToString(Sum("secret", "", "", body)))
+	require.NoError(t, v.Verify(legacy, body))
+
+	// подписи с меткой времени по-прежнему проверяются на повтор
+	h := signedHeader(t, "secret", body, now)
+	require.NoError(t, v.Verify(h, body))
+	assert.ErrorIs(t, v.Verify(h, body), ErrReplayedRequest)
+
+	// запрос без подписи принимается только в режиме совместимости
+	require.NoError(t, v.Verify(http.Header{}, body))
+}
@@ -15,7 +15,8 @@ import (
 )
 
 type dbStorageData struct {
-	db *sql.DB
+	db          *sql.DB
+	retryPolicy retry.Policy
 }
 
 const (
@@ -40,7 +41,12 @@ func NewPostgresStorage(db *sql.DB) (*dbStorageData, error) {
 		return nil, fmt.Errorf("failed to create counters table: %w", err)
 	}
 
-	return &dbStorageData{db: db}, nil
+	return &dbStorageData{db: db, retryPolicy: retry.DefaultPolicy()}, nil
+}
+
+// SetRetryPolicy задаёт политику повторов для запросов к базе данных.
+func (s *dbStorageData) SetRetryPolicy(policy retry.Policy) {
+	s.retryPolicy = policy
 }
 
 func (s *dbStorageData) Ping(ctx context.Context) error {
@@ -49,7 +55,7 @@ func (s *dbStorageData) Ping(ctx context.Context) error {
 }
 
 func (s *dbStorageData) UpdateGauge(ctx context.Context, name string, value float64) {
-	retry.WithRetry(func() error {
+	s.retryPolicy.Do(ctx, func() error {
 		_, err := s.db.ExecContext(ctx, `
 			INSERT INTO gauges (id, value) VALUES ($1, $2)
 			ON CONFLICT (id) DO UPDATE SET value = $2;
@@ -59,7 +65,7 @@ func (s *dbStorageData) UpdateGauge(ctx context.Context, name string, value floa
 }
 
 func (s *dbStorageData) UpdateCounter(ctx context.Context, name string, value int64) {
-	retry.WithRetry(func() error {
+	s.retryPolicy.Do(ctx, func() error {
 		_, err := s.db.ExecContext(ctx, `
 			INSERT INTO counters (id, delta) VALUES ($1, $2)
 			ON CONFLICT (id) DO UPDATE SET delta = $2;
@@ -153,7 +159,7 @@ func (s *dbStorageData) GetKeyCounter(ctx context.Context) ([]string, error) {
 }
 
 func (s *dbStorageData) BatchUpdate(ctx context.Context, metrics []models.Metrics) error {
-	return retry.WithRetry(func() error {
+	_, err := s.retryPolicy.Do(ctx, func() error {
 		tx, err := s.db.BeginTx(ctx, nil)
 		if err != nil {
 			return err
@@ -197,6 +203,7 @@ func (s *dbStorageData) BatchUpdate(ctx context.Context, metrics []models.Metric
 
 		return nil
 	}, isRetriableDBError, "BatchUpdate")
+	return err
 }
 
 func isRetriableDBError(err error) bool {
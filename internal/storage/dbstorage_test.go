@@ -1,8 +1,10 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/Himany/go-musthave-metrics-tpl/internal/retry"
 	"github.com/jackc/pgerrcode"
@@ -46,8 +48,9 @@ func TestDBStorage_WithDBRetry(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			attempts := 0
+			policy := retry.Policy{MaxAttempts: 4, InitialInterval: time.Millisecond, Multiplier: 2}
 
-			err := retry.WithRetry(func() error {
+			res, err := policy.Do(context.Background(), func() error {
 				attempts++
 				if attempts <= tc.failCount {
 					if tc.retriable {
@@ -59,6 +62,7 @@ func TestDBStorage_WithDBRetry(t *testing.T) {
 			}, isRetriableDBError, tc.name)
 
 			assert.Equal(t, tc.expectAttempts, attempts, "не совпадает количество попыток")
+			assert.Equal(t, tc.expectAttempts, res.Attempts, "не совпадает количество попыток в результате")
 			if tc.expectError {
 				assert.Error(t, err, "ожидалась ошибка")
 			} else {
@@ -20,8 +20,9 @@ type MemStorageData struct {
 	Gauge   map[string]float64
 	Counter map[string]int64
 
-	fileToSave string
-	isSyncSave bool
+	fileToSave  string
+	isSyncSave  bool
+	retryPolicy retry.Policy
 }
 
 func NewMemStorage(path string, isSyncSave bool) *MemStorageData {
@@ -29,11 +30,17 @@ func NewMemStorage(path string, isSyncSave bool) *MemStorageData {
 		Gauge:   make(map[string]float64),
 		Counter: make(map[string]int64),
 
-		fileToSave: path,
-		isSyncSave: isSyncSave,
+		fileToSave:  path,
+		isSyncSave:  isSyncSave,
+		retryPolicy: retry.DefaultPolicy(),
 	}
 }
 
+// SetRetryPolicy задаёт политику повторов для операций с файлом.
+func (s *MemStorageData) SetRetryPolicy(policy retry.Policy) {
+	s.retryPolicy = policy
+}
+
 func (s *MemStorageData) Ping(ctx context.Context) error {
 	return nil
 }
@@ -105,7 +112,7 @@ func (s *MemStorageData) SaveData() error {
 		return errors.New("MEM file is not specified")
 	}
 
-	return retry.WithRetry(func() error {
+	_, err := s.retryPolicy.Do(context.Background(), func() error {
 		// создаем файл
 		file, err := os.OpenFile(s.fileToSave, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 		if err != nil {
@@ -134,6 +141,7 @@ func (s *MemStorageData) SaveData() error {
 
 		return nil
 	}, isRetriableFileError, "SaveData")
+	return err
 }
 
 func (s *MemStorageData) LoadData() error {
@@ -141,7 +149,7 @@ func (s *MemStorageData) LoadData() error {
 		return errors.New("MEM file is not specified")
 	}
 
-	return retry.WithRetry(func() error {
+	_, err := s.retryPolicy.Do(context.Background(), func() error {
 		var save saveFormat
 
 		data, err := os.ReadFile(s.fileToSave)
@@ -165,6 +173,7 @@ func (s *MemStorageData) LoadData() error {
 		logger.Log.Info("MEM metrics loaded successfully", zap.String("path", s.fileToSave))
 		return nil
 	}, isRetriableFileError, "LoadData")
+	return err
 }
 
 func (s *MemStorageData) SaveHandler(interval int) {
@@ -1,5 +1,7 @@
 package utils
 
+import "time"
+
 func SetIntIfUnset(envSet map[string]bool, envKey string, cfgValue *int, flagValue int) {
 	if envSet[envKey] {
 		return
@@ -7,6 +9,20 @@ func SetIntIfUnset(envSet map[string]bool, envKey string, cfgValue *int, flagVal
 	*cfgValue = flagValue
 }
 
+func SetInt64IfUnset(envSet map[string]bool, envKey string, cfgValue *int64, flagValue int64) {
+	if envSet[envKey] {
+		return
+	}
+	*cfgValue = flagValue
+}
+
+func SetFloat64IfUnset(envSet map[string]bool, envKey string, cfgValue *float64, flagValue float64) {
+	if envSet[envKey] {
+		return
+	}
+	*cfgValue = flagValue
+}
+
 func SetStringIfUnset(envSet map[string]bool, envKey string, cfgValue *string, flagValue string) {
 	if envSet[envKey] {
 		return
@@ -20,3 +36,10 @@ func SetBoolIfUnset(envSet map[string]bool, envKey string, cfgValue *bool, flagV
 	}
 	*cfgValue = flagValue
 }
+
+func SetDurationIfUnset(envSet map[string]bool, envKey string, cfgValue *time.Duration, flagValue time.Duration) {
+	if envSet[envKey] {
+		return
+	}
+	*cfgValue = flagValue
+}